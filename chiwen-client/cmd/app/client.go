@@ -54,7 +54,7 @@ func run() error {
 	// -----------------------
 	// 3. 客户端：确保凭证（注册 or 跳过）
 	// -----------------------
-	id, agentSecret, err := handler.Register()
+	id, _, err := handler.Register()
 	if err != nil {
 		zap.L().Error("register failed", zap.Error(err))
 		return err
@@ -77,11 +77,10 @@ func run() error {
 
 	go service.HeartbeatLoop(
 		id,
-		agentSecret,
 		interval,
 		dataDir,
 	)
-	go service.StartAgentWebSocketLoop(id, agentSecret)
+	go service.StartAgentWebSocketLoop(id)
 
 	// -----------------------
 	// 5. 初始化路由
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,7 +17,7 @@ import (
 	"go.uber.org/zap"
 )
 
-// Register 负责确保本地 UUID + RSA 密钥 + agent_secret_key
+// Register 负责确保本地 UUID + RSA 密钥 + agent_secret_key，并据此初始化密钥存储（供在线轮换使用）
 func Register() (string, string, error) {
 
 	// -------------------- 1. 目录 --------------------
@@ -49,11 +50,27 @@ func Register() (string, string, error) {
 	}
 	zap.L().Info("rsa keys ready", zap.String("pub_len", fmt.Sprintf("%d", len(pubPEM))))
 
-	// -------------------- 4. 本地存在 agent_secret → 跳过注册 --------------------
+	// -------------------- 4. 本地存在 agent_secret → 跳过注册（私钥到期时重新注册更换） --------------------
 	if b, err := os.ReadFile(secretPath); err == nil && len(bytes.TrimSpace(b)) > 0 {
 		agentSecret := string(bytes.TrimSpace(b))
 		zap.L().Info("found existing agent_secret_key, skip register", zap.String("path", secretPath))
+		if service.KeyRotationDue(privKeyPath) {
+			if secret, err := service.Reenroll(id, privKeyPath, pubKeyPath, secretPath); err == nil {
+				agentSecret = secret
+			} else {
+				zap.L().Warn("rsa key rotation failed, keep using current key", zap.Error(err))
+			}
+		}
+		service.InitAgentSecret(secretPath, privKeyPath, agentSecret)
+		return id, agentSecret, nil
+	}
+
+	// -------------------- 4.1 密钥文件丢失但资产已登记 → 凭私钥重新注册，保留原资产 --------------------
+	if agentSecret, err := service.Reenroll(id, privKeyPath, pubKeyPath, secretPath); err == nil {
+		service.InitAgentSecret(secretPath, privKeyPath, agentSecret)
 		return id, agentSecret, nil
+	} else if !errors.Is(err, service.ErrNotEnrolled) {
+		zap.L().Warn("re-enrollment failed, fall back to register", zap.Error(err))
 	}
 
 	// -------------------- 5. 构造注册请求 --------------------
@@ -101,6 +118,7 @@ func Register() (string, string, error) {
 			zap.L().Info("agent_secret_key saved (pending approved)",
 				zap.String("path", secretPath))
 
+			service.InitAgentSecret(secretPath, privKeyPath, agentSecret)
 			return id, agentSecret, nil
 		}
 
@@ -148,6 +166,7 @@ func Register() (string, string, error) {
 		}
 
 		zap.L().Info("agent_secret_key saved from encrypted_secret", zap.String("path", secretPath))
+		service.InitAgentSecret(secretPath, privKeyPath, agentSecret)
 		return id, agentSecret, nil
 	}
 
@@ -166,6 +185,7 @@ func Register() (string, string, error) {
 		}
 
 		zap.L().Info("agent_secret_key saved", zap.String("path", secretPath))
+		service.InitAgentSecret(secretPath, privKeyPath, agentSecret)
 		return id, agentSecret, nil
 	}
 
@@ -22,6 +22,17 @@ type RegisterResponse struct {
 type HeartbeatRequest struct {
 	ID        string                 `json:"id" binding:"required"`
 	Timestamp int64                  `json:"timestamp" binding:"required"`
+	Nonce     string                 `json:"nonce"`
 	Metrics   map[string]interface{} `json:"metrics" binding:"required"`
 	Signature string                 `json:"signature" binding:"required"`
 }
+
+// ReenrollRequest 重新注册请求：old_signature 用原私钥签名，new_signature 用新私钥签名
+type ReenrollRequest struct {
+	ID           string `json:"id"`
+	Nonce        string `json:"nonce"`
+	Timestamp    int64  `json:"timestamp"`
+	NewPublicKey string `json:"new_public_key"`
+	OldSignature string `json:"old_signature"`
+	NewSignature string `json:"new_signature"`
+}
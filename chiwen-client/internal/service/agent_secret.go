@@ -0,0 +1,126 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// agentSecretStore 保存 Agent HMAC 密钥。轮换后旧密钥写入 <secret>.prev 暂存，
+// 服务端未确认新密钥（确认消息丢失且已超时）时用旧密钥重连；
+// 用当前密钥成功连上服务端即说明服务端已启用新密钥，旧密钥随之删除
+type agentSecretStore struct {
+	mu          sync.RWMutex
+	current     string
+	previous    string
+	path        string
+	privKeyPath string
+}
+
+var agentSecrets agentSecretStore
+
+// agentRevoked 服务端返回 403（Agent 已吊销）后置位，心跳和长连接随之停止
+var agentRevoked atomic.Bool
+
+func markAgentRevoked() {
+	if agentRevoked.CompareAndSwap(false, true) {
+		zap.L().Error("Agent 已被服务端吊销，停止心跳和长连接；如需恢复请删除本地 UUID 文件后重新注册")
+	}
+}
+
+// InitAgentSecret 初始化密钥存储，secretPath 为密钥文件，privKeyPath 用于解密服务端下发的新密钥
+func InitAgentSecret(secretPath, privKeyPath, secret string) {
+	agentSecrets.mu.Lock()
+	defer agentSecrets.mu.Unlock()
+	agentSecrets.path = secretPath
+	agentSecrets.privKeyPath = privKeyPath
+	agentSecrets.current = secret
+	if b, err := os.ReadFile(secretPath + ".prev"); err == nil {
+		agentSecrets.previous = string(b)
+	}
+}
+
+// AgentSecret 返回当前使用的密钥
+func AgentSecret() string {
+	agentSecrets.mu.RLock()
+	defer agentSecrets.mu.RUnlock()
+	return agentSecrets.current
+}
+
+// writeFileAtomic 先写临时文件再改名，避免写到一半断电导致密钥文件损坏
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// rotateAgentSecret 解密并保存服务端下发的新密钥，原密钥转为旧密钥
+func rotateAgentSecret(encryptedB64 string) (string, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(encryptedB64)
+	if err != nil {
+		return "", fmt.Errorf("decode encrypted_secret: %w", err)
+	}
+
+	agentSecrets.mu.Lock()
+	defer agentSecrets.mu.Unlock()
+	secret, err := DecryptAgentSecret(agentSecrets.privKeyPath, encrypted)
+	if err != nil {
+		return "", fmt.Errorf("decrypt encrypted_secret: %w", err)
+	}
+	if secret == agentSecrets.current {
+		// 重复下发（如确认消息丢失后服务端重试），直接确认
+		return secret, nil
+	}
+
+	// 先落盘旧密钥再覆盖当前密钥，任何一步失败都不会丢失仍然有效的密钥
+	if err := writeFileAtomic(agentSecrets.path+".prev", []byte(agentSecrets.current)); err != nil {
+		return "", fmt.Errorf("write previous agent secret: %w", err)
+	}
+	if err := writeFileAtomic(agentSecrets.path, []byte(secret)); err != nil {
+		return "", fmt.Errorf("write agent secret: %w", err)
+	}
+	agentSecrets.previous = agentSecrets.current
+	agentSecrets.current = secret
+	return secret, nil
+}
+
+// fallbackAgentSecret 当前密钥被服务端拒绝时与旧密钥互换，返回是否有可换的旧密钥
+func fallbackAgentSecret() bool {
+	agentSecrets.mu.Lock()
+	defer agentSecrets.mu.Unlock()
+	if agentSecrets.previous == "" {
+		return false
+	}
+	cur, prev := agentSecrets.previous, agentSecrets.current
+	if err := writeFileAtomic(agentSecrets.path+".prev", []byte(prev)); err != nil {
+		zap.L().Error("写入旧密钥失败", zap.Error(err))
+		return false
+	}
+	if err := writeFileAtomic(agentSecrets.path, []byte(cur)); err != nil {
+		zap.L().Error("写入密钥失败", zap.Error(err))
+		return false
+	}
+	agentSecrets.current, agentSecrets.previous = cur, prev
+	return true
+}
+
+// confirmAgentSecret 用 secret 认证成功后调用：若仍是当前密钥，删除旧密钥
+func confirmAgentSecret(secret string) {
+	agentSecrets.mu.Lock()
+	defer agentSecrets.mu.Unlock()
+	if agentSecrets.previous == "" || secret != agentSecrets.current {
+		return
+	}
+	if err := os.Remove(agentSecrets.path + ".prev"); err != nil && !os.IsNotExist(err) {
+		zap.L().Warn("删除旧密钥失败", zap.Error(err))
+		return
+	}
+	agentSecrets.previous = ""
+	zap.L().Info("新密钥已生效，旧密钥已删除")
+}
@@ -4,11 +4,14 @@ package service
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"os/exec"
 	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/chiwen/client/pkg/frame"
 	"github.com/creack/pty"
 	"github.com/gorilla/websocket"
 	"github.com/spf13/viper"
@@ -25,15 +28,148 @@ type TTYSessionFromServer struct {
 	TerminalCols int    `json:"terminal_cols"`
 	TerminalRows int    `json:"terminal_rows"`
 	BrowserIP    string `json:"browser_ip"`
+	OSUser       string `json:"os_user"` // 目标主机账号，空表示以 Agent 自身账号运行
+}
+
+// agentMessage 服务端下发给某个会话的消息（input/resize/close_session）
+type agentMessage struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+	Data      string `json:"data"`
+	Cols      int    `json:"cols"`
+	Rows      int    `json:"rows"`
+	Bytes     int    `json:"bytes"` // ack：服务端已送达浏览器的字节数
+	// detach_session：浏览器断线后 PTY 保留的秒数
+	GraceSeconds int `json:"grace_seconds"`
+}
+
+// agentLink 一条 Agent 长连接，所有会话共用；gorilla/websocket 不支持并发写，写操作统一加锁
+type agentLink struct {
+	conn  *websocket.Conn
+	wmu   sync.Mutex
+	proto int // 服务端在 welcome 中确认的协议版本，旧版服务端不返回时为 JSON 协议
+	// 服务端在 welcome 中下发的流控窗口（字节），0 表示服务端不支持流控
+	flowWindow int
+}
+
+func (l *agentLink) send(v interface{}) error {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+	l.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return l.conn.WriteJSON(v)
+}
+
+func (l *agentLink) sendBinary(data []byte) error {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+	l.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return l.conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
+// sendOutput 上报终端输出：二进制协议原样传输字节；
+// JSON 协议只能传字符串，返回末尾不完整的 UTF-8 字符，由调用方拼到下一段
+func (l *agentLink) sendOutput(sessionID string, data []byte) (rest []byte, err error) {
+	if l.proto >= frame.VersionBinary {
+		return nil, l.sendBinary(frame.Encode(frame.TypeOutput, sessionID, data))
+	}
+
+	n := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				n = i
+			}
+			break
+		}
+	}
+	if n == 0 {
+		return data, nil
+	}
+	return data[n:], l.send(map[string]interface{}{
+		"type":       "output",
+		"session_id": sessionID,
+		"data":       string(data[:n]),
+	})
+}
+
+// sessionInboxSize 每个会话待处理消息队列的长度
+const sessionInboxSize = 64
+
+// flowControl 按会话的确认窗口：已发出但服务端尚未确认的输出达到窗口大小时暂停读取 PTY，
+// 慢浏览器的积压由此传导到 PTY（最终阻塞写终端的进程），而不是堆积在服务端内存里
+type flowControl struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	window      int
+	outstanding int
+	closed      bool
+}
+
+func newFlowControl(window int) *flowControl {
+	f := &flowControl{window: window}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// acquire 等待窗口有余量后记录 n 字节为未确认，会话关闭时返回 false
+func (f *flowControl) acquire(n int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for f.window > 0 && f.outstanding >= f.window && !f.closed {
+		f.cond.Wait()
+	}
+	if f.closed {
+		return false
+	}
+	f.outstanding += n
+	return true
+}
+
+// release 服务端确认 n 字节
+func (f *flowControl) release(n int) {
+	f.mu.Lock()
+	f.outstanding -= n
+	if f.outstanding < 0 {
+		f.outstanding = 0
+	}
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+func (f *flowControl) close() {
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+	f.cond.Broadcast()
 }
 
 // SessionPair 记录正在运行的会话
 type SessionPair struct {
-	Pty    *os.File
-	Cmd    *exec.Cmd
-	Cols   int
-	Rows   int
-	Closed bool
+	ID   string
+	Pty  *os.File
+	Cmd  *exec.Cmd
+	Cols int
+	Rows int
+
+	link      *agentLink
+	flow      *flowControl
+	inbox     chan agentMessage // 读循环路由过来的消息，由会话自己的 goroutine 顺序处理
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// 浏览器断线保留：detached 期间输出写入 scrollback，恢复时一次性补发
+	outMu      sync.Mutex
+	detached   bool
+	scrollback *ringBuffer
+	graceTimer *time.Timer
+}
+
+// scrollbackSize 断线期间每个会话暂存输出的上限，默认 256KB
+func scrollbackSize() int {
+	if n := viper.GetInt("client.tty_scrollback_size"); n > 0 {
+		return n
+	}
+	return 256 * 1024
 }
 
 var (
@@ -41,12 +177,15 @@ var (
 	sessionMu      sync.RWMutex
 )
 
-// StartAgentWebSocketLoop 启动 Agent 长连接（自动重连 + ping）
+// StartAgentWebSocketLoop 启动 Agent 长连接（自动重连 + ping），每次连接使用当前密钥
 // 只需要调用一次！
-func StartAgentWebSocketLoop(assetID, agentSecret string) {
+func StartAgentWebSocketLoop(assetID string) {
 	go func() {
 		for {
-			if err := connectAgentWS(assetID, agentSecret); err != nil {
+			if err := connectAgentWS(assetID, AgentSecret()); err != nil {
+				if agentRevoked.Load() {
+					return
+				}
 				zap.L().Error("Agent WebSocket 断开，5秒后重连", zap.Error(err))
 				time.Sleep(5 * time.Second)
 			}
@@ -57,30 +196,49 @@ func StartAgentWebSocketLoop(assetID, agentSecret string) {
 func connectAgentWS(assetID, agentSecret string) error {
 	// 构造带签名的 URL
 	ts := fmt.Sprintf("%d", time.Now().Unix())
-	msg := assetID + ts
+	nonce, err := generateNonceHex()
+	if err != nil {
+		return err
+	}
+	msg := assetID + "|" + ts + "|" + nonce
 	sig := hmacBase64Sign([]byte(agentSecret), []byte(msg))
 
 	proto := "ws"
 	if viper.GetString("server.protocol") == "https" {
 		proto = "wss"
 	}
-	url := fmt.Sprintf("%s://%s:%d/api/v1/agent/tty/agent/ws?asset_id=%s&ts=%s&sig=%s",
+	url := fmt.Sprintf("%s://%s:%d/api/v1/agent/tty/agent/ws?asset_id=%s&ts=%s&nonce=%s&sig=%s&proto=%d&flow=1",
 		proto,
 		viper.GetString("server.host"),
 		viper.GetInt("server.port"),
-		assetID, ts, sig)
+		assetID, ts, nonce, sig, frame.Version)
 
 	zap.L().Info("Agent 正在连接 WebSocket", zap.String("url", url))
 
-	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
 	if err != nil {
+		// 密钥被拒绝：可能是轮换确认未送达服务端，改用旧密钥重连
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized && fallbackAgentSecret() {
+			zap.L().Warn("当前密钥被服务端拒绝，改用另一把密钥重连")
+		}
+		if resp != nil && resp.StatusCode == http.StatusForbidden {
+			markAgentRevoked()
+		}
+		if resp != nil && resp.StatusCode == http.StatusBadRequest {
+			zap.L().Warn("服务端拒绝了连接时间戳，请检查本机时钟是否同步（NTP）")
+		}
 		return fmt.Errorf("dial failed: %w", err)
 	}
 	defer conn.Close()
 
 	zap.L().Info("Agent WebSocket 已连接", zap.String("asset_id", assetID))
+	confirmAgentSecret(agentSecret)
 
-	// 心跳
+	link := &agentLink{conn: conn, proto: frame.VersionJSON}
+	// 连接断开后，该连接上的会话都无法再与浏览器通信，全部关闭
+	defer closeLinkSessions(link)
+
+	// 心跳（WriteControl 可与其他写操作并发调用）
 	ticker := time.NewTicker(20 * time.Second)
 	defer ticker.Stop()
 	go func() {
@@ -91,13 +249,26 @@ func connectAgentWS(assetID, agentSecret string) error {
 		}
 	}()
 
-	// 主消息循环
+	// 主消息循环：整条连接只有这一个读者，消息按 session_id 路由到各会话
 	for {
-		_, message, err := conn.ReadMessage()
+		msgType, message, err := conn.ReadMessage()
 		if err != nil {
 			return fmt.Errorf("read error: %w", err)
 		}
 
+		// 二进制帧：用户输入
+		if msgType == websocket.BinaryMessage {
+			f, err := frame.Decode(message)
+			if err != nil {
+				zap.L().Warn("无法解析的二进制帧", zap.Error(err))
+				continue
+			}
+			if f.Type == frame.TypeInput {
+				routeToSession(agentMessage{Type: "input", SessionID: f.SessionID, Data: string(f.Payload)})
+			}
+			continue
+		}
+
 		var base struct {
 			Type string `json:"type"`
 		}
@@ -107,7 +278,29 @@ func connectAgentWS(assetID, agentSecret string) error {
 
 		switch base.Type {
 		case "welcome":
-			zap.L().Info("收到服务端欢迎消息")
+			var welcome struct {
+				ProtocolVersion int `json:"protocol_version"`
+				FlowWindow      int `json:"flow_window"`
+			}
+			json.Unmarshal(message, &welcome)
+			// 旧版服务端不返回 protocol_version/flow_window，继续使用 JSON 协议且不做流控
+			if welcome.ProtocolVersion >= frame.VersionBinary {
+				link.proto = frame.VersionBinary
+			}
+			link.flowWindow = welcome.FlowWindow
+			zap.L().Info("收到服务端欢迎消息",
+				zap.Int("protocol_version", link.proto),
+				zap.Int("flow_window", link.flowWindow))
+
+		case "rotate_secret":
+			var msg struct {
+				RotationID      string `json:"rotation_id"`
+				EncryptedSecret string `json:"encrypted_secret"`
+			}
+			if err := json.Unmarshal(message, &msg); err != nil {
+				continue
+			}
+			handleRotateSecret(link, assetID, msg.RotationID, msg.EncryptedSecret)
 
 		case "new_session":
 			var session TTYSessionFromServer
@@ -120,7 +313,29 @@ func connectAgentWS(assetID, agentSecret string) error {
 				zap.Int("cols", session.TerminalCols),
 				zap.Int("rows", session.TerminalRows))
 
-			go handleTTYSession(conn, session)
+			// 先在读循环里登记会话，保证紧随其后的 input/resize 不会因 PTY 尚未启动而丢失
+			sp := registerSession(link, session)
+			go handleTTYSession(sp, session)
+
+		case "ack":
+			// 确认消息直接在读循环里处理，不能排在可能阻塞的 PTY 写入之后
+			var msg agentMessage
+			if err := json.Unmarshal(message, &msg); err != nil {
+				continue
+			}
+			sessionMu.RLock()
+			sp := activeSessions[msg.SessionID]
+			sessionMu.RUnlock()
+			if sp != nil {
+				sp.flow.release(msg.Bytes)
+			}
+
+		case "input", "resize", "close_session", "detach_session", "resume_session":
+			var msg agentMessage
+			if err := json.Unmarshal(message, &msg); err != nil {
+				continue
+			}
+			routeToSession(msg)
 
 		default:
 			zap.L().Debug("未知消息类型", zap.String("type", base.Type))
@@ -128,19 +343,97 @@ func connectAgentWS(assetID, agentSecret string) error {
 	}
 }
 
-// handleTTYSession 启动 pty 并双向转发
-func handleTTYSession(agentConn *websocket.Conn, session TTYSessionFromServer) {
-	cmd := exec.Command("/bin/bash")
-	if session.Command != "" && session.Command != "/bin/bash" {
-		cmd = exec.Command("sh", "-c", session.Command)
+// handleRotateSecret 保存服务端下发的新密钥后确认；确认签名用新密钥计算，证明已正确解密
+func handleRotateSecret(link *agentLink, assetID, rotationID, encryptedSecret string) {
+	ack := map[string]interface{}{
+		"type":        "rotate_secret_ack",
+		"rotation_id": rotationID,
 	}
+	secret, err := rotateAgentSecret(encryptedSecret)
+	if err != nil {
+		zap.L().Error("密钥轮换失败", zap.String("rotation_id", rotationID), zap.Error(err))
+		ack["error"] = err.Error()
+	} else {
+		zap.L().Info("新密钥已保存", zap.String("rotation_id", rotationID))
+		ack["signature"] = hmacBase64Sign([]byte(secret), []byte("rotate|"+assetID+"|"+rotationID))
+	}
+	if err := link.send(ack); err != nil {
+		zap.L().Error("发送密钥轮换确认失败", zap.Error(err))
+	}
+}
 
-	ptmx, err := pty.Start(cmd)
+// registerSession 登记会话路由
+func registerSession(link *agentLink, session TTYSessionFromServer) *SessionPair {
+	sp := &SessionPair{
+		ID:    session.ID,
+		Cols:  session.TerminalCols,
+		Rows:  session.TerminalRows,
+		link:  link,
+		flow:  newFlowControl(link.flowWindow),
+		inbox: make(chan agentMessage, sessionInboxSize),
+		done:  make(chan struct{}),
+	}
+	sessionMu.Lock()
+	activeSessions[session.ID] = sp
+	sessionMu.Unlock()
+	return sp
+}
+
+// routeToSession 把消息投递给对应会话，会话不存在或已结束时丢弃。
+// 读循环由所有会话共用，不能等待某个会话：队列满（如 PTY 写阻塞）时直接关闭该会话
+func routeToSession(msg agentMessage) {
+	sessionMu.RLock()
+	sp := activeSessions[msg.SessionID]
+	sessionMu.RUnlock()
+	if sp == nil {
+		return
+	}
+	select {
+	case sp.inbox <- msg:
+	case <-sp.done:
+	default:
+		zap.L().Warn("会话消息队列已满，关闭会话", zap.String("session_id", sp.ID), zap.Int("inbox_size", sessionInboxSize))
+		go func() {
+			sp.link.send(map[string]interface{}{"type": "session_closed", "session_id": sp.ID})
+			sp.close()
+		}()
+	}
+}
+
+// closeLinkSessions 关闭某条连接上的所有会话
+func closeLinkSessions(link *agentLink) {
+	sessionMu.RLock()
+	var sessions []*SessionPair
+	for _, sp := range activeSessions {
+		if sp.link == link {
+			sessions = append(sessions, sp)
+		}
+	}
+	sessionMu.RUnlock()
+
+	for _, sp := range sessions {
+		sp.close()
+	}
+}
+
+// handleTTYSession 启动 pty 并双向转发
+func handleTTYSession(sp *SessionPair, session TTYSessionFromServer) {
+	defer sp.close()
+
+	var ptmx *os.File
+	cmd, err := buildSessionCommand(session)
+	if err == nil {
+		ptmx, err = pty.Start(cmd)
+	}
 	if err != nil {
-		zap.L().Error("pty.Start 失败", zap.Error(err))
+		zap.L().Error("启动终端失败",
+			zap.String("session_id", session.ID),
+			zap.String("os_user", session.OSUser),
+			zap.Error(err))
+		sp.link.sendOutput(session.ID, []byte("\r\n无法启动终端: "+err.Error()+"\r\n"))
+		sp.link.send(map[string]interface{}{"type": "session_closed", "session_id": session.ID})
 		return
 	}
-	defer ptmx.Close()
 
 	// 设置初始大小
 	_ = pty.Setsize(ptmx, &pty.Winsize{
@@ -148,121 +441,151 @@ func handleTTYSession(agentConn *websocket.Conn, session TTYSessionFromServer) {
 		Rows: uint16(session.TerminalRows),
 	})
 
-	// 注册会话
 	sessionMu.Lock()
-	activeSessions[session.ID] = &SessionPair{
-		Pty:  ptmx,
-		Cmd:  cmd,
-		Cols: session.TerminalCols,
-		Rows: session.TerminalRows,
-	}
+	sp.Pty, sp.Cmd = ptmx, cmd
 	sessionMu.Unlock()
 
+	// PTY 启动期间会话可能已被关闭（连接断开或 close_session）
+	select {
+	case <-sp.done:
+		cmd.Process.Kill()
+		go cmd.Wait()
+		ptmx.Close()
+		return
+	default:
+	}
+
 	zap.L().Info("PTY 已启动", zap.String("session_id", session.ID))
 
 	// Agent → Server → Browser（输出）
 	go func() {
 		buf := make([]byte, 32*1024)
+		var rest []byte
 		for {
 			n, err := ptmx.Read(buf)
 			if err != nil {
 				break
 			}
-			payload := map[string]interface{}{
-				"type":       "output",
-				"session_id": session.ID,
-				"data":       string(buf[:n]),
+			data := buf[:n]
+			if len(rest) > 0 {
+				data = append(rest, data...)
+			}
+
+			sp.outMu.Lock()
+			if sp.detached {
+				// 浏览器断线期间继续读取 PTY（避免阻塞进程），输出暂存到环形缓冲区
+				sp.scrollback.Write(data)
+				rest = nil
+				sp.outMu.Unlock()
+				continue
 			}
-			if err := agentConn.WriteJSON(payload); err != nil {
+			// 窗口用尽时在这里等待，期间不再读取 PTY
+			if !sp.flow.acquire(n) {
+				sp.outMu.Unlock()
 				break
 			}
+			rest, err = sp.link.sendOutput(session.ID, data)
+			sp.outMu.Unlock()
+			if err != nil {
+				break
+			}
+			rest = append([]byte(nil), rest...)
 		}
-		closePTY(session.ID)
+		// shell 退出：通知服务端结束会话
+		sp.link.send(map[string]interface{}{"type": "session_closed", "session_id": session.ID})
+		sp.close()
 	}()
 
-	// Browser → Server → Agent（输入 + resize）
-	// Browser → Server → Agent（输入 + resize + close）
+	// Browser → Server → Agent（输入 + resize + close），消息由读循环路由过来
 	for {
-		_, data, err := agentConn.ReadMessage()
-		if err != nil {
-			break
-		}
-
-		var base struct {
-			Type string `json:"type"`
-		}
-		if err := json.Unmarshal(data, &base); err != nil {
-			continue
-		}
-
-		switch base.Type {
-		case "input":
-			var input struct {
-				SessionID string `json:"session_id"`
-				Data      string `json:"data"`
-			}
-			if err := json.Unmarshal(data, &input); err == nil && input.SessionID == session.ID {
-				writeToPTY(session.ID, []byte(input.Data))
-			}
-
-		case "resize":
-			var r struct {
-				SessionID string `json:"session_id"`
-				Cols      int    `json:"cols"`
-				Rows      int    `json:"rows"`
-			}
-			if err := json.Unmarshal(data, &r); err == nil && r.SessionID == session.ID {
-				resizePTY(session.ID, r.Cols, r.Rows)
-			}
-
-		case "close_session":
-			var c struct {
-				SessionID string `json:"session_id"`
-			}
-			if err := json.Unmarshal(data, &c); err == nil && c.SessionID == session.ID {
+		select {
+		case <-sp.done:
+			return
+		case msg := <-sp.inbox:
+			switch msg.Type {
+			case "input":
+				ptmx.Write([]byte(msg.Data))
+			case "resize":
+				pty.Setsize(ptmx, &pty.Winsize{Cols: uint16(msg.Cols), Rows: uint16(msg.Rows)})
+				sp.Cols, sp.Rows = msg.Cols, msg.Rows
+			case "close_session":
 				zap.L().Info("会话被主动关闭", zap.String("session_id", session.ID))
 				return
+			case "detach_session":
+				sp.detach(time.Duration(msg.GraceSeconds) * time.Second)
+			case "resume_session":
+				sp.resume()
 			}
 		}
 	}
-
-	// 命令结束或异常
-	cmd.Wait()
-	closePTY(session.ID)
 }
 
-// 写入输入
-func writeToPTY(sessionID string, data []byte) {
-	sessionMu.RLock()
-	sp := activeSessions[sessionID]
-	sessionMu.RUnlock()
-	if sp != nil && !sp.Closed {
-		sp.Pty.Write(data)
+// detach 浏览器断线：保留 PTY，输出改为写入环形缓冲区。
+// 正常情况下由服务端在保留期结束时发送 close_session，这里多等 30 秒兜底，防止服务端消息丢失导致进程残留
+func (sp *SessionPair) detach(grace time.Duration) {
+	sp.outMu.Lock()
+	sp.detached = true
+	if sp.scrollback == nil {
+		sp.scrollback = newRingBuffer(scrollbackSize())
+	}
+	if sp.graceTimer != nil {
+		sp.graceTimer.Stop()
 	}
+	sp.graceTimer = time.AfterFunc(grace+30*time.Second, func() {
+		zap.L().Info("会话断线保留超时", zap.String("session_id", sp.ID))
+		sp.link.send(map[string]interface{}{"type": "session_closed", "session_id": sp.ID})
+		sp.close()
+	})
+	sp.outMu.Unlock()
+
+	zap.L().Info("浏览器断线，会话保留中", zap.String("session_id", sp.ID), zap.Duration("grace", grace))
 }
 
-// 调整终端大小
-func resizePTY(sessionID string, cols, rows int) {
-	sessionMu.RLock()
-	sp := activeSessions[sessionID]
-	sessionMu.RUnlock()
-	if sp != nil {
-		pty.Setsize(sp.Pty, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
-		sp.Cols, sp.Rows = cols, rows
+// resume 浏览器重连：补发断线期间暂存的输出，然后恢复实时输出
+func (sp *SessionPair) resume() {
+	sp.outMu.Lock()
+	defer sp.outMu.Unlock()
+	if !sp.detached {
+		return
 	}
-}
+	if sp.graceTimer != nil {
+		sp.graceTimer.Stop()
+		sp.graceTimer = nil
+	}
+	sp.detached = false
 
-// 关闭会话
-func closePTY(sessionID string) {
-	sessionMu.Lock()
-	sp := activeSessions[sessionID]
-	if sp != nil {
-		sp.Closed = true
-		if sp.Cmd.Process != nil {
-			sp.Cmd.Process.Kill()
+	if missed := sp.scrollback.Bytes(); len(missed) > 0 && sp.flow.acquire(len(missed)) {
+		// 暂存数据可能从多字节字符中间截断，JSON 协议下末尾残缺部分直接丢弃，并归还其占用的窗口
+		if rest, err := sp.link.sendOutput(sp.ID, missed); err == nil && len(rest) > 0 {
+			sp.flow.release(len(rest))
 		}
-		sp.Pty.Close()
-		delete(activeSessions, sessionID)
 	}
-	sessionMu.Unlock()
+	zap.L().Info("会话已恢复", zap.String("session_id", sp.ID))
+}
+
+// close 结束会话：注销路由、杀掉进程并关闭 PTY，可重复调用
+func (sp *SessionPair) close() {
+	sp.closeOnce.Do(func() {
+		sessionMu.Lock()
+		if activeSessions[sp.ID] == sp {
+			delete(activeSessions, sp.ID)
+		}
+		ptmx, cmd := sp.Pty, sp.Cmd
+		sessionMu.Unlock()
+
+		close(sp.done)
+		sp.flow.close()
+		sp.outMu.Lock()
+		if sp.graceTimer != nil {
+			sp.graceTimer.Stop()
+		}
+		sp.outMu.Unlock()
+		if cmd != nil && cmd.Process != nil {
+			cmd.Process.Kill()
+			go cmd.Wait()
+		}
+		if ptmx != nil {
+			ptmx.Close()
+		}
+	})
 }
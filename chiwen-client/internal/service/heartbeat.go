@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -24,21 +26,24 @@ import (
 )
 
 // HeartbeatLoop 负责周期性发送心跳：会在第一次发送时包含静态信息，随后只发送动态信息（如果静态变化会一并发送）
-// agentSecret 是解密后的明文 secret（建议长度/格式由服务端定义），interval 单位秒
-func HeartbeatLoop(id, agentSecret string, interval int, dataDir string) {
+// 每次心跳使用当前密钥签名（密钥可能被在线轮换），interval 单位秒
+func HeartbeatLoop(id string, interval int, dataDir string) {
 	ticker := time.NewTicker(time.Duration(interval) * time.Second)
 	defer ticker.Stop()
 
 	var lastStaticHash string
 
 	// 立即发送一次心跳（启动时）
-	if err := sendOneHeartbeat(id, agentSecret, &lastStaticHash); err != nil {
+	if err := sendOneHeartbeat(id, AgentSecret(), &lastStaticHash); err != nil {
 		// 记录但不退出
 		_ = err
 	}
 
 	for range ticker.C {
-		_ = sendOneHeartbeat(id, agentSecret, &lastStaticHash)
+		if agentRevoked.Load() {
+			return
+		}
+		_ = sendOneHeartbeat(id, AgentSecret(), &lastStaticHash)
 	}
 }
 
@@ -74,12 +79,16 @@ func sendOneHeartbeat(id, agentSecret string, lastStaticHash *string) error {
 		}
 	}
 
-	// canonical payload: id|timestamp|metrics-json（metrics 压缩成紧凑 JSON）
+	// canonical payload: id|timestamp|nonce|metrics-json（metrics 压缩成紧凑 JSON）
 	metricsBytes, err := json.Marshal(metrics)
 	if err != nil {
 		return err
 	}
-	payload := fmt.Sprintf("%s|%d|%s", id, timestamp, string(metricsBytes))
+	nonce, err := generateNonceHex()
+	if err != nil {
+		return err
+	}
+	payload := fmt.Sprintf("%s|%d|%s|%s", id, timestamp, nonce, string(metricsBytes))
 
 	// HMAC-SHA256 签名（agentSecret 作为 key）
 	sig := hmacBase64Sign([]byte(agentSecret), []byte(payload))
@@ -87,6 +96,7 @@ func sendOneHeartbeat(id, agentSecret string, lastStaticHash *string) error {
 	hb := &mode.HeartbeatRequest{
 		ID:        id,
 		Timestamp: timestamp,
+		Nonce:     nonce,
 		Metrics:   metricsToInterfaceMap(metrics),
 		Signature: sig,
 	}
@@ -136,6 +146,9 @@ func SendHeartbeat(hb *mode.HeartbeatRequest) ([]byte, error) {
 	defer resp.Body.Close()
 	respBody, _ := io.ReadAll(resp.Body)
 
+	if resp.StatusCode == http.StatusForbidden {
+		markAgentRevoked()
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
 	}
@@ -149,6 +162,15 @@ func hmacBase64Sign(key, msg []byte) string {
 	return base64.StdEncoding.EncodeToString(m.Sum(nil))
 }
 
+// generateNonceHex 生成防重放用的随机串（16 字节 hex，可直接放进 URL）
+func generateNonceHex() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 // metricsToInterfaceMap 确保 metrics 为 map[string]interface{}（为 json.Marshal 兼容）
 func metricsToInterfaceMap(m map[string]interface{}) map[string]interface{} {
 	return m
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// defaultShell 账号未配置登录 shell 时使用
+const defaultShell = "/bin/bash"
+
+// promptCommand 每次显示提示符前输出 OSC 133;D;{退出码}，终端会忽略该序列，服务端审计据此识别命令退出码
+const promptCommand = `PROMPT_COMMAND=printf '\033]133;D;%s\007' "$?"`
+
+// buildSessionCommand 构造会话要执行的命令，osUser 为空时以 Agent 自身账号运行
+func buildSessionCommand(session TTYSessionFromServer) (*exec.Cmd, error) {
+	if session.OSUser == "" {
+		cmd := exec.Command(defaultShell)
+		if session.Command != "" && session.Command != defaultShell {
+			cmd = exec.Command("sh", "-c", session.Command)
+		}
+		cmd.Env = append(os.Environ(), "TERM=xterm-256color", promptCommand)
+		return cmd, nil
+	}
+	return commandAsUser(session.OSUser, session.Command)
+}
+
+// loginEnv 目标账号的干净登录环境，不继承 Agent 进程的环境变量
+func loginEnv(username, home, shell string) []string {
+	env := []string{
+		"HOME=" + home,
+		"USER=" + username,
+		"LOGNAME=" + username,
+		"SHELL=" + shell,
+		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"TERM=xterm-256color",
+		promptCommand,
+	}
+	if lang := os.Getenv("LANG"); lang != "" {
+		env = append(env, "LANG="+lang)
+	}
+	return env
+}
+
+// loginShell 从 /etc/passwd 读取账号的登录 shell
+func loginShell(username string) string {
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		return defaultShell
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) == 7 && fields[0] == username && fields[6] != "" {
+			return fields[6]
+		}
+	}
+	return defaultShell
+}
+
+// loginCommand 以登录 shell 方式启动（argv[0] 以 - 开头），自定义命令交给 shell -c 执行
+func loginCommand(shell, command string) *exec.Cmd {
+	if command != "" && command != defaultShell {
+		return exec.Command(shell, "-c", command)
+	}
+	cmd := exec.Command(shell)
+	cmd.Args[0] = "-" + filepath.Base(shell)
+	return cmd
+}
@@ -0,0 +1,57 @@
+//go:build !windows
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// commandAsUser 以目标账号的 uid/gid、附属组、家目录和登录环境启动 shell，Agent 需以 root 运行
+func commandAsUser(username, command string) (*exec.Cmd, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return nil, fmt.Errorf("lookup user %s: %w", username, err)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid %q: %w", u.Uid, err)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid %q: %w", u.Gid, err)
+	}
+	if euid := os.Geteuid(); euid != 0 && uint64(euid) != uid {
+		return nil, fmt.Errorf("agent is not running as root, cannot switch to user %s", username)
+	}
+
+	var groups []uint32
+	if ids, err := u.GroupIds(); err == nil {
+		for _, id := range ids {
+			if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+				groups = append(groups, uint32(g))
+			}
+		}
+	}
+
+	shell := loginShell(username)
+	cmd := loginCommand(shell, command)
+	cmd.Env = loginEnv(username, u.HomeDir, shell)
+	cmd.Dir = u.HomeDir
+	if info, err := os.Stat(u.HomeDir); err != nil || !info.IsDir() {
+		cmd.Dir = "/"
+	}
+	// pty.Start 会保留这里的 SysProcAttr，只额外设置 Setsid/Setctty
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid:    uint32(uid),
+			Gid:    uint32(gid),
+			Groups: groups,
+		},
+	}
+	return cmd, nil
+}
@@ -0,0 +1,11 @@
+package service
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// commandAsUser Windows 上不支持切换账号
+func commandAsUser(username, command string) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("switching to user %s is not supported on windows", username)
+}
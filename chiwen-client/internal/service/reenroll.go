@@ -0,0 +1,222 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/chiwen/client/internal/api/mode"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNotEnrolled 服务端没有该资产（未审批或已删除），需要走正常注册
+	ErrNotEnrolled = errors.New("asset not enrolled on server")
+	// errReenrollSignature 服务端不认可用于证明身份的私钥
+	errReenrollSignature = errors.New("re-enrollment signature rejected")
+)
+
+// KeyRotationDue 私钥是否已超过 client.key_rotation_days 天未更换，0 表示不定期更换
+func KeyRotationDue(privPath string) bool {
+	days := viper.GetInt("client.key_rotation_days")
+	if days <= 0 {
+		return false
+	}
+	fi, err := os.Stat(privPath)
+	if err != nil {
+		return false
+	}
+	return time.Since(fi.ModTime()) > time.Duration(days)*24*time.Hour
+}
+
+// Reenroll 用当前私钥证明身份，为同一资产ID换上新生成的 RSA 密钥并领取新的 agent_secret_key，
+// 资产的标签、授权和历史记录都保留。新私钥先写入 <key_file>.new，服务端确认后才替换原私钥；
+// 上次重新注册中断时（.new 仍在）沿用该密钥，服务端可能已登记它，因此也用它尝试证明身份
+func Reenroll(id, privPath, pubPath, secretPath string) (string, error) {
+	oldPriv, err := loadPrivateKey(privPath)
+	if err != nil {
+		return "", fmt.Errorf("load private key: %w", err)
+	}
+
+	pendingPath := privPath + ".new"
+	proofs := []*rsa.PrivateKey{oldPriv}
+	newPriv, err := loadPrivateKey(pendingPath)
+	if err == nil {
+		proofs = append(proofs, newPriv)
+		zap.L().Info("resuming interrupted re-enrollment", zap.String("path", pendingPath))
+	} else {
+		if newPriv, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			return "", err
+		}
+		privPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(newPriv)})
+		if err := os.WriteFile(pendingPath, privPEM, 0o600); err != nil {
+			return "", fmt.Errorf("write new private key: %w", err)
+		}
+	}
+	pubASN1, err := x509.MarshalPKIXPublicKey(&newPriv.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubASN1})
+
+	var encrypted string
+	for _, proof := range proofs {
+		encrypted, err = sendReenroll(id, proof, newPriv, string(pubPEM))
+		if !errors.Is(err, errReenrollSignature) {
+			break
+		}
+	}
+	if err != nil {
+		// 网络等错误时服务端可能已经生效，保留 .new 供下次继续
+		if errors.Is(err, ErrNotEnrolled) || errors.Is(err, errReenrollSignature) {
+			os.Remove(pendingPath)
+		}
+		return "", err
+	}
+
+	secretBytes, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", fmt.Errorf("decode encrypted_secret: %w", err)
+	}
+	secret, err := DecryptAgentSecret(pendingPath, secretBytes)
+	if err != nil {
+		return "", fmt.Errorf("decrypt encrypted_secret: %w", err)
+	}
+
+	// 先保存密钥再替换私钥：中途退出时新密钥可用，.new 留待下次重新注册时沿用
+	if err := writeFileAtomic(secretPath, []byte(secret)); err != nil {
+		return "", fmt.Errorf("write agent secret: %w", err)
+	}
+	os.Remove(secretPath + ".prev")
+	if err := os.Rename(pendingPath, privPath); err != nil {
+		return "", fmt.Errorf("replace private key: %w", err)
+	}
+	if err := writeFileAtomic(pubPath, pubPEM); err != nil {
+		return "", fmt.Errorf("write public key: %w", err)
+	}
+	zap.L().Info("re-enrolled with new RSA key", zap.String("id", id))
+	return secret, nil
+}
+
+// sendReenroll 发送重新注册请求，返回用新公钥加密的密钥（base64）
+func sendReenroll(id string, proof, newPriv *rsa.PrivateKey, newPubPEM string) (string, error) {
+	nonce, err := GenerateNonceBase64(32)
+	if err != nil {
+		return "", err
+	}
+	req := &mode.ReenrollRequest{
+		ID:           id,
+		Nonce:        nonce,
+		Timestamp:    time.Now().Unix(),
+		NewPublicKey: newPubPEM,
+	}
+	payload := fmt.Sprintf("reenroll|%s|%s|%d|%s", req.ID, req.Nonce, req.Timestamp, req.NewPublicKey)
+	if req.OldSignature, err = signWithKey(proof, payload); err != nil {
+		return "", err
+	}
+	if req.NewSignature, err = signWithKey(newPriv, payload); err != nil {
+		return "", err
+	}
+
+	path := viper.GetString("server.reenroll_path")
+	if path == "" {
+		path = "/api/v1/register/reenroll"
+	}
+	proto := viper.GetString("server.protocol")
+	if proto == "" {
+		proto = "http"
+	}
+	url := fmt.Sprintf("%s://%s:%d%s", proto, viper.GetString("server.host"), viper.GetInt("server.port"), path)
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	timeout := time.Duration(viper.GetInt("server.timeout")) * time.Second
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", ErrNotEnrolled
+	case http.StatusUnauthorized:
+		return "", errReenrollSignature
+	default:
+		return "", fmt.Errorf("server returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	var rr mode.RegisterResponse
+	if err := json.Unmarshal(respBody, &rr); err != nil {
+		return "", err
+	}
+	if rr.EncryptedSecret == "" {
+		return "", errors.New("re-enrollment response has no encrypted_secret")
+	}
+	return rr.EncryptedSecret, nil
+}
+
+// loadPrivateKey 读取 PEM 私钥（PKCS1 或 PKCS8）
+func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	privPEM, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(privPEM)
+	if block == nil {
+		return nil, fmt.Errorf("invalid private key PEM")
+	}
+	if priv, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return priv, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not RSA")
+	}
+	return priv, nil
+}
+
+// signWithKey SHA256 + RSA PKCS1v15 签名，返回 base64
+func signWithKey(priv *rsa.PrivateKey, payload string) (string, error) {
+	h := sha256.Sum256([]byte(payload))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, h[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,46 @@
+// internal/service/scrollback.go
+package service
+
+// ringBuffer 固定容量的环形缓冲区，写满后覆盖最旧的数据，用于浏览器断线期间暂存终端输出
+type ringBuffer struct {
+	buf   []byte
+	start int // 最旧数据的位置
+	size  int // 当前数据长度
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	return &ringBuffer{buf: make([]byte, capacity)}
+}
+
+// Write 追加数据，超出容量的部分只保留最新的
+func (r *ringBuffer) Write(p []byte) {
+	c := len(r.buf)
+	if c == 0 {
+		return
+	}
+	if len(p) >= c {
+		copy(r.buf, p[len(p)-c:])
+		r.start, r.size = 0, c
+		return
+	}
+	for _, b := range p {
+		end := (r.start + r.size) % c
+		r.buf[end] = b
+		if r.size < c {
+			r.size++
+		} else {
+			r.start = (r.start + 1) % c
+		}
+	}
+}
+
+// Bytes 按写入顺序取出全部数据并清空缓冲区
+func (r *ringBuffer) Bytes() []byte {
+	out := make([]byte, 0, r.size)
+	c := len(r.buf)
+	for i := 0; i < r.size; i++ {
+		out = append(out, r.buf[(r.start+i)%c])
+	}
+	r.start, r.size = 0, 0
+	return out
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/envelope"
+	"github.com/chiwen/server/pkg/config"
+	"github.com/chiwen/server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// initMasterKeys 加载加密 Agent 密钥的主密钥：环境变量 CHIWEN_MASTER_KEYS 优先，其次是 security.master_key_file 指向的文件，
+// 每行一把 <key_id>:<base64 32 字节>；主用密钥取 CHIWEN_MASTER_KEY_ID 或 security.master_key_id，未指定时为第一把
+func initMasterKeys() error {
+	raw := os.Getenv("CHIWEN_MASTER_KEYS")
+	if raw == "" {
+		if path := viper.GetString("security.master_key_file"); path != "" {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("read master key file: %w", err)
+			}
+			raw = string(b)
+		}
+	}
+	keys, ids, err := envelope.ParseKeys(raw)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return envelope.Init(nil, "")
+	}
+	primary := os.Getenv("CHIWEN_MASTER_KEY_ID")
+	if primary == "" {
+		primary = viper.GetString("security.master_key_id")
+	}
+	if primary == "" {
+		primary = ids[0]
+	}
+	return envelope.Init(keys, primary)
+}
+
+// NewSecretsCommand 返回 secrets 命令：Agent 密钥加密存储的迁移与主密钥轮换
+func NewSecretsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Manage encryption of agent secrets at rest",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "gen-key <key_id>",
+		Short: "Generate a new master key entry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := envelope.GenerateKey()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s:%s\n", args[0], key)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypt plaintext agent secrets with the primary master key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSecretsTransform("encrypt", func(assetID, column, stored string) (string, bool, error) {
+				if envelope.IsSealed(stored) {
+					return stored, false, nil
+				}
+				sealed, err := envelope.Seal(stored, mysql.AgentSecretAAD(assetID, column))
+				return sealed, true, err
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rekey",
+		Short: "Re-wrap encrypted agent secrets with the primary master key (and encrypt remaining plaintext, re-bind legacy ciphertext to its column)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSecretsTransform("rekey", func(assetID, column, stored string) (string, bool, error) {
+				aad := mysql.AgentSecretAAD(assetID, column)
+				if !envelope.IsSealed(stored) {
+					sealed, err := envelope.Seal(stored, aad)
+					return sealed, true, err
+				}
+				// 早期版本的密文只绑定资产ID，解密后按列重新加密
+				if _, err := envelope.Open(stored, aad); err != nil {
+					plain, legacyErr := envelope.Open(stored, assetID)
+					if legacyErr != nil {
+						return "", false, err
+					}
+					sealed, err := envelope.Seal(plain, aad)
+					return sealed, true, err
+				}
+				if kid, _ := envelope.KeyID(stored); kid == envelope.PrimaryKeyID() {
+					return stored, false, nil
+				}
+				rewrapped, err := envelope.Rewrap(stored)
+				return rewrapped, true, err
+			})
+		},
+	})
+
+	return cmd
+}
+
+// runSecretsTransform 初始化配置、主密钥和数据库后改写全部 Agent 密钥
+func runSecretsTransform(name string, fn func(assetID, column, stored string) (string, bool, error)) error {
+	if err := config.Init(); err != nil {
+		return fmt.Errorf("init config failed: %w", err)
+	}
+	if err := logger.InitLogger(); err != nil {
+		return fmt.Errorf("init logger failed: %w", err)
+	}
+	if err := initMasterKeys(); err != nil {
+		return fmt.Errorf("init master keys failed: %w", err)
+	}
+	if !envelope.Enabled() {
+		return fmt.Errorf("no master key configured, set CHIWEN_MASTER_KEYS or security.master_key_file")
+	}
+	if err := mysql.InitDB(); err != nil {
+		return fmt.Errorf("init mysql failed: %w", err)
+	}
+	defer mysql.Close()
+
+	updated, skipped, err := mysql.TransformAgentSecrets(fn)
+	zap.L().Info("Agent secrets "+name+" finished",
+		zap.String("primary_key_id", envelope.PrimaryKeyID()),
+		zap.Int("updated", updated),
+		zap.Int("skipped", skipped),
+		zap.Error(err))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d updated, %d skipped\n", name, updated, skipped)
+	if skipped > 0 {
+		fmt.Println("skipped values were changed concurrently, run again to process them")
+	}
+	return nil
+}
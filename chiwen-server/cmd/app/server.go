@@ -14,6 +14,9 @@ import (
 
 	"github.com/chiwen/server/internal/api/routes" // 项目内部路由构建
 	"github.com/chiwen/server/internal/data/mysql" // 项目内部 MySQL 初始化封装
+	"github.com/chiwen/server/internal/pkg/envelope"
+	"github.com/chiwen/server/internal/pkg/utils"
+	"github.com/chiwen/server/internal/service"
 	"github.com/chiwen/server/internal/task"
 	"github.com/chiwen/server/pkg/config" // 项目配置初始化（包装 viper）
 	"github.com/chiwen/server/pkg/logger" // 项目日志初始化（包装 zap）
@@ -31,6 +34,8 @@ func NewServerCommand() *cobra.Command {
 			return run() // 执行实际启动逻辑（抽离到 run()，便于测试）
 		},
 	}
+	// 子命令：Agent 密钥加密迁移与主密钥轮换
+	cmd.AddCommand(NewSecretsCommand())
 	return cmd // 返回 cobra 命令实例
 }
 
@@ -47,12 +52,36 @@ func run() error {
 	}
 	zap.L().Info("Logger initialized") // 全局 logger 就绪，打印一条信息
 
+	// JWT 签名密钥：环境变量 JWT_SECRET 优先，其次是配置文件 auth.jwt.secret，未配置时拒绝启动
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		secret = viper.GetString("auth.jwt.secret")
+	}
+	if err := utils.InitJWT(secret, viper.GetDuration("auth.jwt.access_ttl")); err != nil {
+		return fmt.Errorf("init jwt failed: %w", err)
+	}
+
+	// Agent 密钥加密存储的主密钥，未配置时新密钥以明文入库
+	if err := initMasterKeys(); err != nil {
+		return fmt.Errorf("init master keys failed: %w", err)
+	}
+	if envelope.Enabled() {
+		zap.L().Info("Agent secrets encrypted at rest", zap.String("primary_key_id", envelope.PrimaryKeyID()))
+	} else {
+		zap.L().Warn("No master key configured, agent secrets are stored in plaintext")
+	}
+
 	// 3. init mysql
 	if err := mysql.InitDB(); err != nil { // 初始化 MySQL 连接池（sqlx 或 database/sql）
 		return fmt.Errorf("init mysql failed: %w", err)
 	}
 	defer mysql.Close() // 程序退出时关闭数据库连接（defer 在 run 返回时执行）
 
+	// 加载令牌吊销记录，重启后已退出登录的令牌仍然无效
+	if err := service.LoadTokenRevocations(); err != nil {
+		return fmt.Errorf("load token revocations failed: %w", err)
+	}
+
 	// 新增：启动所有后台任务（离线检测、后续可以加更多定时任务）
 	// 放在这里最合适：所有依赖（logger、mysql）都已初始化，HTTP 服务还没完全挡住主协程
 	task.StartBackgroundTasks()
@@ -1,7 +1,119 @@
 // internal/agent/conns.go
 package agent
 
-import "github.com/gorilla/websocket"
+import (
+	"errors"
+	"sync"
+	"time"
 
-// AgentConns 全局保存所有在线的 Agent 长连接
-var AgentConns = make(map[string]*websocket.Conn)
+	"github.com/chiwen/server/internal/pkg/frame"
+	"github.com/gorilla/websocket"
+)
+
+// writeTimeout 单次写 Agent 连接的超时时间，避免一个卡住的 Agent 阻塞调用方
+const writeTimeout = 10 * time.Second
+
+// ErrAgentOffline Agent 不在线
+var ErrAgentOffline = errors.New("agent offline")
+
+// Conn 一条 Agent 长连接，所有会话共用；gorilla/websocket 不支持并发写，这里统一加锁
+type Conn struct {
+	*websocket.Conn
+	AssetID    string
+	Proto      int // 与该 Agent 协商的协议版本，见 frame 包
+	FlowWindow int // 每个会话未确认输出的上限（字节），0 表示 Agent 不支持流控
+
+	wmu sync.Mutex
+}
+
+// WriteJSON 串行写入一条 JSON 消息
+func (c *Conn) WriteJSON(v interface{}) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.Conn.WriteJSON(v)
+}
+
+// WriteMessage 串行写入一帧
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// SendInput 把用户输入转发给 Agent，按协商的协议版本选择二进制帧或旧版 JSON
+func (c *Conn) SendInput(sessionID string, data []byte) error {
+	if c.Proto >= frame.VersionBinary {
+		return c.WriteMessage(websocket.BinaryMessage, frame.Encode(frame.TypeInput, sessionID, data))
+	}
+	return c.WriteJSON(map[string]interface{}{
+		"type":       "input",
+		"session_id": sessionID,
+		"data":       string(data),
+	})
+}
+
+var (
+	conns   = make(map[string]*Conn)
+	connsMu sync.RWMutex
+)
+
+// SendAck 确认已送达浏览器的输出字节数，Agent 据此恢复发送额度
+func (c *Conn) SendAck(sessionID string, n int) error {
+	return c.WriteJSON(map[string]interface{}{
+		"type":       "ack",
+		"session_id": sessionID,
+		"bytes":      n,
+	})
+}
+
+// Register 登记 Agent 连接；同一资产重复连接时断开旧连接
+func Register(c *Conn) *Conn {
+	connsMu.Lock()
+	old := conns[c.AssetID]
+	conns[c.AssetID] = c
+	connsMu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	return c
+}
+
+// Unregister 注销 Agent 连接，只有当前登记的仍是 c 时才会移除，返回是否移除
+func Unregister(c *Conn) bool {
+	connsMu.Lock()
+	defer connsMu.Unlock()
+	if conns[c.AssetID] != c {
+		return false
+	}
+	delete(conns, c.AssetID)
+	return true
+}
+
+// Get 查找在线的 Agent 连接
+func Get(assetID string) (*Conn, bool) {
+	connsMu.RLock()
+	defer connsMu.RUnlock()
+	c, ok := conns[assetID]
+	return c, ok
+}
+
+// Disconnect 断开资产的 Agent 长连接（密钥失效后旧连接不能继续使用），返回是否在线
+func Disconnect(assetID string) bool {
+	c, ok := Get(assetID)
+	if ok {
+		c.Close()
+	}
+	return ok
+}
+
+// Send 向资产的 Agent 发送一条 JSON 消息
+func Send(assetID string, v interface{}) error {
+	c, ok := Get(assetID)
+	if !ok {
+		return ErrAgentOffline
+	}
+	return c.WriteJSON(v)
+}
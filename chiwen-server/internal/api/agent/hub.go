@@ -0,0 +1,540 @@
+// internal/api/agent/hub.go
+package agent
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Role 会话参与者角色
+type Role string
+
+const (
+	RoleOwner       Role = "owner"       // 发起会话的用户
+	RoleWatch       Role = "watch"       // 只读旁观
+	RoleCollaborate Role = "collaborate" // 与发起人共同输入
+	RoleTakeover    Role = "takeover"    // 接管会话，期间发起人只读
+)
+
+// ParseJoinRole 解析加入会话的模式，只允许 watch/collaborate/takeover
+func ParseJoinRole(mode string) (Role, bool) {
+	switch r := Role(mode); r {
+	case RoleWatch, RoleCollaborate, RoleTakeover:
+		return r, true
+	}
+	return "", false
+}
+
+// ErrSessionClosed 会话已结束
+var ErrSessionClosed = errors.New("session closed")
+
+// ErrNotDetached 会话当前没有处于断线保留状态，不能恢复
+var ErrNotDetached = errors.New("session is not detached")
+
+// ErrInputNotAllowed 当前角色不允许输入
+var ErrInputNotAllowed = errors.New("input not allowed for this role")
+
+// Subscriber 会话输出的接收方（浏览器连接）
+type Subscriber interface {
+	SendOutput(data []byte) error
+	Close(reason string)
+}
+
+// Participant 会话参与者
+type Participant struct {
+	Sub      Subscriber `json:"-"`
+	Role     Role       `json:"role"`
+	UserID   string     `json:"user_id"`
+	Username string     `json:"username"`
+	JoinedAt time.Time  `json:"joined_at"`
+}
+
+// SessionInfo 在线会话概要
+type SessionInfo struct {
+	ID           string        `json:"id"`
+	AssetID      string        `json:"asset_id"`
+	UserID       string        `json:"user_id"`
+	CreatedAt    time.Time     `json:"created_at"`
+	Detached     bool          `json:"detached"` // 发起人已断线，等待恢复
+	Participants []Participant `json:"participants"`
+	SessionStats
+}
+
+// SessionStats 会话输出流量统计
+type SessionStats struct {
+	BufferedBytes  int64 `json:"buffered_bytes"`  // 已收到但尚未送达浏览器的字节数
+	DeliveredBytes int64 `json:"delivered_bytes"` // 已送达浏览器的字节数
+	FlowControl    bool  `json:"flow_control"`    // Agent 是否启用了确认窗口流控
+}
+
+// backlogSize 为新加入的旁观者保留的最近输出字节数，用于还原当前屏幕
+const backlogSize = 64 * 1024
+
+// outputQueueSize 每个会话输出队列的长度（帧数），只有不支持流控的 Agent 会因队列满而结束会话
+const outputQueueSize = 256
+
+// Session 一个正在进行的 TTY 会话，Agent 输出经会话自己的输出队列分发给所有参与者，
+// 某个浏览器写得慢只会阻塞本会话，不会卡住 Agent 连接上的其他会话
+type Session struct {
+	ID        string
+	AssetID   string
+	UserID    string
+	Agent     *Conn // 承载该会话的 Agent 连接
+	CreatedAt time.Time
+
+	hub      *Hub
+	onOutput func(data []byte) // 输出旁路（录像）
+	out      chan outputChunk
+	pumpDone chan struct{}
+
+	buffered  atomic.Int64
+	delivered atomic.Int64
+
+	mu           sync.Mutex
+	participants []*Participant
+	onInput      func(userID string, data []byte)
+	onClose      func()
+	backlog      []byte
+	closed       bool
+	done         chan struct{}
+
+	// 断线保留：发起人断线后会话保持一段时间，期间的输出暂存在 missed 中，凭恢复令牌重连后补发
+	detached    bool
+	detachTimer *time.Timer
+	missed      []byte
+	resumeHash  []byte
+
+	// 断线/恢复后的通知（发给 Agent、写库）不在会话锁内做，按 stateSeq 排序：
+	// notifyMu 串行化通知，过时的通知（之后又发生了断线或恢复）直接跳过
+	notifyMu sync.Mutex
+	stateSeq uint64
+}
+
+// Hub 在线会话注册表
+type Hub struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+// Sessions 全局会话注册表
+var Sessions = &Hub{sessions: make(map[string]*Session)}
+
+// Open 注册一个新会话，onOutput 在每段 Agent 输出分发前调用（可为 nil）
+func (h *Hub) Open(id string, agentConn *Conn, userID string, onOutput func([]byte)) *Session {
+	s := &Session{
+		ID:        id,
+		AssetID:   agentConn.AssetID,
+		UserID:    userID,
+		Agent:     agentConn,
+		CreatedAt: time.Now(),
+		hub:       h,
+		onOutput:  onOutput,
+		out:       make(chan outputChunk, outputQueueSize),
+		pumpDone:  make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	h.mu.Lock()
+	h.sessions[id] = s
+	h.mu.Unlock()
+
+	go s.pump()
+	return s
+}
+
+// Get 查找在线会话
+func (h *Hub) Get(id string) *Session {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.sessions[id]
+}
+
+// List 列出所有在线会话
+func (h *Hub) List() []SessionInfo {
+	h.mu.RLock()
+	sessions := make([]*Session, 0, len(h.sessions))
+	for _, s := range h.sessions {
+		sessions = append(sessions, s)
+	}
+	h.mu.RUnlock()
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		infos = append(infos, s.Info())
+	}
+	return infos
+}
+
+// Dispatch 把 Agent 的输出投递到对应会话的输出队列，只接受承载该会话的连接上报的输出
+func (h *Hub) Dispatch(from *Conn, sessionID string, data []byte) {
+	if s := h.Get(sessionID); s != nil && s.Agent == from {
+		s.Output(data)
+	}
+}
+
+// FindDetached 按恢复令牌查找处于断线保留状态的会话
+func (h *Hub) FindDetached(resumeToken string) *Session {
+	sum := sha256.Sum256([]byte(resumeToken))
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, s := range h.sessions {
+		s.mu.Lock()
+		ok := s.detached && s.resumeHash != nil && subtle.ConstantTimeCompare(s.resumeHash, sum[:]) == 1
+		s.mu.Unlock()
+		if ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// CloseAgent Agent 连接断开时结束该连接上的所有会话
+func (h *Hub) CloseAgent(c *Conn, reason string) {
+	h.mu.RLock()
+	var sessions []*Session
+	for _, s := range h.sessions {
+		if s.Agent == c {
+			sessions = append(sessions, s)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, s := range sessions {
+		s.Close(reason)
+	}
+}
+
+// SetInputHandler 设置会话输入的处理函数（命令拦截后转发给 Agent），userID 为实际输入的参与者
+func (s *Session) SetInputHandler(fn func(userID string, data []byte)) {
+	s.mu.Lock()
+	s.onInput = fn
+	s.mu.Unlock()
+}
+
+// OnClose 设置会话最终结束时的清理函数（在输出全部写入录像之后调用）
+func (s *Session) OnClose(fn func()) {
+	s.mu.Lock()
+	s.onClose = fn
+	s.mu.Unlock()
+}
+
+// Join 加入会话，先向新参与者推送最近的输出还原屏幕，保证与后续输出的顺序
+func (s *Session) Join(p *Participant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSessionClosed
+	}
+	if len(s.backlog) > 0 {
+		p.Sub.SendOutput(s.backlog)
+	}
+	p.JoinedAt = time.Now()
+	s.participants = append(s.participants, p)
+	return nil
+}
+
+// IssueResumeToken 生成新的恢复令牌（旧令牌立即失效），会话中只保存其哈希
+func (s *Session) IssueResumeToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	sum := sha256.Sum256([]byte(token))
+
+	s.mu.Lock()
+	s.resumeHash = sum[:]
+	s.mu.Unlock()
+	return token
+}
+
+// Detach 发起人断线，会话进入断线保留状态，超过 grace 未恢复则结束会话。
+// onDetach 在释放会话锁后调用（可为 nil），用于通知 Agent 和更新状态；已被随后的 Resume 取代时不调用
+func (s *Session) Detach(grace time.Duration, onDetach func()) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrSessionClosed
+	}
+	s.detached = true
+	s.missed = nil
+	s.detachTimer = time.AfterFunc(grace, func() {
+		s.Close("断线超过保留时间，会话已结束")
+	})
+	s.stateSeq++
+	seq := s.stateSeq
+	s.mu.Unlock()
+
+	s.notifyState(seq, onDetach)
+	return nil
+}
+
+// Resume 发起人凭恢复令牌重新连接：先补发断线期间的输出，再恢复实时输出。
+// onResume 与 Detach 的 onDetach 相同，在释放会话锁后按顺序调用
+func (s *Session) Resume(owner *Participant, onResume func()) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrSessionClosed
+	}
+	if !s.detached {
+		s.mu.Unlock()
+		return ErrNotDetached
+	}
+	if s.detachTimer != nil {
+		s.detachTimer.Stop()
+		s.detachTimer = nil
+	}
+	s.detached = false
+
+	if len(s.missed) > 0 {
+		owner.Sub.SendOutput(s.missed)
+		s.missed = nil
+	}
+	owner.JoinedAt = time.Now()
+	s.participants = append(s.participants, owner)
+	s.stateSeq++
+	seq := s.stateSeq
+	s.mu.Unlock()
+
+	s.notifyState(seq, onResume)
+	return nil
+}
+
+// notifyState 调用断线/恢复的通知；seq 之后会话状态又变化过时跳过，由更新的那次通知负责
+func (s *Session) notifyState(seq uint64, fn func()) {
+	if fn == nil {
+		return
+	}
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	s.mu.Lock()
+	current := s.stateSeq
+	s.mu.Unlock()
+	if current == seq {
+		fn()
+	}
+}
+
+// Leave 离开会话
+func (s *Session) Leave(sub Subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.participants {
+		if p.Sub == sub {
+			s.participants = append(s.participants[:i], s.participants[i+1:]...)
+			return
+		}
+	}
+}
+
+// Input 参与者输入；watch 角色以及被接管期间的发起人不能输入
+func (s *Session) Input(sub Subscriber, data []byte) error {
+	s.mu.Lock()
+	var role Role
+	var userID string
+	takenOver := false
+	for _, p := range s.participants {
+		if p.Sub == sub {
+			role, userID = p.Role, p.UserID
+		}
+		if p.Role == RoleTakeover {
+			takenOver = true
+		}
+	}
+	fn := s.onInput
+	s.mu.Unlock()
+
+	switch {
+	case role == "" || role == RoleWatch:
+		return ErrInputNotAllowed
+	case role == RoleOwner && takenOver:
+		return ErrInputNotAllowed
+	}
+	if fn != nil {
+		fn(userID, data)
+	}
+	return nil
+}
+
+// outputChunk 输出队列中的一段数据，fromAgent 为 false 的是服务端自己产生的提示，不计入流控确认
+type outputChunk struct {
+	data      []byte
+	fromAgent bool
+}
+
+// Output 把一段 Agent 终端输出放入会话输出队列。调用方是 Agent 连接的读循环，由连接上所有会话共用。
+// 协商了流控的 Agent 未确认的输出不超过窗口，队列满时等待 pump 消费，不会无限阻塞读循环；
+// 不支持流控的 Agent 不能等待某个会话，队列满（浏览器接收太慢）时结束该会话
+func (s *Session) Output(data []byte) {
+	chunk := outputChunk{data: data, fromAgent: true}
+	if s.Agent.FlowWindow > 0 {
+		s.enqueue(chunk)
+		return
+	}
+	s.buffered.Add(int64(len(chunk.data)))
+	select {
+	case s.out <- chunk:
+	case <-s.done:
+		s.buffered.Add(-int64(len(chunk.data)))
+	default:
+		s.buffered.Add(-int64(len(chunk.data)))
+		// Close 要等输出队列写完录像，不能在读循环里等待
+		go s.Close("终端输出过快，浏览器来不及接收，会话已结束")
+	}
+}
+
+func (s *Session) enqueue(chunk outputChunk) {
+	s.buffered.Add(int64(len(chunk.data)))
+	select {
+	case s.out <- chunk:
+	case <-s.done:
+		s.buffered.Add(-int64(len(chunk.data)))
+	}
+}
+
+// pump 按顺序把输出队列中的数据写入录像并分发给参与者，送达后向 Agent 确认；
+// 会话结束后把剩余数据写完录像再退出
+func (s *Session) pump() {
+	defer close(s.pumpDone)
+
+	// 确认消息攒批发送：攒够四分之一窗口或队列已空时发送一次
+	unacked := 0
+	for {
+		select {
+		case chunk := <-s.out:
+			s.deliver(chunk.data)
+			s.buffered.Add(-int64(len(chunk.data)))
+			s.delivered.Add(int64(len(chunk.data)))
+
+			if window := s.Agent.FlowWindow; window > 0 {
+				if chunk.fromAgent {
+					unacked += len(chunk.data)
+				}
+				if unacked > 0 && (unacked >= window/4 || len(s.out) == 0) {
+					s.Agent.SendAck(s.ID, unacked)
+					unacked = 0
+				}
+			}
+		case <-s.done:
+			for {
+				select {
+				case chunk := <-s.out:
+					if s.onOutput != nil {
+						s.onOutput(chunk.data)
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Session) deliver(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.onOutput != nil {
+		s.onOutput(data)
+	}
+	if s.closed {
+		return
+	}
+
+	s.backlog = appendBounded(s.backlog, data)
+	if s.detached {
+		s.missed = appendBounded(s.missed, data)
+	}
+
+	for _, p := range s.participants {
+		p.Sub.SendOutput(data)
+	}
+}
+
+// appendBounded 追加数据，只保留最后约 backlogSize 字节；裁剪位置对齐到 UTF-8 字符开头，避免补发时出现半个字符
+func appendBounded(buf, data []byte) []byte {
+	buf = append(buf, data...)
+	if len(buf) > backlogSize {
+		start := len(buf) - backlogSize
+		for i := 0; i < utf8.UTFMax-1 && start < len(buf) && !utf8.RuneStart(buf[start]); i++ {
+			start++
+		}
+		buf = append([]byte(nil), buf[start:]...)
+	}
+	return buf
+}
+
+// Notice 向所有参与者的终端输出一条系统提示（同时写入录像）
+func (s *Session) Notice(msg string) {
+	s.enqueue(outputChunk{data: []byte("\r\n\x1b[31m[chiwen] " + msg + "\x1b[0m\r\n")})
+}
+
+// Close 结束会话并断开所有参与者，返回前保证输出队列已全部写入录像，可重复调用
+func (s *Session) Close(reason string) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	participants := s.participants
+	s.participants = nil
+	if s.detachTimer != nil {
+		s.detachTimer.Stop()
+	}
+	onClose := s.onClose
+	close(s.done)
+	s.mu.Unlock()
+	<-s.pumpDone
+
+	s.hub.mu.Lock()
+	if s.hub.sessions[s.ID] == s {
+		delete(s.hub.sessions, s.ID)
+	}
+	s.hub.mu.Unlock()
+
+	for _, p := range participants {
+		p.Sub.Close(reason)
+	}
+	if onClose != nil {
+		onClose()
+	}
+}
+
+// Stats 会话输出流量统计
+func (s *Session) Stats() SessionStats {
+	return SessionStats{
+		BufferedBytes:  s.buffered.Load(),
+		DeliveredBytes: s.delivered.Load(),
+		FlowControl:    s.Agent.FlowWindow > 0,
+	}
+}
+
+// Done 会话结束时关闭
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Info 会话概要
+func (s *Session) Info() SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := SessionInfo{
+		ID:           s.ID,
+		AssetID:      s.AssetID,
+		UserID:       s.UserID,
+		CreatedAt:    s.CreatedAt,
+		Detached:     s.detached,
+		Participants: make([]Participant, 0, len(s.participants)),
+		SessionStats: s.Stats(),
+	}
+	for _, p := range s.participants {
+		info.Participants = append(info.Participants, *p)
+	}
+	return info
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/chiwen/server/internal/api/agent"
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/middleware"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RotateAgentSecretHandler 立即轮换资产的 Agent 密钥（Agent 须在线）
+// POST /api/v1/assets/{id}/rotate-secret
+func RotateAgentSecretHandler(c *gin.Context) {
+	assetID := c.Param("id")
+	_, operator, _ := middleware.CurrentUser(c)
+	rotationID, err := service.RotateAgentSecret(assetID, operator)
+	switch {
+	case err == nil:
+	case errors.Is(err, agent.ErrAgentOffline):
+		c.JSON(http.StatusConflict, gin.H{"error": "agent is offline", "code": "AGENT_OFFLINE"})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "asset not found", "code": "ASSET_NOT_FOUND"})
+		return
+	default:
+		zap.L().Error("Failed to rotate agent secret", zap.String("asset_id", assetID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate agent secret"})
+		return
+	}
+	// 新密钥在 Agent 确认后才生效，状态可通过 GET 同一路径查询
+	c.JSON(http.StatusAccepted, gin.H{"rotation_id": rotationID, "message": "rotate_secret sent, waiting for agent ack"})
+}
+
+// GetAgentSecretStatusHandler 查询资产的 Agent 密钥轮换状态（不返回密钥）
+// GET /api/v1/assets/{id}/rotate-secret
+func GetAgentSecretStatusHandler(c *gin.Context) {
+	assetID := c.Param("id")
+	secrets, err := mysql.GetAgentSecrets(assetID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "asset not found", "code": "ASSET_NOT_FOUND"})
+			return
+		}
+		zap.L().Error("Failed to get agent secrets", zap.String("asset_id", assetID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get agent secret status"})
+		return
+	}
+	status := gin.H{
+		"rotated_at":        secrets.RotatedAt,
+		"pending_rotation":  nil,
+		"previous_valid_to": nil,
+	}
+	if secrets.PendingID != "" {
+		status["pending_rotation"] = gin.H{"rotation_id": secrets.PendingID, "expires_at": secrets.PendingExpires}
+	}
+	if secrets.Previous != "" {
+		status["previous_valid_to"] = secrets.PreviousExpires
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// GetAgentSecretRotationHandler 查询 Agent 密钥定期轮换设置
+// GET /api/v1/settings/agent-secret-rotation
+func GetAgentSecretRotationHandler(c *gin.Context) {
+	settings, err := service.GetAgentSecretRotation()
+	if err != nil {
+		zap.L().Error("Failed to get agent secret rotation settings", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get agent secret rotation settings"})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateAgentSecretRotationHandler 修改 Agent 密钥定期轮换设置
+// PUT /api/v1/settings/agent-secret-rotation {"interval_days":30,"overlap_hours":24}
+func UpdateAgentSecretRotationHandler(c *gin.Context) {
+	var settings model.AgentSecretRotation
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if old, err := service.GetAgentSecretRotation(); err == nil {
+		middleware.AuditBefore(c, old)
+	}
+	_, username, _ := middleware.CurrentUser(c)
+	if err := service.SaveAgentSecretRotation(&settings, username); err != nil {
+		if errors.Is(err, service.ErrInvalidRotationSettings) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_SETTINGS"})
+			return
+		}
+		zap.L().Error("Failed to save agent secret rotation settings", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save agent secret rotation settings"})
+		return
+	}
+	zap.L().Info("Agent secret rotation settings updated", zap.String("by", username))
+	c.JSON(http.StatusOK, settings)
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/chiwen/server/internal/pkg/middleware"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// agentStateRequest 隔离/吊销原因
+type agentStateRequest struct {
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+// agentStateErrorResponse 隔离/吊销错误统一响应
+func agentStateErrorResponse(c *gin.Context, assetID string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "asset not found", "code": "ASSET_NOT_FOUND"})
+	case errors.Is(err, service.ErrAgentRevoked):
+		c.JSON(http.StatusConflict, gin.H{"error": "agent is revoked", "code": "AGENT_REVOKED"})
+	default:
+		zap.L().Error("Failed to change agent state", zap.String("asset_id", assetID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change agent state"})
+	}
+}
+
+// RevokeAgentHandler 吊销 Agent：密钥立即作废、断开长连接，之后的心跳和连接返回 403 AGENT_REVOKED，不可恢复
+// POST /api/v1/assets/{id}/revoke {"reason":"主机失陷"}
+func RevokeAgentHandler(c *gin.Context) {
+	assetID := c.Param("id")
+	var req agentStateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	auditAsset(c, assetID)
+	_, operator, _ := middleware.CurrentUser(c)
+	if err := service.RevokeAgent(assetID, req.Reason, operator); err != nil {
+		agentStateErrorResponse(c, assetID, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "agent revoked"})
+}
+
+// QuarantineAgentHandler 隔离资产：继续接收心跳，关闭并禁止终端会话
+// POST /api/v1/assets/{id}/quarantine {"reason":"排查异常登录"}
+func QuarantineAgentHandler(c *gin.Context) {
+	assetID := c.Param("id")
+	var req agentStateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	auditAsset(c, assetID)
+	_, operator, _ := middleware.CurrentUser(c)
+	if err := service.QuarantineAgent(assetID, req.Reason, operator); err != nil {
+		agentStateErrorResponse(c, assetID, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "agent quarantined"})
+}
+
+// ReleaseAgentQuarantineHandler 解除隔离
+// DELETE /api/v1/assets/{id}/quarantine
+func ReleaseAgentQuarantineHandler(c *gin.Context) {
+	assetID := c.Param("id")
+	auditAsset(c, assetID)
+	_, operator, _ := middleware.CurrentUser(c)
+	if err := service.ReleaseAgentQuarantine(assetID, operator); err != nil {
+		agentStateErrorResponse(c, assetID, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "agent quarantine released"})
+}
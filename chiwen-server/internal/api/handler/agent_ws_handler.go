@@ -2,19 +2,19 @@
 package handler
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/chiwen/server/internal/api/agent"
 	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/frame"
+	"github.com/chiwen/server/internal/service"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -33,24 +33,44 @@ func AgentWebSocketHandler(c *gin.Context) {
 	}
 
 	ts, _ := strconv.ParseInt(tsStr, 10, 64)
-	if err := validateAgentAuth(assetID, ts, tsStr, sig); err != nil {
-		c.JSON(401, gin.H{"error": err.Error()})
+	if err := validateAgentAuth(assetID, ts, tsStr, c.Query("nonce"), sig); err != nil {
+		switch {
+		case errors.Is(err, service.ErrAgentRevoked):
+			// 与签名错误区分开，Agent 收到 403 后停止重连
+			c.JSON(403, gin.H{"error": err.Error(), "code": "AGENT_REVOKED"})
+		case errors.Is(err, service.ErrAgentClockSkew):
+			// 不能返回 401，否则 Agent 会误以为密钥失效而切换密钥
+			c.JSON(400, gin.H{"error": err.Error(), "code": "CLOCK_SKEW"})
+		case errors.Is(err, service.ErrAgentReplay):
+			c.JSON(409, gin.H{"error": err.Error(), "code": "REPLAYED"})
+		default:
+			c.JSON(401, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	conn, err := agentUpgrader.Upgrade(c.Writer, c.Request, nil)
+	ws, err := agentUpgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		zap.L().Error("Agent WS upgrade failed", zap.Error(err))
 		return
 	}
 
-	// 注册 Agent 连接
-	agent.AgentConns[assetID] = conn
+	// 注册 Agent 连接（同一资产重复连接时旧连接会被断开）
+	// 新版 Agent 通过 proto 参数声明支持的协议版本，旧版 Agent 不带该参数，继续使用 JSON；
+	// 通过 flow=1 声明支持按会话的确认窗口流控
+	conn := &agent.Conn{Conn: ws, AssetID: assetID, Proto: frame.Negotiate(c.Query("proto"))}
+	if c.Query("flow") == "1" {
+		conn.FlowWindow = flowWindow()
+	}
+	agent.Register(conn)
 
 	defer func() {
-		delete(agent.AgentConns, assetID)
-		mysql.UpdateAssetStatus(assetID, "offline")
-		mysql.RemoveAgentConnection(assetID)
+		agent.Sessions.CloseAgent(conn, "Agent 已断开")
+		// 已被新连接替换时不能把资产标记为离线
+		if agent.Unregister(conn) {
+			mysql.UpdateAssetStatus(assetID, "offline")
+			mysql.RemoveAgentConnection(assetID)
+		}
 		conn.Close()
 		zap.L().Info("Agent 已断开", zap.String("asset_id", assetID))
 	}()
@@ -59,7 +79,12 @@ func AgentWebSocketHandler(c *gin.Context) {
 	mysql.RegisterAgentConnection(assetID, uuid.New().String(), c.ClientIP())
 
 	// 欢迎消息
-	conn.WriteJSON(gin.H{"type": "welcome", "message": "agent connected"})
+	conn.WriteJSON(gin.H{
+		"type":             "welcome",
+		"message":          "agent connected",
+		"protocol_version": conn.Proto,
+		"flow_window":      conn.FlowWindow,
+	})
 
 	// 设置 pong 处理器
 	conn.SetPongHandler(func(string) error {
@@ -67,33 +92,75 @@ func AgentWebSocketHandler(c *gin.Context) {
 		return nil
 	})
 
-	// 保持连接
+	// 单一读循环：Agent 上报的消息按 session_id 路由到会话中心
 	for {
-		_, _, err := conn.ReadMessage()
+		msgType, msg, err := conn.ReadMessage()
 		if err != nil {
 			break
 		}
+
+		// 二进制帧：终端输出
+		if msgType == websocket.BinaryMessage {
+			f, err := frame.Decode(msg)
+			if err != nil {
+				zap.L().Warn("Invalid frame from agent", zap.String("asset_id", assetID), zap.Error(err))
+				continue
+			}
+			if f.Type == frame.TypeOutput {
+				agent.Sessions.Dispatch(conn, f.SessionID, f.Payload)
+			}
+			continue
+		}
+
+		var payload struct {
+			Type      string `json:"type"`
+			SessionID string `json:"session_id"`
+			Data      string `json:"data"`
+			// rotate_secret_ack
+			RotationID string `json:"rotation_id"`
+			Signature  string `json:"signature"`
+			Error      string `json:"error"`
+		}
+		if err := json.Unmarshal(msg, &payload); err != nil {
+			continue
+		}
+		switch payload.Type {
+		case "output":
+			agent.Sessions.Dispatch(conn, payload.SessionID, []byte(payload.Data))
+		case "session_closed":
+			// Agent 端 shell 已退出
+			if s := agent.Sessions.Get(payload.SessionID); s != nil && s.Agent == conn {
+				go s.Close("终端已退出")
+			}
+		case "rotate_secret_ack":
+			// Agent 已保存新密钥（或报告失败）
+			if err := service.ConfirmAgentSecretRotation(assetID, payload.RotationID, payload.Signature, payload.Error); err != nil {
+				zap.L().Warn("Invalid rotate_secret_ack", zap.String("asset_id", assetID), zap.Error(err))
+			}
+		}
 	}
 }
 
-func validateAgentAuth(assetID string, ts int64, tsStr, signature string) error {
-	if time.Now().Unix()-ts > 120 {
-		return errors.New("timestamp expired")
+// flowWindow 每个会话允许 Agent 发出但尚未确认的输出字节数，默认 256KB
+func flowWindow() int {
+	if n := viper.GetInt("tty.flow_window"); n > 0 {
+		return n
 	}
+	return 256 * 1024
+}
 
-	secret, err := mysql.GetAgentSecretKeyByID(assetID)
-	if err != nil || secret == "" {
+func validateAgentAuth(assetID string, ts int64, tsStr, nonce, signature string) error {
+	// 时间戳窗口 + nonce 防重放；密钥轮换过渡期内新旧密钥都有效
+	if err := service.AuthenticateAgentConnection(assetID, ts, tsStr, nonce, signature); err != nil {
+		if errors.Is(err, service.ErrInvalidAgentSignature) {
+			return errors.New("invalid signature")
+		}
+		if errors.Is(err, service.ErrAgentRevoked) || errors.Is(err, service.ErrAgentClockSkew) || errors.Is(err, service.ErrAgentReplay) {
+			return err
+		}
 		return errors.New("invalid asset or secret")
 	}
 
-	mac := hmac.New(sha256.New, []byte(secret))
-	mac.Write([]byte(assetID + tsStr))
-	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
-
-	if !hmac.Equal([]byte(signature), []byte(expected)) {
-		return errors.New("invalid signature")
-	}
-
 	mysql.UpdateAssetStatus(assetID, "online")
 	return nil
 }
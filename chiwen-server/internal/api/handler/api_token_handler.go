@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/middleware"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// CreateAPITokenRequest 创建 API 令牌请求
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=64"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days"` // 默认 90 天，最长 365 天
+}
+
+// apiTokenErrorResponse 把 API 令牌操作的错误转换为响应
+func apiTokenErrorResponse(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "api token not found", "code": "API_TOKEN_NOT_FOUND"})
+	case errors.Is(err, service.ErrInvalidAPITokenRequest):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_API_TOKEN"})
+	default:
+		zap.L().Error("API token management failed", zap.String("action", action), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+// createAPIToken 为 owner 签发令牌，明文令牌只在本次响应中返回
+func createAPIToken(c *gin.Context, ownerID uint) {
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	owner, err := mysql.GetUserProfile(ownerID)
+	if err != nil {
+		userErrorResponse(c, err, "get user")
+		return
+	}
+	operatorID, operator, operatorIsAdmin := middleware.CurrentUser(c)
+	raw, token, err := service.CreateAPIToken(owner, operatorID, operatorIsAdmin, req.Name, req.Scopes, req.ExpiresInDays, operator)
+	if err != nil {
+		apiTokenErrorResponse(c, err, "create api token")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": raw, "api_token": token})
+}
+
+// revokeAPIToken 吊销 owner 的令牌
+func revokeAPIToken(c *gin.Context, ownerID uint, param string) {
+	id, ok := parseUintParam(c, param)
+	if !ok {
+		return
+	}
+	if err := service.RevokeAPIToken(ownerID, id); err != nil {
+		apiTokenErrorResponse(c, err, "revoke api token")
+		return
+	}
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("API token revoked", zap.Uint("id", id), zap.Uint("user_id", ownerID), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "api token revoked"})
+}
+
+// listAPITokens 查询 owner 的令牌
+func listAPITokens(c *gin.Context, ownerID uint) {
+	tokens, err := service.ListAPITokens(ownerID)
+	if err != nil {
+		apiTokenErrorResponse(c, err, "list api tokens")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// ListMyAPITokensHandler 查询当前用户的个人 API 令牌
+// GET /api/v1/api-tokens
+func ListMyAPITokensHandler(c *gin.Context) {
+	uid, _, _ := middleware.CurrentUser(c)
+	listAPITokens(c, uid)
+}
+
+// CreateMyAPITokenHandler 创建个人 API 令牌，scopes 不能超出自己的权限
+// POST /api/v1/api-tokens {"name":"ci","scopes":["asset:read"],"expires_in_days":90}
+func CreateMyAPITokenHandler(c *gin.Context) {
+	uid, _, _ := middleware.CurrentUser(c)
+	createAPIToken(c, uid)
+}
+
+// RevokeMyAPITokenHandler 吊销个人 API 令牌
+// DELETE /api/v1/api-tokens/{id}
+func RevokeMyAPITokenHandler(c *gin.Context) {
+	uid, _, _ := middleware.CurrentUser(c)
+	revokeAPIToken(c, uid, "id")
+}
+
+// ListUserAPITokensHandler 查询指定用户（如服务账号）的 API 令牌
+// GET /api/v1/users/{id}/api-tokens
+func ListUserAPITokensHandler(c *gin.Context) {
+	if id, ok := parseUintParam(c, "id"); ok {
+		listAPITokens(c, id)
+	}
+}
+
+// CreateUserAPITokenHandler 为指定用户（如服务账号）签发 API 令牌，scopes 不能超出该用户和操作人的权限。
+// 明文令牌返回给操作人，相当于可以冒用该用户，因此只有管理员能为其他用户签发
+// POST /api/v1/users/{id}/api-tokens
+func CreateUserAPITokenHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	if uid, _, isAdmin := middleware.CurrentUser(c); !isAdmin && uid != id {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can create api tokens for other users", "code": "FORBIDDEN"})
+		return
+	}
+	createAPIToken(c, id)
+}
+
+// RevokeUserAPITokenHandler 吊销指定用户的 API 令牌
+// DELETE /api/v1/users/{id}/api-tokens/{token_id}
+func RevokeUserAPITokenHandler(c *gin.Context) {
+	if id, ok := parseUintParam(c, "id"); ok {
+		revokeAPIToken(c, id, "token_id")
+	}
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/middleware"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ListAssetAuthRulesHandler 查询资产授权规则
+// GET /api/v1/asset-auth-rules
+func ListAssetAuthRulesHandler(c *gin.Context) {
+	rules, err := mysql.ListAssetAuthRules()
+	if err != nil {
+		zap.L().Error("Failed to list asset auth rules", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list asset auth rules"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// CreateAssetAuthRuleHandler 新增资产授权规则
+// POST /api/v1/asset-auth-rules
+func CreateAssetAuthRuleHandler(c *gin.Context) {
+	rule := model.AssetAuthRule{Enabled: true}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if err := service.ValidateAssetAuthRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_RULE"})
+		return
+	}
+
+	_, username, _ := middleware.CurrentUser(c)
+	rule.CreatedBy = username
+	if err := mysql.CreateAssetAuthRule(&rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create asset auth rule"})
+		return
+	}
+
+	zap.L().Info("Asset auth rule created", zap.Int64("id", rule.ID), zap.String("name", rule.Name), zap.String("by", username))
+	c.JSON(http.StatusOK, rule)
+}
+
+// UpdateAssetAuthRuleHandler 修改资产授权规则（只影响之后的授权，不断开已建立的会话）
+// PUT /api/v1/asset-auth-rules/{id}
+func UpdateAssetAuthRuleHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule id", "code": "INVALID_PARAMETER"})
+		return
+	}
+
+	var rule model.AssetAuthRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if err := service.ValidateAssetAuthRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_RULE"})
+		return
+	}
+
+	if old, err := mysql.GetAssetAuthRule(id); err == nil {
+		middleware.AuditBefore(c, old)
+	}
+	rule.ID = id
+	if err := mysql.UpdateAssetAuthRule(&rule); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "asset auth rule not found", "code": "RULE_NOT_FOUND"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update asset auth rule"})
+		return
+	}
+
+	_, username, _ := middleware.CurrentUser(c)
+	zap.L().Info("Asset auth rule updated", zap.Int64("id", id), zap.String("by", username))
+	c.JSON(http.StatusOK, gin.H{"message": "asset auth rule updated"})
+}
+
+// DeleteAssetAuthRuleHandler 删除资产授权规则
+// DELETE /api/v1/asset-auth-rules/{id}
+func DeleteAssetAuthRuleHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule id", "code": "INVALID_PARAMETER"})
+		return
+	}
+
+	if old, err := mysql.GetAssetAuthRule(id); err == nil {
+		middleware.AuditBefore(c, old)
+	}
+	if err := mysql.DeleteAssetAuthRule(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "asset auth rule not found", "code": "RULE_NOT_FOUND"})
+			return
+		}
+		zap.L().Error("Failed to delete asset auth rule", zap.Int64("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete asset auth rule"})
+		return
+	}
+
+	_, username, _ := middleware.CurrentUser(c)
+	zap.L().Info("Asset auth rule deleted", zap.Int64("id", id), zap.String("by", username))
+	c.JSON(http.StatusOK, gin.H{"message": "asset auth rule deleted"})
+}
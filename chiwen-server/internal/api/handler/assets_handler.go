@@ -3,11 +3,29 @@ package handler
 import (
 	"net/http"
 
+	"github.com/chiwen/server/internal/api/agent"
 	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/middleware"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+// auditAsset 登记资产变更前的状态
+func auditAsset(c *gin.Context, assetID string) {
+	asset, err := mysql.GetAssetByID(assetID)
+	if err != nil {
+		return
+	}
+	labels, _ := asset.GetLabelsJSON()
+	middleware.AuditBefore(c, gin.H{
+		"id":          asset.ID,
+		"hostname":    asset.Hostname,
+		"status":      asset.Status,
+		"labels":      labels,
+		"agent_state": asset.AgentState,
+	})
+}
+
 // AssetsListHandler 获取资产列表
 func AssetsListHandler(c *gin.Context) {
 	assets, err := mysql.GetAssetsList()
@@ -32,6 +50,7 @@ func DeleteAssetHandler(c *gin.Context) {
 		return
 	}
 
+	auditAsset(c, assetID)
 	err := mysql.DeleteAsset(assetID)
 	if err != nil {
 		zap.L().Error("Failed to delete asset", zap.String("asset_id", assetID), zap.Error(err))
@@ -41,6 +60,9 @@ func DeleteAssetHandler(c *gin.Context) {
 		return
 	}
 
+	// 已删除资产的密钥不再有效，断开仍在线的 Agent（连接上的终端会话随之关闭）
+	agent.Disconnect(assetID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Asset deleted successfully",
 	})
@@ -67,6 +89,7 @@ func UpdateAssetLabelsHandler(c *gin.Context) {
 		return
 	}
 
+	auditAsset(c, assetID)
 	err := mysql.UpdateAssetLabels(assetID, request.Labels)
 	if err != nil {
 		zap.L().Error("Failed to update asset labels", zap.String("asset_id", assetID), zap.Error(err))
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// parseAuditFilter 解析审计事件查询参数，start/end 为 RFC3339 时间
+func parseAuditFilter(c *gin.Context) (model.AuditFilter, bool) {
+	f := model.AuditFilter{
+		Actor:        c.Query("actor"),
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resource_type"),
+		ResourceID:   c.Query("resource_id"),
+	}
+	f.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	f.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	for name, dst := range map[string]**time.Time{"start": &f.Start, "end": &f.End} {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + ", expect RFC3339", "code": "INVALID_PARAMETER"})
+			return f, false
+		}
+		*dst = &t
+	}
+	return f, true
+}
+
+// ListAuditEventsHandler 查询审计事件（管理员）
+// GET /api/v1/audit-events?actor=admin&action=DELETE&resource_type=assets&resource_id=xxx&start=...&end=...&page=1&page_size=20
+func ListAuditEventsHandler(c *gin.Context) {
+	f, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+	events, total, err := service.ListAuditEvents(f)
+	if err != nil {
+		zap.L().Error("Failed to list audit events", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list audit events"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events, "total": total})
+}
+
+// ExportAuditEventsHandler 按查询条件导出审计事件（管理员），JSON Lines 格式，按时间正序
+// GET /api/v1/audit-events/export?start=...&end=...
+func ExportAuditEventsHandler(c *gin.Context) {
+	f, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+	filename := "audit-events-" + time.Now().Format("20060102-150405") + ".jsonl"
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+	if err := service.ExportAuditEvents(f, c.Writer); err != nil {
+		// 响应头已发出，只能记录日志
+		zap.L().Error("Failed to export audit events", zap.Error(err))
+	}
+}
@@ -1,15 +1,16 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
-	"time"
 
 	"github.com/chiwen/server/internal/data/model"
 	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/middleware"
 	"github.com/chiwen/server/internal/pkg/utils"
+	"github.com/chiwen/server/internal/service"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type LoginRequest struct {
@@ -18,8 +19,8 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token string     `json:"token"`
-	User  model.User `json:"user"`
+	service.TokenPair
+	User model.User `json:"user"`
 }
 
 func Login(c *gin.Context) {
@@ -29,50 +30,187 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	var user model.User
-	// 使用sqlx查询用户
-	query := `SELECT id, username, password_hash, name, email, phone, is_active, is_admin, 
-	                 ldap_dn, created_at, updated_at, last_login_at, last_login_ip 
-	          FROM users 
-	          WHERE username = ? AND is_active = 1`
+	// 全局 IP 白名单、来源 IP 限流、账号锁定
+	ip := c.ClientIP()
+	if err := service.CheckLoginAllowed(req.Username, ip); err != nil {
+		rejectLogin(c, 0, req.Username, err)
+		return
+	}
 
-	err := mysql.DB().Get(&user, query, req.Username)
+	// 依次尝试本地账号、LDAP 等认证后端
+	user, err := service.Authenticate(req.Username, req.Password)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"username": req.Username,
-			"error":    err.Error(),
-		}).Warn("登录失败：用户不存在或被禁用")
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "用户名或密码错误"})
+		if errors.Is(err, service.ErrInvalidCredentials) || errors.Is(err, service.ErrUserNotFound) {
+			service.RecordLoginFailure(req.Username, ip)
+		}
+		rejectLogin(c, 0, req.Username, err)
+		return
+	}
+	// 用户的登录 IP 白名单/绑定（LDAP 用户首次登录时刚创建，同样适用）
+	if err := service.CheckUserLoginIP(user.Username, ip); err != nil {
+		rejectLogin(c, user.ID, user.Username, err)
+		return
+	}
+
+	// 开启了 MFA 或策略要求 MFA 时，先返回挑战令牌，完成第二步后才签发正式 token
+	step, err := service.LoginMFAStep(user)
+	if err != nil {
+		logrus.WithField("username", user.Username).WithError(err).Error("查询 MFA 状态失败")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "认证服务暂不可用"})
 		return
 	}
+	if step != "" {
+		purpose := utils.PurposeMFAVerify
+		if step == service.MFAStepEnroll {
+			purpose = utils.PurposeMFAEnroll
+		}
+		mfaToken, err := utils.GenerateMFAToken(user.ID, user.Username, purpose)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "生成 token 失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_step":     step,
+			"mfa_token":    mfaToken,
+			"expires_in":   300,
+		})
+		return
+	}
+
+	issueLoginToken(c, user, false)
+}
+
+// rejectLogin 记录登录失败日志并返回对应的错误
+func rejectLogin(c *gin.Context, userID uint, username string, err error) {
+	logrus.WithFields(logrus.Fields{
+		"username": username,
+		"ip":       c.ClientIP(),
+		"error":    err.Error(),
+	}).Warn("登录失败")
+	writeLoginLog(c, userID, username, model.LoginResultFailure, err.Error(), false)
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		logrus.WithField("username", req.Username).Warn("登录失败：密码错误")
+	switch {
+	case errors.Is(err, service.ErrUserDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"message": "账号已被禁用"})
+	case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrUserNotFound):
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "用户名或密码错误"})
+	case errors.Is(err, service.ErrAccountLocked):
+		c.JSON(http.StatusLocked, gin.H{"message": "登录失败次数过多，账号已被临时锁定，请稍后再试"})
+	case errors.Is(err, service.ErrTooManyLoginAttempts):
+		c.JSON(http.StatusTooManyRequests, gin.H{"message": "登录失败次数过多，请稍后再试"})
+	case errors.Is(err, service.ErrLoginIPNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"message": "不允许从当前 IP 登录"})
+	default:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "认证服务暂不可用"})
+	}
+}
+
+// writeLoginLog 写入登录日志；userID 未知时按用户名查找
+func writeLoginLog(c *gin.Context, userID uint, username, result, reason string, mfaUsed bool) {
+	if userID == 0 {
+		if u, err := mysql.GetUserByUsername(username); err == nil {
+			userID = u.ID
+		}
+	}
+	service.RecordLoginLog(&model.LoginLog{
+		UserID:    userID,
+		Username:  username,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Result:    result,
+		Reason:    reason,
+		MFAUsed:   mfaUsed,
+	})
+}
+
+// issueLoginToken 签发正式 token 并返回登录结果
+func issueLoginToken(c *gin.Context, user *model.User, mfaUsed bool) {
+	tokens, ok := loginTokens(c, user, mfaUsed)
+	if !ok {
 		return
 	}
+	c.JSON(http.StatusOK, LoginResponse{
+		TokenPair: *tokens,
+		User:      *user,
+	})
+}
 
-	token, err := utils.GenerateToken(user.ID, user.Username, user.IsAdmin)
+// loginTokens 签发访问令牌和刷新令牌并记录登录信息，失败时已写入响应
+func loginTokens(c *gin.Context, user *model.User, mfaUsed bool) (*service.TokenPair, bool) {
+	tokens, err := service.IssueTokens(user, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
+		logrus.WithField("username", user.Username).WithError(err).Error("生成 token 失败")
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "生成 token 失败"})
-		return
+		return nil, false
 	}
 
 	// 更新登录信息
-	updateQuery := `UPDATE users SET last_login_at = ?, last_login_ip = ? WHERE id = ?`
-	_, err = mysql.DB().Exec(updateQuery, time.Now(), c.ClientIP(), user.ID)
-	if err != nil {
+	if err := mysql.UpdateUserLogin(user.ID, c.ClientIP()); err != nil {
 		logrus.WithField("username", user.Username).Error("更新登录信息失败")
 		// 不返回错误，因为登录已经成功
 	}
+	service.RecordLoginSuccess(user.ID, c.ClientIP())
+	writeLoginLog(c, user.ID, user.Username, model.LoginResultSuccess, "", mfaUsed)
 
 	logrus.WithFields(logrus.Fields{
 		"username": user.Username,
 		"ip":       c.ClientIP(),
 	}).Info("登录成功")
+	return tokens, true
+}
 
-	c.JSON(http.StatusOK, LoginResponse{
-		Token: token,
-		User:  user,
-	})
+// RefreshToken 用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+// POST /api/v1/token/refresh {"refresh_token":"..."}
+func RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "参数错误"})
+		return
+	}
+
+	tokens, err := service.RefreshTokens(req.RefreshToken, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"message": "账号已被禁用"})
+		case errors.Is(err, service.ErrLoginIPNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"message": "不允许从当前 IP 登录"})
+		case errors.Is(err, service.ErrInvalidRefreshToken):
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "refresh token 无效或已过期，请重新登录"})
+		default:
+			logrus.WithError(err).Error("刷新 token 失败")
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "刷新 token 失败"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout 退出当前登录，当前访问令牌和刷新令牌立即失效
+// POST /api/v1/logout
+func Logout(c *gin.Context) {
+	claims := middleware.CurrentClaims(c)
+	if err := service.Logout(claims); err != nil {
+		logrus.WithField("username", claims.Username).WithError(err).Error("退出登录失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "退出登录失败"})
+		return
+	}
+	logrus.WithField("username", claims.Username).Info("退出登录")
+	c.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
+}
+
+// LogoutAll 退出当前用户的所有会话（所有设备上的令牌全部失效）
+// POST /api/v1/logout/all
+func LogoutAll(c *gin.Context) {
+	userID, username, _ := middleware.CurrentUser(c)
+	if err := service.RevokeUserTokens(userID, "logout all"); err != nil {
+		logrus.WithField("username", username).WithError(err).Error("退出所有会话失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "退出所有会话失败"})
+		return
+	}
+	logrus.WithField("username", username).Info("退出所有会话")
+	c.JSON(http.StatusOK, gin.H{"message": "已退出所有会话"})
 }
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/middleware"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ListCommandRulesHandler 查询命令拦截规则
+// GET /api/v1/command-rules
+func ListCommandRulesHandler(c *gin.Context) {
+	rules, err := mysql.ListCommandRules()
+	if err != nil {
+		zap.L().Error("Failed to list command rules", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list command rules"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// CreateCommandRuleHandler 新增命令拦截规则
+// POST /api/v1/command-rules
+func CreateCommandRuleHandler(c *gin.Context) {
+	rule := model.CommandRule{Enabled: true}
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if err := service.ValidateCommandRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_RULE"})
+		return
+	}
+
+	_, username, _ := middleware.CurrentUser(c)
+	rule.CreatedBy = username
+	if err := mysql.CreateCommandRule(&rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create command rule"})
+		return
+	}
+	service.DefaultCommandPolicy.Invalidate()
+
+	zap.L().Info("Command rule created", zap.Int64("id", rule.ID), zap.String("name", rule.Name), zap.String("by", username))
+	c.JSON(http.StatusOK, rule)
+}
+
+// UpdateCommandRuleHandler 修改命令拦截规则
+// PUT /api/v1/command-rules/{id}
+func UpdateCommandRuleHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule id", "code": "INVALID_PARAMETER"})
+		return
+	}
+
+	var rule model.CommandRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if err := service.ValidateCommandRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_RULE"})
+		return
+	}
+
+	if old, err := mysql.GetCommandRule(id); err == nil {
+		middleware.AuditBefore(c, old)
+	}
+	rule.ID = id
+	if err := mysql.UpdateCommandRule(&rule); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "command rule not found", "code": "RULE_NOT_FOUND"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update command rule"})
+		return
+	}
+	service.DefaultCommandPolicy.Invalidate()
+
+	_, username, _ := middleware.CurrentUser(c)
+	zap.L().Info("Command rule updated", zap.Int64("id", id), zap.String("by", username))
+	c.JSON(http.StatusOK, gin.H{"message": "command rule updated"})
+}
+
+// DeleteCommandRuleHandler 删除命令拦截规则
+// DELETE /api/v1/command-rules/{id}
+func DeleteCommandRuleHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule id", "code": "INVALID_PARAMETER"})
+		return
+	}
+
+	if old, err := mysql.GetCommandRule(id); err == nil {
+		middleware.AuditBefore(c, old)
+	}
+	if err := mysql.DeleteCommandRule(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "command rule not found", "code": "RULE_NOT_FOUND"})
+			return
+		}
+		zap.L().Error("Failed to delete command rule", zap.Int64("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete command rule"})
+		return
+	}
+	service.DefaultCommandPolicy.Invalidate()
+
+	_, username, _ := middleware.CurrentUser(c)
+	zap.L().Info("Command rule deleted", zap.Int64("id", id), zap.String("by", username))
+	c.JSON(http.StatusOK, gin.H{"message": "command rule deleted"})
+}
+
+// ListCommandApprovalsHandler 查询命令审批单，默认只返回待审批
+// GET /api/v1/command-approvals?status=pending
+func ListCommandApprovalsHandler(c *gin.Context) {
+	approvals, err := mysql.ListCommandApprovals(c.DefaultQuery("status", model.ApprovalPending))
+	if err != nil {
+		zap.L().Error("Failed to list command approvals", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list command approvals"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"approvals": approvals})
+}
+
+// ApproveCommandHandler 通过命令审批
+// POST /api/v1/command-approvals/{id}/approve
+func ApproveCommandHandler(c *gin.Context) {
+	decideCommand(c, true)
+}
+
+// RejectCommandHandler 拒绝命令审批
+// POST /api/v1/command-approvals/{id}/reject
+func RejectCommandHandler(c *gin.Context) {
+	decideCommand(c, false)
+}
+
+func decideCommand(c *gin.Context, approve bool) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	// reason 可选，允许空 body
+	_ = c.ShouldBindJSON(&req)
+
+	userID, username, _ := middleware.CurrentUser(c)
+	err := service.DefaultCommandPolicy.Decide(c.Param("id"), userID, approve, req.Reason)
+	if err != nil {
+		if errors.Is(err, service.ErrApprovalNotPending) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "APPROVAL_NOT_PENDING"})
+			return
+		}
+		zap.L().Warn("Failed to decide command approval",
+			zap.String("approval_id", c.Param("id")),
+			zap.String("by", username),
+			zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "APPROVAL_FAILED"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "approval decided"})
+}
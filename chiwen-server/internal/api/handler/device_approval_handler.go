@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/middleware"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
@@ -45,6 +46,10 @@ func RejectApplyHandler(c *gin.Context) {
 		return
 	}
 
+	middleware.AuditResource(c, "register_apply", req.ID)
+	middleware.AuditBefore(c, apply)
+	middleware.AuditAfter(c, gin.H{"apply_status": "rejected"})
+
 	if apply.ApplyStatus != "pending" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "apply is not pending"})
 		return
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/chiwen/server/internal/service"
@@ -12,6 +13,7 @@ import (
 type HeartbeatRequest struct {
 	ID        string                 `json:"id" binding:"required"`        // 机器ID
 	Timestamp int64                  `json:"timestamp" binding:"required"` // 秒级时间戳
+	Nonce     string                 `json:"nonce"`                        // 防重放随机串，旧版 Agent 不带
 	Metrics   map[string]interface{} `json:"metrics" binding:"required"`   // 动态 + 静态信息
 	Signature string                 `json:"signature" binding:"required"` // 用 agent_secret_key 签名
 }
@@ -34,11 +36,36 @@ func HeartbeatHandler(c *gin.Context) {
 		zap.Int("metrics_size", len(req.Metrics)))
 
 	// 调用 Service 层处理
-	if err := service.ProcessHeartbeat(req.ID, req.Timestamp, req.Metrics, req.Signature); err != nil {
+	if err := service.ProcessHeartbeat(req.ID, req.Timestamp, req.Nonce, req.Metrics, req.Signature); err != nil {
 		zap.L().Error("Process heartbeat failed",
 			zap.String("id", req.ID),
 			zap.Error(err))
 
+		if errors.Is(err, service.ErrAgentRevoked) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": err.Error(),
+				"id":    req.ID,
+				"code":  "AGENT_REVOKED",
+			})
+			return
+		}
+		if errors.Is(err, service.ErrAgentClockSkew) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+				"id":    req.ID,
+				"code":  "CLOCK_SKEW",
+			})
+			return
+		}
+		if errors.Is(err, service.ErrAgentReplay) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+				"id":    req.ID,
+				"code":  "REPLAYED",
+			})
+			return
+		}
+
 		// 返回详细的错误信息
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/middleware"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ListHostAccountsHandler 查询资产上的主机账号，普通用户只能看到授权规则允许且自己可用的账号
+// GET /api/v1/assets/{id}/accounts
+func ListHostAccountsHandler(c *gin.Context) {
+	accounts, err := mysql.ListHostAccounts(c.Param("id"))
+	if err != nil {
+		zap.L().Error("Failed to list host accounts", zap.String("asset_id", c.Param("id")), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list host accounts"})
+		return
+	}
+
+	userID, _, isAdmin := middleware.CurrentUser(c)
+	if !isAdmin {
+		grant := service.NewAccessGrant(userID, false)
+		asset, err := mysql.GetAssetByID(c.Param("id"))
+		if err != nil || service.CheckAssetAccess(grant, asset) != nil {
+			// 未被授权访问该资产的用户看不到任何账号
+			accounts = []model.HostAccount{}
+		} else {
+			accounts = service.AllowedHostAccounts(accounts, grant)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+// CreateHostAccountHandler 新增主机账号
+// POST /api/v1/assets/{id}/accounts
+func CreateHostAccountHandler(c *gin.Context) {
+	assetID := c.Param("id")
+	if _, err := mysql.GetAssetByID(assetID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "asset not found", "code": "ASSET_NOT_FOUND"})
+		return
+	}
+
+	account := model.HostAccount{Enabled: true}
+	if err := c.ShouldBindJSON(&account); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if err := service.ValidateHostAccount(&account); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_ACCOUNT"})
+		return
+	}
+
+	_, username, _ := middleware.CurrentUser(c)
+	account.AssetID = assetID
+	account.CreatedBy = username
+	if err := mysql.CreateHostAccount(&account); err != nil {
+		if mysql.IsDuplicateEntry(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "host account already exists", "code": "ACCOUNT_EXISTS"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create host account"})
+		return
+	}
+
+	zap.L().Info("Host account created",
+		zap.String("asset_id", assetID),
+		zap.String("os_username", account.OSUsername),
+		zap.String("by", username))
+	c.JSON(http.StatusOK, account)
+}
+
+// UpdateHostAccountHandler 修改主机账号
+// PUT /api/v1/assets/{id}/accounts/{account_id}
+func UpdateHostAccountHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("account_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account id", "code": "INVALID_PARAMETER"})
+		return
+	}
+
+	var account model.HostAccount
+	if err := c.ShouldBindJSON(&account); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if err := service.ValidateHostAccount(&account); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_ACCOUNT"})
+		return
+	}
+
+	if old, err := mysql.GetHostAccount(id); err == nil {
+		middleware.AuditBefore(c, old)
+	}
+	account.ID = id
+	account.AssetID = c.Param("id")
+	if err := mysql.UpdateHostAccount(&account); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "host account not found", "code": "ACCOUNT_NOT_FOUND"})
+		case mysql.IsDuplicateEntry(err):
+			c.JSON(http.StatusConflict, gin.H{"error": "host account already exists", "code": "ACCOUNT_EXISTS"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update host account"})
+		}
+		return
+	}
+
+	_, username, _ := middleware.CurrentUser(c)
+	zap.L().Info("Host account updated", zap.Int64("id", id), zap.String("by", username))
+	c.JSON(http.StatusOK, gin.H{"message": "host account updated"})
+}
+
+// DeleteHostAccountHandler 删除主机账号（不影响已建立的会话）
+// DELETE /api/v1/assets/{id}/accounts/{account_id}
+func DeleteHostAccountHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("account_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account id", "code": "INVALID_PARAMETER"})
+		return
+	}
+
+	if old, err := mysql.GetHostAccount(id); err == nil {
+		middleware.AuditBefore(c, old)
+	}
+	if err := mysql.DeleteHostAccount(c.Param("id"), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "host account not found", "code": "ACCOUNT_NOT_FOUND"})
+			return
+		}
+		zap.L().Error("Failed to delete host account", zap.Int64("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete host account"})
+		return
+	}
+
+	_, username, _ := middleware.CurrentUser(c)
+	zap.L().Info("Host account deleted", zap.Int64("id", id), zap.String("by", username))
+	c.JSON(http.StatusOK, gin.H{"message": "host account deleted"})
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/pkg/middleware"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// parseLoginLogFilter 解析登录日志查询参数，start/end 为 RFC3339 时间
+func parseLoginLogFilter(c *gin.Context) (model.LoginLogFilter, bool) {
+	f := model.LoginLogFilter{
+		Username: c.Query("username"),
+		ClientIP: c.Query("ip"),
+		Result:   c.Query("result"),
+	}
+	f.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	f.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if f.Result != "" && f.Result != model.LoginResultSuccess && f.Result != model.LoginResultFailure {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "result must be success or failure", "code": "INVALID_PARAMETER"})
+		return f, false
+	}
+	for name, dst := range map[string]**time.Time{"start": &f.Start, "end": &f.End} {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + ", expect RFC3339", "code": "INVALID_PARAMETER"})
+			return f, false
+		}
+		*dst = &t
+	}
+	return f, true
+}
+
+// ListLoginLogsHandler 查询登录日志（管理员）
+// GET /api/v1/login-logs?username=xxx&ip=1.2.3.4&result=failure&start=2025-01-01T00:00:00+08:00&end=...&page=1&page_size=20
+func ListLoginLogsHandler(c *gin.Context) {
+	f, ok := parseLoginLogFilter(c)
+	if !ok {
+		return
+	}
+	logs, total, err := service.ListLoginLogs(f)
+	if err != nil {
+		zap.L().Error("Failed to list login logs", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list login logs"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"logs": logs, "total": total})
+}
+
+// ListMyLoginLogsHandler 查询当前用户自己的登录日志
+// GET /api/v1/login-logs/mine
+func ListMyLoginLogsHandler(c *gin.Context) {
+	f, ok := parseLoginLogFilter(c)
+	if !ok {
+		return
+	}
+	f.UserID, _, _ = middleware.CurrentUser(c)
+	f.Username = ""
+	logs, total, err := service.ListLoginLogs(f)
+	if err != nil {
+		zap.L().Error("Failed to list login logs", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list login logs"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"logs": logs, "total": total})
+}
+
+// GetLoginSecurityHandler 查询登录安全设置（管理员）
+// GET /api/v1/settings/login-security
+func GetLoginSecurityHandler(c *gin.Context) {
+	settings, err := service.GetLoginSecurity()
+	if err != nil {
+		zap.L().Error("Failed to get login security settings", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get login security settings"})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateLoginSecurityHandler 修改登录安全设置（管理员）
+// PUT /api/v1/settings/login-security {"max_failures":5,"lockout_minutes":15,"ip_max_failures":20,"ip_window_minutes":15,"ip_allowlist":[]}
+func UpdateLoginSecurityHandler(c *gin.Context) {
+	var settings model.LoginSecurity
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if old, err := service.GetLoginSecurity(); err == nil {
+		middleware.AuditBefore(c, old)
+	}
+	_, username, _ := middleware.CurrentUser(c)
+	if err := service.SaveLoginSecurity(&settings, username, c.ClientIP()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_SETTINGS"})
+		return
+	}
+	zap.L().Info("Login security settings updated", zap.String("by", username))
+	c.JSON(http.StatusOK, settings)
+}
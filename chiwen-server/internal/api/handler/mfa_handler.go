@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/middleware"
+	"github.com/chiwen/server/internal/pkg/utils"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// mfaErrorResponse 把 MFA 的业务错误转换为响应
+func mfaErrorResponse(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": "INVALID_MFA_CODE"})
+	case errors.Is(err, service.ErrMFATooManyAttempts):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "code": "MFA_TOO_MANY_ATTEMPTS"})
+	case errors.Is(err, service.ErrMFANotEnrolled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "MFA_NOT_ENROLLED"})
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "MFA_ALREADY_ENABLED"})
+	case errors.Is(err, service.ErrMFARequiredByPolicy):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "MFA_REQUIRED"})
+	case errors.Is(err, service.ErrAccountLocked):
+		c.JSON(http.StatusLocked, gin.H{"error": err.Error(), "code": "ACCOUNT_LOCKED"})
+	case errors.Is(err, service.ErrTooManyLoginAttempts):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "code": "TOO_MANY_LOGIN_ATTEMPTS"})
+	case errors.Is(err, service.ErrLoginIPNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "LOGIN_IP_NOT_ALLOWED"})
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found", "code": "USER_NOT_FOUND"})
+	default:
+		zap.L().Error("MFA operation failed", zap.String("action", action), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+type mfaCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type mfaLoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code"`
+}
+
+// mfaLoginUser 校验登录第二步的挑战令牌，并重新加载用户确认仍然可用
+func mfaLoginUser(c *gin.Context, req *mfaLoginRequest, purposes ...string) (*model.User, bool) {
+	claims, err := utils.ParseMFAToken(req.MFAToken, purposes...)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token", "code": "INVALID_MFA_TOKEN"})
+		return nil, false
+	}
+	user, err := mysql.GetUserByUsername(claims.Username)
+	if err != nil || user.ID != claims.UserID {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired mfa token", "code": "INVALID_MFA_TOKEN"})
+		return nil, false
+	}
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "user is disabled", "code": "USER_DISABLED"})
+		return nil, false
+	}
+	// 两步之间账号可能已被锁定，来源 IP 也要重新校验
+	if err := service.CheckLoginAllowed(user.Username, c.ClientIP()); err != nil {
+		writeLoginLog(c, user.ID, user.Username, model.LoginResultFailure, err.Error(), true)
+		mfaErrorResponse(c, err, "check login")
+		return nil, false
+	}
+	return user, true
+}
+
+// rejectMFALogin 登录第二步验证失败：验证码错误计入登录失败次数，并记录登录日志
+func rejectMFALogin(c *gin.Context, user *model.User, err error, action string) {
+	if errors.Is(err, service.ErrInvalidMFACode) {
+		service.RecordLoginFailure(user.Username, c.ClientIP())
+	}
+	writeLoginLog(c, user.ID, user.Username, model.LoginResultFailure, err.Error(), true)
+	mfaErrorResponse(c, err, action)
+}
+
+// LoginMFAHandler 登录第二步：提交 TOTP 验证码或恢复码，成功后签发正式 token
+// POST /api/v1/login/mfa {"mfa_token":"...","code":"123456"}
+func LoginMFAHandler(c *gin.Context) {
+	var req mfaLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mfa_token and code are required", "code": "INVALID_PARAMETER"})
+		return
+	}
+	user, ok := mfaLoginUser(c, &req, utils.PurposeMFAVerify)
+	if !ok {
+		return
+	}
+	if err := service.VerifyMFA(user.ID, req.Code); err != nil {
+		rejectMFALogin(c, user, err, "verify mfa")
+		return
+	}
+	issueLoginToken(c, user, true)
+}
+
+// LoginMFAEnrollHandler 策略要求 MFA 但用户尚未绑定时，登录过程中生成绑定信息
+// POST /api/v1/login/mfa/enroll {"mfa_token":"..."}
+func LoginMFAEnrollHandler(c *gin.Context) {
+	var req mfaLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mfa_token is required", "code": "INVALID_PARAMETER"})
+		return
+	}
+	user, ok := mfaLoginUser(c, &req, utils.PurposeMFAEnroll)
+	if !ok {
+		return
+	}
+	enrollment, err := service.StartMFAEnrollment(user.ID, user.Username)
+	if err != nil {
+		mfaErrorResponse(c, err, "start mfa enrollment")
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// LoginMFAActivateHandler 登录过程中提交首个验证码完成绑定，返回恢复码和正式 token
+// POST /api/v1/login/mfa/activate {"mfa_token":"...","code":"123456"}
+func LoginMFAActivateHandler(c *gin.Context) {
+	var req mfaLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mfa_token and code are required", "code": "INVALID_PARAMETER"})
+		return
+	}
+	user, ok := mfaLoginUser(c, &req, utils.PurposeMFAEnroll)
+	if !ok {
+		return
+	}
+	codes, err := service.ActivateMFA(user.ID, req.Code)
+	if err != nil {
+		rejectMFALogin(c, user, err, "activate mfa")
+		return
+	}
+
+	tokens, ok := loginTokens(c, user, true)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":          tokens.AccessToken,
+		"refresh_token":  tokens.RefreshToken,
+		"expires_in":     tokens.ExpiresIn,
+		"user":           user,
+		"recovery_codes": codes,
+	})
+}
+
+// currentMFAUser 当前登录用户（MFA 策略判断只需要 ID 和管理员标记）
+func currentMFAUser(c *gin.Context) *model.User {
+	uid, username, isAdmin := middleware.CurrentUser(c)
+	return &model.User{ID: uid, Username: username, IsAdmin: isAdmin}
+}
+
+// GetMFAStatusHandler 查询当前用户的 MFA 状态
+// GET /api/v1/mfa
+func GetMFAStatusHandler(c *gin.Context) {
+	status, err := service.GetMFAStatus(currentMFAUser(c))
+	if err != nil {
+		mfaErrorResponse(c, err, "get mfa status")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// StartMFAEnrollmentHandler 生成 TOTP 密钥和二维码内容，提交首个验证码后启用
+// POST /api/v1/mfa/enroll
+func StartMFAEnrollmentHandler(c *gin.Context) {
+	user := currentMFAUser(c)
+	enrollment, err := service.StartMFAEnrollment(user.ID, user.Username)
+	if err != nil {
+		mfaErrorResponse(c, err, "start mfa enrollment")
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ActivateMFAHandler 提交首个验证码启用 MFA，恢复码只在这里展示一次
+// POST /api/v1/mfa/activate {"code":"123456"}
+func ActivateMFAHandler(c *gin.Context) {
+	var req mfaCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	user := currentMFAUser(c)
+	codes, err := service.ActivateMFA(user.ID, req.Code)
+	if err != nil {
+		mfaErrorResponse(c, err, "activate mfa")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// RegenerateRecoveryCodesHandler 重新生成恢复码，旧恢复码全部作废
+// POST /api/v1/mfa/recovery-codes {"code":"123456"}
+func RegenerateRecoveryCodesHandler(c *gin.Context) {
+	var req mfaCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	user := currentMFAUser(c)
+	codes, err := service.RegenerateRecoveryCodes(user.ID, req.Code)
+	if err != nil {
+		mfaErrorResponse(c, err, "regenerate recovery codes")
+		return
+	}
+	zap.L().Info("MFA recovery codes regenerated", zap.String("username", user.Username))
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableMFAHandler 关闭当前用户的 MFA，需要验证码
+// DELETE /api/v1/mfa {"code":"123456"}
+func DisableMFAHandler(c *gin.Context) {
+	var req mfaCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if err := service.DisableMFA(currentMFAUser(c), req.Code); err != nil {
+		mfaErrorResponse(c, err, "disable mfa")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "mfa disabled"})
+}
+
+// GetMFAPolicyHandler 查询 MFA 策略（管理员）
+// GET /api/v1/mfa/policy
+func GetMFAPolicyHandler(c *gin.Context) {
+	policy, err := service.GetMFAPolicy()
+	if err != nil {
+		mfaErrorResponse(c, err, "get mfa policy")
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpdateMFAPolicyHandler 修改 MFA 策略（管理员）
+// PUT /api/v1/mfa/policy {"mode":"sensitive","sensitive_labels":{"env":"prod"}}
+func UpdateMFAPolicyHandler(c *gin.Context) {
+	var policy model.MFAPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if old, err := service.GetMFAPolicy(); err == nil {
+		middleware.AuditBefore(c, old)
+	}
+	_, username, _ := middleware.CurrentUser(c)
+	if err := service.SaveMFAPolicy(&policy, username); err != nil {
+		if errors.Is(err, service.ErrInvalidMFAPolicy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_MFA_POLICY"})
+			return
+		}
+		mfaErrorResponse(c, err, "update mfa policy")
+		return
+	}
+	zap.L().Info("MFA policy updated", zap.String("mode", policy.Mode), zap.String("by", username))
+	c.JSON(http.StatusOK, policy)
+}
+
+// ResetUserMFAHandler 管理员重置用户的 MFA（用户丢失验证器和恢复码时使用）；目标用户带有角色时还需要 role:manage
+// DELETE /api/v1/users/{id}/mfa
+func ResetUserMFAHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	hasRoles, err := mysql.UserHasRoles(id)
+	if err != nil {
+		mfaErrorResponse(c, err, "get user roles")
+		return
+	}
+	if forbidRoleEscalation(c, hasRoles) {
+		return
+	}
+	if err := service.ResetUserMFA(id); err != nil {
+		mfaErrorResponse(c, err, "reset user mfa")
+		return
+	}
+	_, username, _ := middleware.CurrentUser(c)
+	zap.L().Warn("User MFA reset by admin", zap.Uint("user_id", id), zap.String("by", username))
+	c.JSON(http.StatusOK, gin.H{"message": "user mfa reset"})
+}
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/middleware"
 	"github.com/chiwen/server/internal/service"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 // RegisterRequest 客户端请求结构体
@@ -39,6 +43,55 @@ func RegisterHandler(c *gin.Context) {
 	})
 }
 
+// ReenrollRequest Agent 重新注册请求：old_signature 用已登记的私钥签名，new_signature 用新私钥签名，
+// 签名内容均为 reenroll|id|nonce|timestamp|new_public_key
+type ReenrollRequest struct {
+	ID           string `json:"id" binding:"required"`
+	Nonce        string `json:"nonce" binding:"required"`
+	Timestamp    int64  `json:"timestamp" binding:"required"`
+	NewPublicKey string `json:"new_public_key" binding:"required"`
+	OldSignature string `json:"old_signature" binding:"required"`
+	NewSignature string `json:"new_signature" binding:"required"`
+}
+
+// ReenrollHandler Agent 证明持有原私钥后，为同一资产换上新公钥和新密钥，无需重新审批
+// POST /api/v1/register/reenroll
+func ReenrollHandler(c *gin.Context) {
+	var req ReenrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+
+	encryptedSecret, err := service.Reenroll(req.ID, req.Nonce, req.Timestamp, req.NewPublicKey, req.OldSignature, req.NewSignature)
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrAssetNotEnrolled):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "ASSET_NOT_FOUND"})
+		return
+	case errors.Is(err, service.ErrReenrollSignature):
+		zap.L().Warn("Agent re-enrollment rejected", zap.String("asset_id", req.ID), zap.String("ip", c.ClientIP()), zap.Error(err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": "INVALID_SIGNATURE"})
+		return
+	case errors.Is(err, service.ErrAgentRevoked):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "AGENT_REVOKED"})
+		return
+	case errors.Is(err, service.ErrReenrollStale):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "STALE_REQUEST"})
+		return
+	default:
+		zap.L().Error("Agent re-enrollment failed", zap.String("asset_id", req.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "re-enrollment failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":           "approved",
+		"apply_id":         req.ID,
+		"encrypted_secret": encryptedSecret,
+	})
+}
+
 // ApproveRequest 是客户端向服务端发送审批请求时的 JSON 结构体
 type ApproveRequest struct {
 	ID string `json:"id" binding:"required"` // 客户端申请的唯一 ID（UUID 或其他唯一标识），必填
@@ -55,6 +108,12 @@ func ApproveHandler(c *gin.Context) {
 		return
 	}
 
+	middleware.AuditResource(c, "register_apply", req.ID)
+	if apply, err := mysql.GetApplyByClientID(req.ID); err == nil && apply != nil {
+		middleware.AuditBefore(c, apply)
+		middleware.AuditAfter(c, gin.H{"apply_status": "approved"})
+	}
+
 	// 获取 Agent 的真实 IP（Gin 框架推荐方式）
 	agentIP := c.ClientIP() // 自动处理 X-Forwarded-For、X-Real-IP 等，优先级最高
 
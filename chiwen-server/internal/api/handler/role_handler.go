@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/middleware"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// roleErrorResponse 把角色操作的错误转换为响应
+func roleErrorResponse(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "role not found", "code": "ROLE_NOT_FOUND"})
+	case errors.Is(err, service.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_ROLE"})
+	case errors.Is(err, service.ErrBuiltinRole):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "BUILTIN_ROLE"})
+	case mysql.IsDuplicateEntry(err):
+		c.JSON(http.StatusConflict, gin.H{"error": "role name already exists", "code": "ROLE_EXISTS"})
+	default:
+		zap.L().Error("Role management failed", zap.String("action", action), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+// ListPermissionsHandler 查询系统支持的全部权限点
+// GET /api/v1/permissions
+func ListPermissionsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"permissions": model.Permissions})
+}
+
+// MyPermissionsHandler 查询当前用户（或当前 API 令牌）生效的权限点，前端据此显示菜单和按钮
+// GET /api/v1/permissions/mine
+func MyPermissionsHandler(c *gin.Context) {
+	_, _, isAdmin := middleware.CurrentUser(c)
+	perms := []string{}
+	for _, p := range model.Permissions {
+		if middleware.HasPermission(c, p.Name) {
+			perms = append(perms, p.Name)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"permissions": perms, "is_admin": isAdmin})
+}
+
+// ListRolesHandler 查询角色
+// GET /api/v1/roles
+func ListRolesHandler(c *gin.Context) {
+	roles, err := mysql.ListRoles()
+	if err != nil {
+		roleErrorResponse(c, err, "list roles")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// CreateRoleHandler 新增角色
+// POST /api/v1/roles {"name":"dba","description":"","permissions":["asset:read","tty:connect"]}
+func CreateRoleHandler(c *gin.Context) {
+	var role model.Role
+	if err := c.ShouldBindJSON(&role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	role.Builtin = false
+	if err := service.CreateRole(&role); err != nil {
+		roleErrorResponse(c, err, "create role")
+		return
+	}
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("Role created", zap.Uint("id", role.ID), zap.String("name", role.Name), zap.String("by", operator))
+	c.JSON(http.StatusOK, role)
+}
+
+// UpdateRoleHandler 修改角色，内置角色不能改名
+// PUT /api/v1/roles/{id}
+func UpdateRoleHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var role model.Role
+	if err := c.ShouldBindJSON(&role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+
+	old, err := mysql.GetRole(id)
+	if err != nil {
+		roleErrorResponse(c, err, "get role")
+		return
+	}
+	middleware.AuditBefore(c, old)
+	role.ID = id
+	if err := service.UpdateRole(&role); err != nil {
+		roleErrorResponse(c, err, "update role")
+		return
+	}
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("Role updated", zap.Uint("id", id), zap.Strings("permissions", role.Permissions), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "role updated"})
+}
+
+// DeleteRoleHandler 删除角色及其分配关系，内置角色不能删除
+// DELETE /api/v1/roles/{id}
+func DeleteRoleHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	if old, err := mysql.GetRole(id); err == nil {
+		middleware.AuditBefore(c, old)
+	}
+	if err := service.DeleteRole(id); err != nil {
+		roleErrorResponse(c, err, "delete role")
+		return
+	}
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("Role deleted", zap.Uint("id", id), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "role deleted"})
+}
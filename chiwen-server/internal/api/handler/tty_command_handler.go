@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/pkg/middleware"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// parseTimeQuery 解析时间查询参数，支持 RFC3339 和 Unix 秒级时间戳
+func parseTimeQuery(c *gin.Context, key string) (*time.Time, bool) {
+	v := c.Query(key)
+	if v == "" {
+		return nil, true
+	}
+	if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+		t := time.Unix(ts, 0)
+		return &t, true
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, true
+	}
+	return nil, false
+}
+
+// SearchCommands 搜索会话中执行过的命令（普通用户只能搜索自己的命令）
+// GET /api/v1/tty/commands?asset_id=xxx&user_id=xxx&from=xxx&to=xxx&q=xxx&regex=xxx&page=1&page_size=50
+func (h *TTYHandler) SearchCommands(c *gin.Context) {
+	filter := model.TTYCommandFilter{
+		AssetID: c.Query("asset_id"),
+		UserID:  c.Query("user_id"),
+		Keyword: c.Query("q"),
+		Regex:   c.Query("regex"),
+	}
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+	var ok bool
+	if filter.From, ok = parseTimeQuery(c, "from"); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from", "code": "INVALID_PARAMETER"})
+		return
+	}
+	if filter.To, ok = parseTimeQuery(c, "to"); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to", "code": "INVALID_PARAMETER"})
+		return
+	}
+
+	// 没有 session:audit 权限只能查看自己的
+	if !middleware.HasPermission(c, model.PermSessionAudit) {
+		uid, _, _ := middleware.CurrentUser(c)
+		filter.UserID = strconv.FormatUint(uint64(uid), 10)
+	}
+
+	commands, total, err := h.ttyService.SearchCommands(filter)
+	if err != nil {
+		zap.L().Warn("Failed to search tty commands", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "SEARCH_FAILED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"commands": commands,
+		"total":    total,
+	})
+}
+
+// ReindexSessionCommands 重新从录像中提取会话命令（管理员）
+// POST /api/v1/tty/sessions/{id}/commands/reindex
+func (h *TTYHandler) ReindexSessionCommands(c *gin.Context) {
+	sessionID := c.Param("id")
+	if err := service.IndexSessionCommands(sessionID); err != nil {
+		zap.L().Warn("Failed to reindex session commands",
+			zap.String("session_id", sessionID),
+			zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "REINDEX_FAILED",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "session commands reindexed"})
+}
@@ -0,0 +1,172 @@
+// internal/api/handler/tty_guard.go
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/pkg/cmdline"
+	"github.com/chiwen/server/internal/service"
+	"go.uber.org/zap"
+)
+
+const keyCtrlC = 0x03
+
+// approvalWaitGrace 审批超时后再多等的时间，超过后本地放弃等待，防止过期通知丢失导致会话一直卡住
+const approvalWaitGrace = 30 * time.Second
+
+// commandGuard 在浏览器 → Agent 的输入链路上还原命令行，回车时按命令规则放行、拦截或等待审批。
+// 协同输入时所有参与者共用同一行（与 PTY 一致），规则检查和审批按按下回车的用户进行
+type commandGuard struct {
+	sessionID string
+	assetID   string
+	policy    *service.CommandPolicy
+
+	sendAgent func(data []byte) // 把输入转发给 Agent
+	notify    func(msg string)  // 向浏览器终端输出提示
+
+	mu        sync.Mutex
+	editor    cmdline.Editor
+	pendingID string                            // 等待审批的审批单ID
+	subjects  map[string]*service.PolicySubject // 用户ID → 策略主体，首次输入时解析
+}
+
+func newCommandGuard(sessionID, assetID string, sendAgent func([]byte), notify func(string)) *commandGuard {
+	return &commandGuard{
+		sessionID: sessionID,
+		assetID:   assetID,
+		policy:    service.DefaultCommandPolicy,
+		sendAgent: sendAgent,
+		notify:    notify,
+		subjects:  make(map[string]*service.PolicySubject),
+	}
+}
+
+// subject 返回输入用户的策略主体，调用方需持有 g.mu
+func (g *commandGuard) subject(userID string) *service.PolicySubject {
+	s, ok := g.subjects[userID]
+	if !ok {
+		s = service.NewPolicySubject(g.sessionID, g.assetID, userID)
+		g.subjects[userID] = s
+	}
+	return s
+}
+
+// HandleInput 处理 userID 发来的一帧浏览器输入
+func (g *commandGuard) HandleInput(userID string, data []byte) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	subject := g.subject(userID)
+
+	// 等待审批期间只响应 Ctrl-C（放弃执行），其余输入丢弃
+	if g.pendingID != "" {
+		if bytes.IndexByte(data, keyCtrlC) >= 0 {
+			g.policy.CancelApproval(g.pendingID)
+		}
+		return
+	}
+
+	stopped := false
+	g.editor.Feed(data, func(line cmdline.Line, offset int) bool {
+		if line.Text == "" && !line.Partial {
+			return true
+		}
+		decision := g.policy.Check(subject, line.Text, line.Partial)
+		if decision.Rule == nil {
+			return true
+		}
+
+		stopped = true
+		// 回车之前的内容照常转发（包括同一帧中已放行的命令），回车本身被扣下
+		if offset > 0 {
+			g.sendAgent(data[:offset])
+		}
+
+		switch decision.Action {
+		case model.CommandActionDeny:
+			g.sendAgent([]byte{keyCtrlC})
+			if line.Partial {
+				g.notify(fmt.Sprintf("命令行包含无法还原的编辑（方向键、Tab 补全、历史命令等），受命令规则（%s）约束的会话中请完整输入命令", decision.Rule.Name))
+			} else {
+				g.notify(fmt.Sprintf("命令已被拦截（规则：%s）", decision.Rule.Name))
+			}
+			zap.L().Warn("Command blocked by policy",
+				zap.String("session_id", subject.SessionID),
+				zap.String("user_id", subject.UserID),
+				zap.String("asset_id", subject.AssetID),
+				zap.Int64("rule_id", decision.Rule.ID),
+				zap.String("command", line.Text),
+				zap.Bool("partial", line.Partial))
+
+		case model.CommandActionConfirm:
+			g.requestApproval(subject, decision.Rule, line.Text)
+		}
+		return false
+	})
+
+	if !stopped {
+		g.sendAgent(data)
+	}
+}
+
+// requestApproval 创建审批单并在后台等待结果，调用方需持有 g.mu
+func (g *commandGuard) requestApproval(subject *service.PolicySubject, rule *model.CommandRule, command string) {
+	approval, result, err := g.policy.RequestApproval(subject, rule, command)
+	if err != nil {
+		zap.L().Error("Failed to create command approval",
+			zap.String("session_id", subject.SessionID),
+			zap.Error(err))
+		g.sendAgent([]byte{keyCtrlC})
+		g.notify("命令需要审批，但创建审批单失败，已取消执行")
+		return
+	}
+
+	g.pendingID = approval.ID
+	g.notify(fmt.Sprintf("命令需要审批（规则：%s，审批单：%s），等待审批中，按 Ctrl-C 放弃执行", rule.Name, approval.ID))
+
+	go func() {
+		var status string
+		select {
+		case status = <-result:
+		case <-time.After(service.ApprovalTimeout() + approvalWaitGrace):
+			g.policy.Forget(approval.ID)
+			status = model.ApprovalExpired
+			zap.L().Warn("Command approval wait timed out locally",
+				zap.String("approval_id", approval.ID),
+				zap.String("session_id", subject.SessionID))
+		}
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.pendingID != approval.ID {
+			return
+		}
+		g.pendingID = ""
+
+		switch status {
+		case model.ApprovalApproved:
+			g.notify("命令审批已通过，开始执行")
+			g.sendAgent([]byte{'\r'})
+		case model.ApprovalExpired:
+			g.sendAgent([]byte{keyCtrlC})
+			g.notify("命令审批超时，已取消执行")
+		default:
+			g.sendAgent([]byte{keyCtrlC})
+			g.notify("命令审批被拒绝或已取消")
+		}
+	}()
+}
+
+// Close 会话结束时取消尚未处理的审批单
+func (g *commandGuard) Close() {
+	g.mu.Lock()
+	pending := g.pendingID
+	g.pendingID = ""
+	g.mu.Unlock()
+	if pending != "" {
+		g.policy.CancelApproval(pending)
+	}
+}
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/pkg/middleware"
 	"github.com/chiwen/server/internal/service"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -91,7 +95,7 @@ func (h *TTYHandler) ValidateToken(c *gin.Context) {
 }
 
 // AuthorizeTTY 授权TTY访问
-// GET /api/v1/assets/{id}/tty/authorize
+// GET /api/v1/assets/{id}/tty/authorize?cols=120&rows=30&account=deploy
 func (h *TTYHandler) AuthorizeTTY(c *gin.Context) {
 	// 1. 获取参数
 	assetID := c.Param("id")
@@ -103,15 +107,10 @@ func (h *TTYHandler) AuthorizeTTY(c *gin.Context) {
 		return
 	}
 
-	// 2. 获取用户ID（这里需要根据你的认证系统实现）
-	// 临时使用查询参数，实际应该从JWT或Session中获取
-	userID := c.Query("user_id")
-	if userID == "" {
-		// 开发阶段：使用默认用户ID
-		userID = "1"
-		zap.L().Warn("Using default user_id for development",
-			zap.String("asset_id", assetID))
-	}
+	// 2. 当前登录用户（AuthRequired 从 JWT 中解析）
+	uid, _, isAdmin := middleware.CurrentUser(c)
+	grant := service.NewAccessGrant(uid, isAdmin)
+	userID := grant.UserIDString()
 
 	// 3. 获取终端尺寸参数
 	cols := 80
@@ -132,8 +131,8 @@ func (h *TTYHandler) AuthorizeTTY(c *gin.Context) {
 	// 4. 获取浏览器IP
 	browserIP := c.ClientIP()
 
-	// 5. 调用业务逻辑
-	tokenInfo, err := h.ttyService.AuthorizeTTY(assetID, userID, browserIP, cols, rows)
+	// 5. 调用业务逻辑（account 为空时自动选择主机账号）
+	tokenInfo, err := h.ttyService.AuthorizeTTY(assetID, grant, c.Query("account"), browserIP, cols, rows)
 	if err != nil {
 		zap.L().Error("TTY authorization failed",
 			zap.String("asset_id", assetID),
@@ -144,6 +143,16 @@ func (h *TTYHandler) AuthorizeTTY(c *gin.Context) {
 		// 根据错误类型返回不同的状态码
 		errMsg := err.Error()
 		switch {
+		case errors.Is(err, service.ErrAgentQuarantined):
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": errMsg,
+				"code":  "AGENT_QUARANTINED",
+			})
+		case errors.Is(err, service.ErrAgentRevoked):
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": errMsg,
+				"code":  "AGENT_REVOKED",
+			})
 		case strings.Contains(errMsg, "not allowed") ||
 			strings.Contains(errMsg, "not in allowed users"):
 			c.JSON(http.StatusForbidden, gin.H{
@@ -185,6 +194,68 @@ func (h *TTYHandler) AuthorizeTTY(c *gin.Context) {
 			"cols":    cols,
 			"rows":    rows,
 			"command": "/bin/bash",
+			"account": tokenInfo.OSAccount,
 		},
 	})
 }
+
+// ListRecordings 查询会话录像列表（普通用户只能看到自己的录像）
+// GET /api/v1/tty/recordings?asset_id=xxx&user_id=xxx&page=1&page_size=20
+func (h *TTYHandler) ListRecordings(c *gin.Context) {
+	filter := model.TTYRecordingFilter{
+		AssetID: c.Query("asset_id"),
+		UserID:  c.Query("user_id"),
+	}
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	// 没有 session:audit 权限只能查看自己的
+	if !middleware.HasPermission(c, model.PermSessionAudit) {
+		uid, _, _ := middleware.CurrentUser(c)
+		filter.UserID = strconv.FormatUint(uint64(uid), 10)
+	}
+
+	recordings, total, err := h.ttyService.ListRecordings(filter)
+	if err != nil {
+		zap.L().Error("Failed to list TTY recordings", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to list recordings",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recordings": recordings,
+		"total":      total,
+	})
+}
+
+// DownloadRecording 下载会话录像（asciicast v2 格式）
+// GET /api/v1/tty/recordings/{id}/download
+func (h *TTYHandler) DownloadRecording(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	ownerID := ""
+	// 没有 session:audit 权限只能查看自己的
+	if !middleware.HasPermission(c, model.PermSessionAudit) {
+		uid, _, _ := middleware.CurrentUser(c)
+		ownerID = strconv.FormatUint(uint64(uid), 10)
+	}
+
+	session, err := h.ttyService.GetRecordingSession(sessionID, ownerID)
+	if err != nil {
+		status := http.StatusNotFound
+		if strings.Contains(err.Error(), "not allowed") {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+			"code":  "RECORDING_UNAVAILABLE",
+		})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-asciicast")
+	c.FileAttachment(session.RecordFile, filepath.Base(session.RecordFile))
+}
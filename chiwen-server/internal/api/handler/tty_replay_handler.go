@@ -0,0 +1,136 @@
+// internal/api/handler/tty_replay_handler.go
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/pkg/asciicast"
+	"github.com/chiwen/server/internal/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// replaySink 把回放事件写回浏览器：
+// 终端输出与 HandleWebSocket 相同，直接以文本帧发送原始数据；resize/status 以 JSON 控制消息发送
+type replaySink struct {
+	conn *websocket.Conn
+}
+
+func (s *replaySink) Output(data string) error {
+	if data == "" {
+		return nil
+	}
+	return s.conn.WriteMessage(websocket.TextMessage, []byte(data))
+}
+
+func (s *replaySink) Resize(cols, rows int) error {
+	return s.conn.WriteJSON(gin.H{"type": "resize", "cols": cols, "rows": rows})
+}
+
+func (s *replaySink) Status(st asciicast.Status) error {
+	return s.conn.WriteJSON(gin.H{"type": "status", "status": st})
+}
+
+// ReplaySession 通过 WebSocket 回放会话录像
+// GET /api/v1/tty/sessions/{id}/replay?access_token=xxx
+//
+// 浏览器发送的控制消息：
+//
+//	{"type":"pause"}
+//	{"type":"play"}
+//	{"type":"seek","time":12.5}   // 跳转到第 12.5 秒
+//	{"type":"speed","speed":2}    // 0.5 ~ 8 倍速
+func (h *TTYHandler) ReplaySession(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	ownerID := ""
+	// 没有 session:audit 权限只能查看自己的
+	if !middleware.HasPermission(c, model.PermSessionAudit) {
+		uid, _, _ := middleware.CurrentUser(c)
+		ownerID = strconv.FormatUint(uint64(uid), 10)
+	}
+
+	session, err := h.ttyService.GetRecordingSession(sessionID, ownerID)
+	if err != nil {
+		status := http.StatusNotFound
+		if strings.Contains(err.Error(), "not allowed") {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+			"code":  "RECORDING_UNAVAILABLE",
+		})
+		return
+	}
+
+	rec, err := asciicast.Open(session.RecordFile)
+	if err != nil {
+		zap.L().Error("Failed to parse recording",
+			zap.String("session_id", sessionID),
+			zap.String("record_file", session.RecordFile),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to load recording",
+			"code":  "RECORDING_INVALID",
+		})
+		return
+	}
+
+	conn, err := browserUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		zap.L().Error("Replay WebSocket 升级失败", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	zap.L().Info("开始回放会话录像",
+		zap.String("session_id", sessionID),
+		zap.String("viewer", c.GetString("username")),
+		zap.Float64("duration", rec.Duration()))
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	player := asciicast.NewPlayer(rec)
+
+	// 浏览器 → Server（控制消息），连接断开时结束回放
+	go func() {
+		defer cancel()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var ctrl struct {
+				Type  string  `json:"type"`
+				Time  float64 `json:"time"`
+				Speed float64 `json:"speed"`
+			}
+			if err := json.Unmarshal(data, &ctrl); err != nil {
+				continue
+			}
+
+			switch ctrl.Type {
+			case "pause":
+				player.Pause()
+			case "play":
+				player.Play()
+			case "seek":
+				player.Seek(ctrl.Time)
+			case "speed":
+				player.SetSpeed(ctrl.Speed)
+			}
+		}
+	}()
+
+	if err := player.Run(ctx, &replaySink{conn: conn}); err != nil && ctx.Err() == nil {
+		zap.L().Warn("会话回放中断", zap.String("session_id", sessionID), zap.Error(err))
+	}
+}
@@ -0,0 +1,220 @@
+// internal/api/handler/tty_session_handler.go
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/chiwen/server/internal/api/agent"
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/middleware"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ListActiveSessions 列出当前在线的终端会话及参与者（管理员）
+// GET /api/v1/tty/sessions/active
+func (h *TTYHandler) ListActiveSessions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"sessions": agent.Sessions.List()})
+}
+
+// SessionMetrics 在线会话的输出缓冲指标（管理员），用于观察慢浏览器造成的积压
+// GET /api/v1/tty/sessions/metrics
+func (h *TTYHandler) SessionMetrics(c *gin.Context) {
+	type sessionMetric struct {
+		ID      string `json:"id"`
+		AssetID string `json:"asset_id"`
+		agent.SessionStats
+	}
+
+	sessions := agent.Sessions.List()
+	metrics := make([]sessionMetric, 0, len(sessions))
+	var totalBuffered int64
+	for _, s := range sessions {
+		metrics = append(metrics, sessionMetric{ID: s.ID, AssetID: s.AssetID, SessionStats: s.SessionStats})
+		totalBuffered += s.BufferedBytes
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions":             metrics,
+		"active_sessions":      len(metrics),
+		"total_buffered_bytes": totalBuffered,
+	})
+}
+
+// sessionAccessErrorResponse 把 service.CheckSessionAccess 的错误转换为响应
+func sessionAccessErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrAgentQuarantined):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "AGENT_QUARANTINED"})
+	case errors.Is(err, service.ErrAgentRevoked):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "AGENT_REVOKED"})
+	case errors.Is(err, service.ErrAssetNotAuthorized), errors.Is(err, service.ErrHostAccountNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "PERMISSION_DENIED"})
+	default:
+		zap.L().Warn("Session access check failed", zap.Error(err))
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "SESSION_ACCESS_DENIED"})
+	}
+}
+
+// JoinSession 加入正在进行的会话（WebSocket，浏览器通过 access_token 查询参数鉴权）
+// GET /api/v1/tty/sessions/{id}/join?mode=watch|collaborate|takeover
+//
+//	watch       只读旁观，需要 session:audit
+//	collaborate 与发起人共同输入，输入同样经过命令拦截（按输入人的规则检查）
+//	takeover    接管输入，期间发起人只读
+//
+// collaborate/takeover 需要 session:collaborate 和 tty:connect，并且加入人自己被授权以会话的主机账号访问该资产
+func (h *TTYHandler) JoinSession(c *gin.Context) {
+	sessionID := c.Param("id")
+	role, ok := agent.ParseJoinRole(c.DefaultQuery("mode", string(agent.RoleWatch)))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be watch, collaborate or takeover", "code": "INVALID_PARAMETER"})
+		return
+	}
+	perms := []string{model.PermSessionAudit}
+	if role != agent.RoleWatch {
+		perms = []string{model.PermSessionCollaborate, model.PermTTYConnect}
+	}
+	for _, perm := range perms {
+		if !middleware.HasPermission(c, perm) {
+			c.JSON(http.StatusForbidden, gin.H{"message": "缺少权限 " + perm, "permission": perm})
+			return
+		}
+	}
+
+	hubSession := agent.Sessions.Get(sessionID)
+	v, ok := relays.Load(sessionID)
+	if hubSession == nil || !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not active", "code": "SESSION_NOT_ACTIVE"})
+		return
+	}
+	userID, username, isAdmin := middleware.CurrentUser(c)
+	if role != agent.RoleWatch {
+		session := v.(*ttyRelay).session
+		if err := service.CheckSessionAccess(session.AssetID, session.OSAccount, service.NewAccessGrant(userID, isAdmin)); err != nil {
+			sessionAccessErrorResponse(c, err)
+			return
+		}
+	}
+
+	rawConn, err := browserUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		zap.L().Error("WebSocket 升级失败", zap.Error(err))
+		return
+	}
+	defer rawConn.Close()
+	conn := &lockedConn{Conn: rawConn}
+	sub := newBrowserSubscriber(c, conn, sessionID)
+
+	err = hubSession.Join(&agent.Participant{
+		Sub:      sub,
+		Role:     role,
+		UserID:   strconv.FormatUint(uint64(userID), 10),
+		Username: username,
+	})
+	if err != nil {
+		conn.WriteJSON(gin.H{"type": "error", "message": "会话已结束"})
+		return
+	}
+
+	zap.L().Info("管理员加入会话",
+		zap.String("session_id", sessionID),
+		zap.String("username", username),
+		zap.String("mode", string(role)))
+
+	hubSession.Notice(fmt.Sprintf("管理员 %s 以 %s 模式加入会话", username, role))
+
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		// 旁观者不能调整终端大小，控制消息直接忽略；watch 模式的输入会被拒绝，直接丢弃
+		if input, _ := sub.decodeBrowserMessage(msgType, data); len(input) > 0 {
+			hubSession.Input(sub, input)
+		}
+	}
+
+	hubSession.Leave(sub)
+	hubSession.Notice(fmt.Sprintf("管理员 %s 已离开会话", username))
+	zap.L().Info("管理员离开会话", zap.String("session_id", sessionID), zap.String("username", username))
+}
+
+// terminateSession 强制结束一个会话：先落库（保留终止人），再通知 Agent 关闭 PTY，最后断开所有浏览器
+func terminateSession(session *model.TTYSession, by string) {
+	mysql.CloseTTYSession(session.ID, "terminated by admin "+by)
+
+	agent.Send(session.AssetID, map[string]interface{}{
+		"type": "close_session", "session_id": session.ID,
+	})
+
+	if hubSession := agent.Sessions.Get(session.ID); hubSession != nil {
+		hubSession.Close(fmt.Sprintf("会话已被管理员 %s 强制终止", by))
+	}
+
+	zap.L().Warn("TTY session terminated by admin",
+		zap.String("session_id", session.ID),
+		zap.String("asset_id", session.AssetID),
+		zap.String("user_id", session.UserID),
+		zap.String("by", by))
+}
+
+// TerminateSession 管理员强制结束会话
+// DELETE /api/v1/tty/sessions/{id}
+func (h *TTYHandler) TerminateSession(c *gin.Context) {
+	session, err := mysql.GetTTYSessionByID(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found", "code": "SESSION_NOT_FOUND"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query session"})
+		return
+	}
+	if session.Status == "closed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "session already closed", "code": "SESSION_CLOSED"})
+		return
+	}
+
+	_, username, _ := middleware.CurrentUser(c)
+	terminateSession(session, username)
+	c.JSON(http.StatusOK, gin.H{"message": "session terminated"})
+}
+
+// TerminateSessions 批量强制结束某个用户和/或某台资产上的所有会话（应急响应）
+// POST /api/v1/tty/sessions/terminate {"user_id":"5","asset_id":"xxx"}
+func (h *TTYHandler) TerminateSessions(c *gin.Context) {
+	var req struct {
+		UserID  string `json:"user_id"`
+		AssetID string `json:"asset_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.UserID == "" && req.AssetID == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id or asset_id is required", "code": "INVALID_PARAMETER"})
+		return
+	}
+
+	sessions, err := mysql.ListActiveTTYSessions(req.UserID, req.AssetID)
+	if err != nil {
+		zap.L().Error("Failed to list active sessions", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query sessions"})
+		return
+	}
+
+	_, username, _ := middleware.CurrentUser(c)
+	ids := make([]string, 0, len(sessions))
+	for i := range sessions {
+		terminateSession(&sessions[i], username)
+		ids = append(ids, sessions[i].ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"terminated":  len(ids),
+		"session_ids": ids,
+	})
+}
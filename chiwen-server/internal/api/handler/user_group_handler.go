@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/middleware"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// userGroupErrorResponse 把用户组操作的错误转换为响应
+func userGroupErrorResponse(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user group not found", "code": "GROUP_NOT_FOUND"})
+	case mysql.IsDuplicateEntry(err):
+		c.JSON(http.StatusConflict, gin.H{"error": "user group name already exists", "code": "GROUP_EXISTS"})
+	default:
+		zap.L().Error("User group management failed", zap.String("action", action), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+// ListUserGroupsHandler 查询用户组
+// GET /api/v1/user-groups
+func ListUserGroupsHandler(c *gin.Context) {
+	groups, err := mysql.ListUserGroups()
+	if err != nil {
+		userGroupErrorResponse(c, err, "list user groups")
+		return
+	}
+	for i := range groups {
+		groups[i].RoleIDs, _ = mysql.GetUserGroupRoleIDs(groups[i].ID)
+	}
+	c.JSON(http.StatusOK, gin.H{"groups": groups})
+}
+
+// CreateUserGroupHandler 新增用户组
+// POST /api/v1/user-groups
+func CreateUserGroupHandler(c *gin.Context) {
+	var group model.UserGroup
+	if err := c.ShouldBindJSON(&group); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if err := mysql.CreateUserGroup(&group); err != nil {
+		userGroupErrorResponse(c, err, "create user group")
+		return
+	}
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("User group created", zap.Uint("id", group.ID), zap.String("name", group.Name), zap.String("by", operator))
+	c.JSON(http.StatusOK, group)
+}
+
+// UpdateUserGroupHandler 修改用户组
+// PUT /api/v1/user-groups/{id}
+func UpdateUserGroupHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var group model.UserGroup
+	if err := c.ShouldBindJSON(&group); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+
+	if old, err := mysql.GetUserGroup(id); err == nil {
+		middleware.AuditBefore(c, old)
+	}
+	group.ID = id
+	if err := mysql.UpdateUserGroup(&group); err != nil {
+		userGroupErrorResponse(c, err, "update user group")
+		return
+	}
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("User group updated", zap.Uint("id", id), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "user group updated"})
+}
+
+// DeleteUserGroupHandler 删除用户组（引用该组的命令规则、授权规则不再匹配该组成员）
+// DELETE /api/v1/user-groups/{id}
+func DeleteUserGroupHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	if old, err := mysql.GetUserGroup(id); err == nil {
+		middleware.AuditBefore(c, old)
+	}
+	if err := mysql.DeleteUserGroup(id); err != nil {
+		userGroupErrorResponse(c, err, "delete user group")
+		return
+	}
+	service.InvalidatePermissions()
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("User group deleted", zap.Uint("id", id), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "user group deleted"})
+}
+
+// ListUserGroupMembersHandler 查询用户组成员
+// GET /api/v1/user-groups/{id}/members
+func ListUserGroupMembersHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, err := mysql.GetUserGroup(id); err != nil {
+		userGroupErrorResponse(c, err, "get user group")
+		return
+	}
+	members, err := mysql.ListUserGroupMembers(id)
+	if err != nil {
+		userGroupErrorResponse(c, err, "list user group members")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// AddUserGroupMembersHandler 添加用户组成员，不存在的用户会被忽略
+// POST /api/v1/user-groups/{id}/members {"user_ids":[1,2]}
+func AddUserGroupMembersHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		UserIDs []uint `json:"user_ids" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if _, err := mysql.GetUserGroup(id); err != nil {
+		userGroupErrorResponse(c, err, "get user group")
+		return
+	}
+	roleIDs, err := mysql.GetUserGroupRoleIDs(id)
+	if err != nil {
+		userGroupErrorResponse(c, err, "get user group roles")
+		return
+	}
+	if forbidRoleEscalation(c, len(roleIDs) > 0) {
+		return
+	}
+
+	added, err := mysql.AddUserGroupMembers(id, req.UserIDs)
+	if err != nil {
+		userGroupErrorResponse(c, err, "add user group members")
+		return
+	}
+	service.InvalidatePermissions()
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("User group members added", zap.Uint("group_id", id), zap.Int64("added", added), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"added": added})
+}
+
+// RemoveUserGroupMemberHandler 移除用户组成员
+// DELETE /api/v1/user-groups/{id}/members/{user_id}
+func RemoveUserGroupMemberHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := parseUintParam(c, "user_id")
+	if !ok {
+		return
+	}
+	if err := mysql.RemoveUserGroupMember(id, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user is not a member of this group", "code": "MEMBER_NOT_FOUND"})
+			return
+		}
+		userGroupErrorResponse(c, err, "remove user group member")
+		return
+	}
+	service.InvalidatePermissions()
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("User group member removed", zap.Uint("group_id", id), zap.Uint("user_id", userID), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "member removed"})
+}
+
+// SetUserGroupRolesHandler 设置用户组的角色（整体替换），组内成员获得这些角色的权限
+// PUT /api/v1/user-groups/{id}/roles {"role_ids":[1,2]}
+func SetUserGroupRolesHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		RoleIDs []uint `json:"role_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if old, err := mysql.GetUserGroupRoleIDs(id); err == nil {
+		middleware.AuditBefore(c, gin.H{"role_ids": old})
+	}
+	if err := service.SetUserGroupRoles(id, req.RoleIDs); err != nil {
+		userGroupErrorResponse(c, err, "set user group roles")
+		return
+	}
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("User group roles updated", zap.Uint("group_id", id), zap.Uints("role_ids", req.RoleIDs), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "user group roles updated"})
+}
@@ -0,0 +1,425 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/middleware"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// parseUintParam 解析路径中的数字ID
+func parseUintParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 32)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name, "code": "INVALID_PARAMETER"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// userErrorResponse 把用户管理的业务错误转换为响应
+func userErrorResponse(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found", "code": "USER_NOT_FOUND"})
+	case errors.Is(err, service.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "LAST_ADMIN"})
+	case errors.Is(err, service.ErrSelfOperation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "SELF_OPERATION"})
+	default:
+		zap.L().Error("User management failed", zap.String("action", action), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+// GuardAdminUsers 拥有 user:manage 权限的非管理员不能操作管理员账号，放在 /users/:id 相关路由上
+func GuardAdminUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, _, isAdmin := middleware.CurrentUser(c); isAdmin || c.Param("id") == "" {
+			c.Next()
+			return
+		}
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.Next()
+			return
+		}
+		if target, err := mysql.GetUserProfile(uint(id)); err == nil && target.IsAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "only admins can manage admin users", "code": "FORBIDDEN"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// forbidGrantAdmin 只有管理员能授予管理员身份
+func forbidGrantAdmin(c *gin.Context, isAdmin bool) bool {
+	if _, _, operatorIsAdmin := middleware.CurrentUser(c); isAdmin && !operatorIsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can grant admin privilege", "code": "FORBIDDEN"})
+		return true
+	}
+	return false
+}
+
+// forbidRoleEscalation 目标用户或用户组带有角色时，操作人还需要 role:manage 权限；
+// 否则持有 user:manage 的用户可以把自己加入带角色的用户组，或重置带角色用户的密码后冒用其身份，绕过角色分配的权限要求
+func forbidRoleEscalation(c *gin.Context, hasRoles bool) bool {
+	if hasRoles && !middleware.HasPermission(c, model.PermRoleManage) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "target holds roles, " + model.PermRoleManage + " is required", "code": "FORBIDDEN"})
+		return true
+	}
+	return false
+}
+
+// ListUsersHandler 分页查询用户
+// GET /api/v1/users?keyword=xxx&is_active=true&page=1&page_size=20
+func ListUsersHandler(c *gin.Context) {
+	filter := model.UserFilter{Keyword: c.Query("keyword")}
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if v := c.Query("is_active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid is_active", "code": "INVALID_PARAMETER"})
+			return
+		}
+		filter.IsActive = &active
+	}
+
+	users, total, err := service.ListUsers(filter)
+	if err != nil {
+		zap.L().Error("Failed to list users", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users, "total": total})
+}
+
+// GetUserHandler 查询用户详情
+// GET /api/v1/users/{id}
+func GetUserHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	user, err := mysql.GetUserProfile(id)
+	if err != nil {
+		userErrorResponse(c, err, "get user")
+		return
+	}
+	user.GroupIDs, _ = mysql.GetUserGroupIDs(id)
+	user.RoleIDs, _ = mysql.GetUserRoleIDs(id)
+	c.JSON(http.StatusOK, user)
+}
+
+// CreateUserRequest 新增用户请求
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Name     string `json:"name" binding:"max=64"`
+	Email    string `json:"email" binding:"omitempty,email,max=128"`
+	Phone    string `json:"phone" binding:"max=32"`
+	IsAdmin  bool   `json:"is_admin"`
+	IsActive *bool  `json:"is_active"` // 默认启用
+}
+
+// CreateUserHandler 新增本地用户
+// POST /api/v1/users
+func CreateUserHandler(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if forbidGrantAdmin(c, req.IsAdmin) {
+		return
+	}
+	if err := service.ValidateUsername(req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_USERNAME"})
+		return
+	}
+	hash, err := service.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PASSWORD"})
+		return
+	}
+
+	user := &model.User{
+		Username:     req.Username,
+		PasswordHash: hash,
+		Name:         sql.NullString{String: req.Name, Valid: true},
+		Email:        sql.NullString{String: req.Email, Valid: true},
+		Phone:        sql.NullString{String: req.Phone, Valid: true},
+		IsActive:     req.IsActive == nil || *req.IsActive,
+		IsAdmin:      req.IsAdmin,
+	}
+	id, err := mysql.CreateUser(user)
+	if err != nil {
+		if mysql.IsDuplicateEntry(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "username already exists", "code": "USER_EXISTS"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("User created", zap.Uint("id", id), zap.String("username", req.Username), zap.String("by", operator))
+
+	profile, err := mysql.GetUserProfile(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"id": id})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// UpdateUserRequest 修改用户请求（用户名不可修改）
+type UpdateUserRequest struct {
+	Name    string `json:"name" binding:"max=64"`
+	Email   string `json:"email" binding:"omitempty,email,max=128"`
+	Phone   string `json:"phone" binding:"max=32"`
+	IsAdmin bool   `json:"is_admin"`
+}
+
+// UpdateUserHandler 修改用户信息
+// PUT /api/v1/users/{id}
+func UpdateUserHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if forbidGrantAdmin(c, req.IsAdmin) {
+		return
+	}
+
+	if old, err := mysql.GetUserProfile(id); err == nil {
+		middleware.AuditBefore(c, old)
+	}
+	if err := service.UpdateUser(id, req.Name, req.Email, req.Phone, req.IsAdmin); err != nil {
+		userErrorResponse(c, err, "update user")
+		return
+	}
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("User updated", zap.Uint("id", id), zap.Bool("is_admin", req.IsAdmin), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "user updated"})
+}
+
+// ResetUserPasswordHandler 管理员重置用户密码
+// POST /api/v1/users/{id}/password {"password":"xxx"}
+func ResetUserPasswordHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	hasRoles, err := mysql.UserHasRoles(id)
+	if err != nil {
+		userErrorResponse(c, err, "get user roles")
+		return
+	}
+	if forbidRoleEscalation(c, hasRoles) {
+		return
+	}
+	hash, err := service.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PASSWORD"})
+		return
+	}
+
+	if err := mysql.UpdateUserPassword(id, hash); err != nil {
+		userErrorResponse(c, err, "reset password")
+		return
+	}
+	// 旧密码可能已泄露，已登录的会话全部失效
+	if err := service.RevokeUserTokens(id, "password reset"); err != nil {
+		userErrorResponse(c, err, "revoke user tokens")
+		return
+	}
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("User password reset", zap.Uint("id", id), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "password reset"})
+}
+
+// SetUserActiveHandler 启用/禁用用户，禁用后无法登录，已签发的令牌立即失效、在线终端会话被强制结束
+// PUT /api/v1/users/{id}/active {"is_active":false}
+func SetUserActiveHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		IsActive *bool `json:"is_active" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+
+	if old, err := mysql.GetUserProfile(id); err == nil {
+		middleware.AuditBefore(c, gin.H{"is_active": old.IsActive})
+	}
+	operatorID, operator, _ := middleware.CurrentUser(c)
+	if err := service.SetUserActive(operatorID, id, *req.IsActive); err != nil {
+		userErrorResponse(c, err, "update user status")
+		return
+	}
+
+	if !*req.IsActive {
+		terminateUserSessions(id, operator)
+	}
+
+	zap.L().Info("User active changed", zap.Uint("id", id), zap.Bool("is_active", *req.IsActive), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "user status updated"})
+}
+
+// RevokeUserTokensHandler 管理员强制吊销用户已签发的全部令牌（用户需重新登录）
+// POST /api/v1/users/{id}/revoke-tokens
+func RevokeUserTokensHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	if err := service.RevokeUserTokens(id, "revoked by admin"); err != nil {
+		userErrorResponse(c, err, "revoke user tokens")
+		return
+	}
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Warn("User tokens revoked by admin", zap.Uint("id", id), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "user tokens revoked"})
+}
+
+// UnlockUserHandler 解除因连续登录失败导致的账号锁定
+// POST /api/v1/users/{id}/unlock
+func UnlockUserHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	if err := mysql.ResetLoginFailures(id); err != nil {
+		userErrorResponse(c, err, "unlock user")
+		return
+	}
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("User unlocked", zap.Uint("id", id), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "user unlocked"})
+}
+
+// SetUserLoginIPsHandler 设置用户的登录 IP 白名单；bind_login_ip 为 true 且白名单为空时，下次登录的 IP 自动绑定
+// PUT /api/v1/users/{id}/login-ips {"login_ips":["10.0.0.0/8"],"bind_login_ip":false}
+func SetUserLoginIPsHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		LoginIPs    model.StringList `json:"login_ips"`
+		BindLoginIP bool             `json:"bind_login_ip"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if err := service.ValidateIPList(req.LoginIPs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_IP"})
+		return
+	}
+	if old, err := mysql.GetUserProfile(id); err == nil {
+		middleware.AuditBefore(c, gin.H{"login_ips": old.LoginIPs, "bind_login_ip": old.BindLoginIP})
+	}
+	if err := mysql.SetUserLoginIPs(id, req.LoginIPs, req.BindLoginIP); err != nil {
+		userErrorResponse(c, err, "update login ips")
+		return
+	}
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("User login ips updated",
+		zap.Uint("id", id),
+		zap.Strings("login_ips", req.LoginIPs),
+		zap.Bool("bind_login_ip", req.BindLoginIP),
+		zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "login ips updated"})
+}
+
+// terminateUserSessions 结束用户所有在线的终端会话
+func terminateUserSessions(userID uint, by string) {
+	sessions, err := mysql.ListActiveTTYSessions(strconv.FormatUint(uint64(userID), 10), "")
+	if err != nil {
+		zap.L().Error("Failed to list user sessions", zap.Uint("user_id", userID), zap.Error(err))
+		return
+	}
+	for i := range sessions {
+		terminateSession(&sessions[i], by)
+	}
+}
+
+// DeleteUserHandler 删除用户
+// DELETE /api/v1/users/{id}
+func DeleteUserHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if old, err := mysql.GetUserProfile(id); err == nil {
+		middleware.AuditBefore(c, old)
+	}
+	operatorID, operator, _ := middleware.CurrentUser(c)
+	if err := service.DeleteUser(operatorID, id); err != nil {
+		userErrorResponse(c, err, "delete user")
+		return
+	}
+	terminateUserSessions(id, operator)
+
+	zap.L().Info("User deleted", zap.Uint("id", id), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "user deleted"})
+}
+
+// SetUserRolesHandler 设置用户的角色（整体替换）
+// PUT /api/v1/users/{id}/roles {"role_ids":[1,2]}
+func SetUserRolesHandler(c *gin.Context) {
+	id, ok := parseUintParam(c, "id")
+	if !ok {
+		return
+	}
+	var req struct {
+		RoleIDs []uint `json:"role_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PARAMETER"})
+		return
+	}
+	if old, err := mysql.GetUserRoleIDs(id); err == nil {
+		middleware.AuditBefore(c, gin.H{"role_ids": old})
+	}
+	if err := service.SetUserRoles(id, req.RoleIDs); err != nil {
+		userErrorResponse(c, err, "set user roles")
+		return
+	}
+
+	_, operator, _ := middleware.CurrentUser(c)
+	zap.L().Info("User roles updated", zap.Uint("id", id), zap.Uints("role_ids", req.RoleIDs), zap.String("by", operator))
+	c.JSON(http.StatusOK, gin.H{"message": "user roles updated"})
+}
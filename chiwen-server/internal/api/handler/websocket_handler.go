@@ -4,14 +4,22 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/chiwen/server/internal/api/agent"
 	"github.com/chiwen/server/internal/data/model"
 	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/asciicast"
+	"github.com/chiwen/server/internal/pkg/frame"
+	"github.com/chiwen/server/internal/pkg/utils"
+	"github.com/chiwen/server/internal/service"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -19,8 +27,139 @@ var browserUpgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
+// lockedConn 串行化对浏览器连接的写操作（gorilla/websocket 不支持并发写）
+type lockedConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+}
+
+// browserWriteTimeout 单次写浏览器的超时时间，避免卡住的浏览器阻塞会话输出队列
+const browserWriteTimeout = 10 * time.Second
+
+func (c *lockedConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Conn.SetWriteDeadline(time.Now().Add(browserWriteTimeout))
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+func (c *lockedConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Conn.SetWriteDeadline(time.Now().Add(browserWriteTimeout))
+	return c.Conn.WriteJSON(v)
+}
+
+// browserSubscriber 把会话输出推送给一个浏览器连接
+type browserSubscriber struct {
+	conn      *lockedConn
+	sessionID string
+	proto     int // 浏览器通过 proto 查询参数声明的协议版本
+
+	// carry 文本帧协议下上一段输出末尾不完整的 UTF-8 字符，PTY 读取常把多字节字符截断；
+	// SendOutput 由所属会话串行调用，无需加锁
+	carry []byte
+}
+
+// newBrowserSubscriber 按浏览器声明的协议版本创建订阅者；声明了 proto 时先回复协商结果
+func newBrowserSubscriber(c *gin.Context, conn *lockedConn, sessionID string) *browserSubscriber {
+	b := &browserSubscriber{conn: conn, sessionID: sessionID, proto: frame.Negotiate(c.Query("proto"))}
+	if c.Query("proto") != "" {
+		conn.WriteJSON(gin.H{"type": "welcome", "session_id": sessionID, "protocol_version": b.proto})
+	}
+	return b
+}
+
+// SendOutput 推送终端输出：新版浏览器使用二进制帧原样传输字节；旧版使用文本帧，
+// 文本帧必须是合法 UTF-8（否则浏览器会断开连接），末尾不完整的字符留到下一次，其余非法字节替换为 U+FFFD
+func (b *browserSubscriber) SendOutput(data []byte) error {
+	if b.proto >= frame.VersionBinary {
+		return b.conn.WriteMessage(websocket.BinaryMessage, frame.Encode(frame.TypeOutput, b.sessionID, data))
+	}
+
+	if len(b.carry) > 0 {
+		data = append(b.carry, data...)
+		b.carry = nil
+	}
+	n := asciicast.CompleteUTF8(data)
+	if n < len(data) {
+		b.carry = append([]byte(nil), data[n:]...)
+	}
+	if n == 0 {
+		return nil
+	}
+	text := data[:n]
+	if !utf8.Valid(text) {
+		text = []byte(strings.ToValidUTF8(string(text), "\uFFFD"))
+	}
+	return b.conn.WriteMessage(websocket.TextMessage, text)
+}
+
+// decodeBrowserMessage 解析浏览器发来的一帧：二进制帧为终端输入；
+// 文本帧若为带 type 字段的 JSON 则是控制消息（返回 ctrlType），否则是旧版的原始输入
+func (b *browserSubscriber) decodeBrowserMessage(msgType int, data []byte) (input []byte, ctrlType string) {
+	if msgType == websocket.BinaryMessage {
+		f, err := frame.Decode(data)
+		if err != nil || f.Type != frame.TypeInput || f.SessionID != b.sessionID {
+			return nil, ""
+		}
+		return f.Payload, ""
+	}
+
+	var ctrl struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(data, &ctrl) == nil && ctrl.Type != "" {
+		return nil, ctrl.Type
+	}
+	return data, ""
+}
+
+// Close 通知浏览器会话结束原因并断开连接
+func (b *browserSubscriber) Close(reason string) {
+	if reason != "" {
+		b.conn.WriteJSON(gin.H{"type": "closed", "reason": reason})
+	}
+	// 关闭帧的 reason 最长 123 字节，超长时只在上面的 JSON 消息里携带
+	closeText := reason
+	if len(closeText) > 123 {
+		closeText = ""
+	}
+	b.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, closeText),
+		time.Now().Add(time.Second))
+	b.conn.Close()
+}
+
+// ttyRelay 一个终端会话在服务端的转发状态，生命周期与会话一致（不随发起人浏览器断线结束）
+type ttyRelay struct {
+	session    *model.TTYSession
+	recorder   *asciicast.Writer
+	agentConn  *agent.Conn
+	hubSession *agent.Session
+	guard      *commandGuard
+}
+
+// relays 在线会话的转发状态，断线恢复时按会话ID查找
+var relays sync.Map // session_id → *ttyRelay
+
+// resumeGracePeriod 浏览器断线后会话保留的时间，默认 2 分钟，配置为负数时不保留
+func resumeGracePeriod() time.Duration {
+	if !viper.IsSet("tty.resume_grace_period") {
+		return 2 * time.Minute
+	}
+	return time.Duration(viper.GetInt("tty.resume_grace_period")) * time.Second
+}
+
 // HandleWebSocket 处理浏览器端的 WebSocket 连接
+// 新建会话：GET /api/v1/tty/ws?token=xxx
+// 断线恢复：GET /api/v1/tty/ws?resume_token=xxx&access_token=发起人的 JWT
 func HandleWebSocket(c *gin.Context) {
+	if resumeToken := c.Query("resume_token"); resumeToken != "" {
+		resumeWebSocket(c, resumeToken)
+		return
+	}
+
 	token := c.Query("token")
 	if token == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "token required"})
@@ -34,7 +173,14 @@ func HandleWebSocket(c *gin.Context) {
 		return
 	}
 
+	// 签发 token 之后资产可能已被隔离或吊销
+	if err := service.CheckAgentTTYAllowed(ttyToken.AssetID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 创建会话记录
+	now := time.Now()
 	session := &model.TTYSession{
 		ID:           uuid.New().String(),
 		AssetID:      ttyToken.AssetID,
@@ -45,8 +191,9 @@ func HandleWebSocket(c *gin.Context) {
 		TerminalCols: ttyToken.TerminalCols,
 		TerminalRows: ttyToken.TerminalRows,
 		BrowserIP:    c.ClientIP(),
-		CreatedAt:    time.Now(),
-		ConnectedAt:  time.Now(),
+		CreatedAt:    now,
+		ConnectedAt:  &now,
+		OSAccount:    ttyToken.OSAccount,
 	}
 
 	if err := mysql.CreateTTYSession(session); err != nil {
@@ -55,19 +202,33 @@ func HandleWebSocket(c *gin.Context) {
 		return
 	}
 
+	// 开启会话录像（审计要求：录像失败则拒绝建立会话）
+	recorder, err := service.StartSessionRecording(session)
+	if err != nil {
+		zap.L().Error("开启会话录像失败", zap.String("session_id", session.ID), zap.Error(err))
+		mysql.CloseTTYSession(session.ID, "start recording failed")
+		c.JSON(500, gin.H{"error": "start recording failed"})
+		return
+	}
+
 	// 升级为 WebSocket
-	conn, err := browserUpgrader.Upgrade(c.Writer, c.Request, nil)
+	rawConn, err := browserUpgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		zap.L().Error("WebSocket 升级失败", zap.Error(err))
+		recorder.Close()
+		mysql.CloseTTYSession(session.ID, "websocket upgrade failed")
 		return
 	}
-	defer conn.Close()
+	defer rawConn.Close()
+	conn := &lockedConn{Conn: rawConn}
 
 	// 查找 Agent 是否在线
-	agentConn, ok := agent.AgentConns[session.AssetID]
+	agentConn, ok := agent.Get(session.AssetID)
 	if !ok {
 		conn.WriteJSON(gin.H{"type": "error", "message": "Agent 当前不在线，请稍后再试"})
 		zap.L().Warn("Agent 不在线", zap.String("asset_id", session.AssetID))
+		recorder.Close()
+		mysql.CloseTTYSession(session.ID, "agent offline")
 		return
 	}
 
@@ -76,6 +237,26 @@ func HandleWebSocket(c *gin.Context) {
 		zap.String("asset_id", session.AssetID),
 		zap.String("user_id", session.UserID))
 
+	relay := &ttyRelay{session: session, recorder: recorder, agentConn: agentConn}
+
+	// 注册到会话中心：Agent 输出经由会话中心写入录像并分发给发起人和旁观者
+	relay.hubSession = agent.Sessions.Open(session.ID, agentConn, session.UserID, func(data []byte) {
+		recorder.WriteOutput(data)
+	})
+
+	// 命令拦截：回车时按命令规则检查，命中 deny/confirm 的命令不会直接送达 Agent
+	relay.guard = newCommandGuard(
+		session.ID, session.AssetID,
+		func(data []byte) {
+			recorder.WriteInput(data)
+			agentConn.SendInput(session.ID, data)
+		},
+		relay.hubSession.Notice,
+	)
+	relay.hubSession.SetInputHandler(relay.guard.HandleInput)
+	relay.hubSession.OnClose(relay.finish)
+	relays.Store(session.ID, relay)
+
 	// 通知 Agent 创建 PTY
 	agentConn.WriteJSON(map[string]interface{}{
 		"type":          "new_session",
@@ -83,71 +264,190 @@ func HandleWebSocket(c *gin.Context) {
 		"command":       "/bin/bash",
 		"terminal_cols": session.TerminalCols,
 		"terminal_rows": session.TerminalRows,
+		"os_user":       session.OSAccount,
 	})
 
-	// 浏览器 → Server → Agent（输入 + resize）
-	go func() {
-		defer func() {
-			agentConn.WriteJSON(map[string]interface{}{
-				"type": "close_session", "session_id": session.ID,
-			})
-		}()
-
-		for {
-			_, data, err := conn.ReadMessage()
-			if err != nil {
-				break
-			}
+	owner := relay.newOwner(c, conn)
+	if err := relay.hubSession.Join(owner); err != nil {
+		return
+	}
+	relay.serveOwner(conn, owner)
+}
 
-			// 尝试解析是否为控制消息
-			var ctrl struct {
-				Type string `json:"type"`
-			}
-			if json.Unmarshal(data, &ctrl) == nil && ctrl.Type == "resize" {
-				var r struct {
-					Cols int `json:"cols"`
-					Rows int `json:"rows"`
-				}
-				if json.Unmarshal(data, &r) == nil {
-					agentConn.WriteJSON(map[string]interface{}{
-						"type":       "resize",
-						"session_id": session.ID,
-						"cols":       r.Cols,
-						"rows":       r.Rows,
-					})
-				}
-				continue
-			}
+// resumeWebSocket 发起人断线后凭恢复令牌重新连接到原会话。
+// 除恢复令牌外还要求 access_token 查询参数携带发起人本人的 JWT，并重新做一遍新建会话时的检查：
+// 资产未被隔离或吊销、仍有 tty:connect 权限、仍被授权以会话的主机账号访问该资产
+func resumeWebSocket(c *gin.Context, resumeToken string) {
+	hubSession := agent.Sessions.FindDetached(resumeToken)
+	if hubSession == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired resume token", "code": "RESUME_TOKEN_INVALID"})
+		return
+	}
+	v, ok := relays.Load(hubSession.ID)
+	if !ok {
+		c.JSON(http.StatusGone, gin.H{"error": "session closed", "code": "SESSION_CLOSED"})
+		return
+	}
+	relay := v.(*ttyRelay)
 
-			// 普通输入
-			agentConn.WriteJSON(map[string]interface{}{
-				"type":       "input",
-				"session_id": session.ID,
-				"data":       string(data),
-			})
-		}
-	}()
+	claims, err := utils.ParseToken(c.Query("access_token"))
+	if err != nil || service.IsTokenRevoked(claims) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "valid access_token required", "code": "UNAUTHORIZED"})
+		return
+	}
+	grant := service.NewAccessGrant(claims.UserID, claims.IsAdmin)
+	if grant.UserIDString() != relay.session.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the session owner can resume", "code": "PERMISSION_DENIED"})
+		return
+	}
+	allowed, err := service.HasPermission(claims.UserID, claims.IsAdmin, model.PermTTYConnect)
+	if err != nil {
+		zap.L().Error("检查权限失败", zap.Uint("user_id", claims.UserID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "check permission failed", "code": "INTERNAL_ERROR"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "missing permission " + model.PermTTYConnect, "code": "PERMISSION_DENIED"})
+		return
+	}
+	if err := service.CheckAgentTTYAllowed(relay.session.AssetID); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.CheckSessionAccess(relay.session.AssetID, relay.session.OSAccount, grant); err != nil {
+		sessionAccessErrorResponse(c, err)
+		return
+	}
+
+	rawConn, err := browserUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		zap.L().Error("WebSocket 升级失败", zap.Error(err))
+		return
+	}
+	defer rawConn.Close()
+	conn := &lockedConn{Conn: rawConn}
+
+	owner := relay.newOwner(c, conn)
+	// 让 Agent 补发断线期间暂存的输出，并恢复实时输出
+	err = hubSession.Resume(owner, func() {
+		relay.agentConn.WriteJSON(map[string]interface{}{
+			"type": "resume_session", "session_id": relay.session.ID,
+		})
+		mysql.UpdateTTYSessionStatus(relay.session.ID, "connected")
+	})
+	if err != nil {
+		conn.WriteJSON(gin.H{"type": "error", "message": "会话已结束或已在其他窗口恢复"})
+		return
+	}
+	hubSession.Notice("已恢复连接")
+	zap.L().Info("会话已恢复",
+		zap.String("session_id", relay.session.ID),
+		zap.String("browser_ip", c.ClientIP()))
 
-	// Agent → Server → Browser（输出）
+	relay.serveOwner(conn, owner)
+}
+
+// newOwner 创建发起人的浏览器订阅者，并下发本次连接的恢复令牌
+func (r *ttyRelay) newOwner(c *gin.Context, conn *lockedConn) *agent.Participant {
+	sub := newBrowserSubscriber(c, conn, r.session.ID)
+	conn.WriteJSON(gin.H{
+		"type":                 "session",
+		"session_id":           r.session.ID,
+		"resume_token":         r.hubSession.IssueResumeToken(),
+		"resume_grace_seconds": int(resumeGracePeriod().Seconds()),
+	})
+	return &agent.Participant{Sub: sub, Role: agent.RoleOwner, UserID: r.session.UserID}
+}
+
+// serveOwner 浏览器 → Server → Agent（输入 + resize）；输出由 AgentWebSocketHandler 经会话中心推送。
+// 浏览器主动关闭（{"type":"close"} 或正常关闭帧）时结束会话，异常断线时进入断线保留
+func (r *ttyRelay) serveOwner(conn *lockedConn, owner *agent.Participant) {
+	sub := owner.Sub.(*browserSubscriber)
+	closedByUser := false
 	for {
-		_, msg, err := conn.ReadMessage()
+		msgType, data, err := conn.ReadMessage()
 		if err != nil {
+			closedByUser = websocket.IsCloseError(err, websocket.CloseNormalClosure)
 			break
 		}
 
-		var payload struct {
-			Type      string `json:"type"`
-			SessionID string `json:"session_id"`
-			Data      string `json:"data"`
+		input, ctrlType := sub.decodeBrowserMessage(msgType, data)
+		if ctrlType == "close" {
+			closedByUser = true
+			break
 		}
-		if json.Unmarshal(msg, &payload) == nil &&
-			payload.Type == "output" &&
-			payload.SessionID == session.ID {
-			conn.WriteMessage(websocket.TextMessage, []byte(payload.Data))
+		if ctrlType == "resize" {
+			var rs struct {
+				Cols int `json:"cols"`
+				Rows int `json:"rows"`
+			}
+			if json.Unmarshal(data, &rs) == nil {
+				r.recorder.WriteResize(rs.Cols, rs.Rows)
+				r.agentConn.WriteJSON(map[string]interface{}{
+					"type":       "resize",
+					"session_id": r.session.ID,
+					"cols":       rs.Cols,
+					"rows":       rs.Rows,
+				})
+			}
+			continue
+		}
+
+		// 普通输入，经命令拦截后转发（被管理员接管期间丢弃）
+		if len(input) > 0 {
+			r.hubSession.Input(sub, input)
 		}
 	}
+	r.hubSession.Leave(sub)
+
+	select {
+	case <-r.hubSession.Done():
+		return
+	default:
+	}
+
+	grace := resumeGracePeriod()
+	if closedByUser || grace <= 0 {
+		r.hubSession.Close("会话已结束")
+		return
+	}
+
+	// 异常断线：Agent 保持 PTY 并把输出暂存在环形缓冲区，超时未恢复再结束会话
+	// 通知 Agent 和写状态与恢复的通知按顺序执行，很快的恢复不会被这里的 detached 状态覆盖
+	err := r.hubSession.Detach(grace, func() {
+		r.agentConn.WriteJSON(map[string]interface{}{
+			"type":          "detach_session",
+			"session_id":    r.session.ID,
+			"grace_seconds": int(grace.Seconds()),
+		})
+		mysql.UpdateTTYSessionStatus(r.session.ID, "detached")
+	})
+	if err != nil {
+		return
+	}
+	zap.L().Info("浏览器断线，会话进入保留状态",
+		zap.String("session_id", r.session.ID),
+		zap.Duration("grace", grace))
+}
+
+// finish 会话最终结束：通知 Agent 关闭 PTY、落库、关闭录像并提取命令索引
+func (r *ttyRelay) finish() {
+	relays.Delete(r.session.ID)
+
+	r.agentConn.WriteJSON(map[string]interface{}{
+		"type": "close_session", "session_id": r.session.ID,
+	})
+	r.guard.Close()
 
 	// 会话结束
-	mysql.UpdateTTYSessionStatus(session.ID, "closed")
-	zap.L().Info("会话已结束", zap.String("session_id", session.ID))
+	mysql.CloseTTYSession(r.session.ID, "")
+	zap.L().Info("会话已结束", zap.String("session_id", r.session.ID))
+
+	// 录像写完后异步提取命令索引
+	r.recorder.Close()
+	go func() {
+		if err := service.IndexSessionCommands(r.session.ID); err != nil {
+			zap.L().Error("提取会话命令失败", zap.String("session_id", r.session.ID), zap.Error(err))
+		}
+	}()
 }
@@ -49,7 +49,7 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	token, err := utils.GenerateToken(user.ID, user.Username, user.IsAdmin)
+	token, _, err := utils.GenerateToken(user.ID, user.Username, user.IsAdmin)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "生成 token 失败"})
 		return
@@ -9,6 +9,7 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/chiwen/server/internal/api/handler"
+	"github.com/chiwen/server/internal/data/model"
 	"github.com/chiwen/server/internal/pkg/middleware"
 	"github.com/chiwen/server/pkg/logger"
 )
@@ -54,12 +55,19 @@ func Setup() *gin.Engine {
 	{
 		// 登录接口（放在最上面，方便调试）
 		api.POST("/login", handler.Login)
+		// 登录第二步：凭 mfa_token 提交验证码，或按策略先绑定 MFA
+		api.POST("/login/mfa", handler.LoginMFAHandler)
+		api.POST("/login/mfa/enroll", handler.LoginMFAEnrollHandler)
+		api.POST("/login/mfa/activate", handler.LoginMFAActivateHandler)
+		// 访问令牌过期后凭刷新令牌续期
+		api.POST("/token/refresh", handler.RefreshToken)
 
 		// 原有的公开接口
 		api.POST("/register", handler.RegisterHandler)
-		api.POST("/approve", handler.ApproveHandler)
 		api.POST("/heartbeat", handler.HeartbeatHandler)
 		api.GET("/register/status", handler.RegisterStatusHandler)
+		// 已注册的 Agent 凭原私钥签名更换公钥/密钥
+		api.POST("/register/reenroll", handler.ReenrollHandler)
 
 		// 诊断接口
 		api.GET("/diagnostic", handler.DiagnosticHandler)
@@ -76,19 +84,158 @@ func Setup() *gin.Engine {
 
 	// ==================== 需要登录的路由 ====================
 	authGroup := r.Group("/api/v1")
-	authGroup.Use(middleware.AuthRequired()) // JWT 鉴权中间件
+	authGroup.Use(middleware.AuthRequired(), middleware.Audit()) // JWT / API 令牌鉴权 + 变更操作审计
 	{
 		// 资产相关（需要登录后才能看）
 		assetsGroup := authGroup.Group("/assets")
 		{
-			assetsGroup.GET("/list", handler.AssetsListHandler)
-			assetsGroup.GET("/:id/tty/authorize", ttyHandler.AuthorizeTTY)
-			assetsGroup.DELETE("/:id", handler.DeleteAssetHandler)
-			assetsGroup.PUT("/:id/labels", handler.UpdateAssetLabelsHandler)
+			assetsGroup.GET("/list", middleware.RequirePermission(model.PermAssetRead), handler.AssetsListHandler)
+			assetsGroup.GET("/:id/tty/authorize", middleware.RequirePermission(model.PermTTYConnect), ttyHandler.AuthorizeTTY)
+			assetsGroup.DELETE("/:id", middleware.RequirePermission(model.PermAssetDelete), handler.DeleteAssetHandler)
+			assetsGroup.PUT("/:id/labels", middleware.RequirePermission(model.PermAssetUpdate), handler.UpdateAssetLabelsHandler)
+			// Agent 密钥在线轮换
+			assetsGroup.GET("/:id/rotate-secret", middleware.RequirePermission(model.PermAgentManage), handler.GetAgentSecretStatusHandler)
+			assetsGroup.POST("/:id/rotate-secret", middleware.RequirePermission(model.PermAgentManage), handler.RotateAgentSecretHandler)
+			// Agent 吊销与隔离
+			assetsGroup.POST("/:id/revoke", middleware.RequirePermission(model.PermAgentManage), handler.RevokeAgentHandler)
+			assetsGroup.POST("/:id/quarantine", middleware.RequirePermission(model.PermAgentManage), handler.QuarantineAgentHandler)
+			assetsGroup.DELETE("/:id/quarantine", middleware.RequirePermission(model.PermAgentManage), handler.ReleaseAgentQuarantineHandler)
+
+			// 主机账号：终端以该账号身份启动 shell
+			assetsGroup.GET("/:id/accounts", middleware.RequirePermission(model.PermAssetRead), handler.ListHostAccountsHandler)
+			assetsGroup.POST("/:id/accounts", middleware.RequirePermission(model.PermHostAccountManage), handler.CreateHostAccountHandler)
+			assetsGroup.PUT("/:id/accounts/:account_id", middleware.RequirePermission(model.PermHostAccountManage), handler.UpdateHostAccountHandler)
+			assetsGroup.DELETE("/:id/accounts/:account_id", middleware.RequirePermission(model.PermHostAccountManage), handler.DeleteHostAccountHandler)
 		}
 
-		// 注册审批相关（需要管理员权限）
-		registerGroup := authGroup.Group("/register")
+		// 会话录像（没有 session:audit 权限的用户只能访问自己的录像）
+		recordGroup := authGroup.Group("/tty/recordings")
+		{
+			recordGroup.GET("", ttyHandler.ListRecordings)
+			recordGroup.GET("/:id/download", ttyHandler.DownloadRecording)
+		}
+
+		// 会话回放、实时旁观/协同（WebSocket，浏览器通过 access_token 查询参数鉴权）
+		sessionsGroup := authGroup.Group("/tty/sessions")
+		{
+			sessionsGroup.GET("/:id/replay", ttyHandler.ReplaySession)
+			sessionsGroup.GET("/active", middleware.RequirePermission(model.PermSessionAudit), ttyHandler.ListActiveSessions)
+			sessionsGroup.GET("/metrics", middleware.RequirePermission(model.PermSessionAudit), ttyHandler.SessionMetrics)
+			// watch 需要 session:audit，collaborate/takeover 需要 session:collaborate，在处理函数中按模式校验
+			sessionsGroup.GET("/:id/join", ttyHandler.JoinSession)
+			sessionsGroup.DELETE("/:id", middleware.RequirePermission(model.PermSessionTerminate), ttyHandler.TerminateSession)
+			sessionsGroup.POST("/terminate", middleware.RequirePermission(model.PermSessionTerminate), ttyHandler.TerminateSessions)
+			sessionsGroup.POST("/:id/commands/reindex", middleware.RequirePermission(model.PermSessionAudit), ttyHandler.ReindexSessionCommands)
+		}
+
+		// 命令审计检索
+		authGroup.GET("/tty/commands", ttyHandler.SearchCommands)
+
+		// 退出登录
+		authGroup.POST("/logout", middleware.SessionOnly(), handler.Logout)
+		authGroup.POST("/logout/all", middleware.SessionOnly(), handler.LogoutAll)
+
+		// 当前用户的 MFA 绑定；策略由管理员维护
+		mfaGroup := authGroup.Group("/mfa", middleware.SessionOnly())
+		{
+			mfaGroup.GET("", handler.GetMFAStatusHandler)
+			mfaGroup.POST("/enroll", handler.StartMFAEnrollmentHandler)
+			mfaGroup.POST("/activate", handler.ActivateMFAHandler)
+			mfaGroup.POST("/recovery-codes", handler.RegenerateRecoveryCodesHandler)
+			mfaGroup.DELETE("", handler.DisableMFAHandler)
+			mfaGroup.GET("/policy", middleware.RequirePermission(model.PermSettingsManage), handler.GetMFAPolicyHandler)
+			mfaGroup.PUT("/policy", middleware.RequirePermission(model.PermSettingsManage), handler.UpdateMFAPolicyHandler)
+		}
+
+		// 用户与用户组管理；非管理员不能操作管理员账号，角色分配另需 role:manage
+		userGroup := authGroup.Group("/users", middleware.RequirePermission(model.PermUserManage), handler.GuardAdminUsers())
+		{
+			userGroup.GET("", handler.ListUsersHandler)
+			userGroup.POST("", handler.CreateUserHandler)
+			userGroup.GET("/:id", handler.GetUserHandler)
+			userGroup.PUT("/:id", handler.UpdateUserHandler)
+			userGroup.DELETE("/:id", handler.DeleteUserHandler)
+			userGroup.POST("/:id/password", handler.ResetUserPasswordHandler)
+			userGroup.PUT("/:id/active", handler.SetUserActiveHandler)
+			userGroup.DELETE("/:id/mfa", handler.ResetUserMFAHandler)
+			userGroup.POST("/:id/revoke-tokens", handler.RevokeUserTokensHandler)
+			userGroup.POST("/:id/unlock", handler.UnlockUserHandler)
+			userGroup.PUT("/:id/login-ips", handler.SetUserLoginIPsHandler)
+			userGroup.PUT("/:id/roles", middleware.RequirePermission(model.PermRoleManage), handler.SetUserRolesHandler)
+			userGroup.GET("/:id/api-tokens", handler.ListUserAPITokensHandler)
+			userGroup.POST("/:id/api-tokens", middleware.SessionOnly(), handler.CreateUserAPITokenHandler)
+			userGroup.DELETE("/:id/api-tokens/:token_id", handler.RevokeUserAPITokenHandler)
+		}
+		groupGroup := authGroup.Group("/user-groups", middleware.RequirePermission(model.PermUserManage))
+		{
+			groupGroup.GET("", handler.ListUserGroupsHandler)
+			groupGroup.POST("", handler.CreateUserGroupHandler)
+			groupGroup.PUT("/:id", handler.UpdateUserGroupHandler)
+			groupGroup.DELETE("/:id", handler.DeleteUserGroupHandler)
+			groupGroup.GET("/:id/members", handler.ListUserGroupMembersHandler)
+			groupGroup.POST("/:id/members", handler.AddUserGroupMembersHandler)
+			groupGroup.DELETE("/:id/members/:user_id", handler.RemoveUserGroupMemberHandler)
+			groupGroup.PUT("/:id/roles", middleware.RequirePermission(model.PermRoleManage), handler.SetUserGroupRolesHandler)
+		}
+
+		// 个人 API 令牌（自动化客户端使用），只能在交互登录后管理
+		apiTokenGroup := authGroup.Group("/api-tokens", middleware.SessionOnly())
+		{
+			apiTokenGroup.GET("", handler.ListMyAPITokensHandler)
+			apiTokenGroup.POST("", handler.CreateMyAPITokenHandler)
+			apiTokenGroup.DELETE("/:id", handler.RevokeMyAPITokenHandler)
+		}
+
+		// 角色与权限
+		authGroup.GET("/permissions", middleware.RequirePermission(model.PermRoleManage), handler.ListPermissionsHandler)
+		authGroup.GET("/permissions/mine", handler.MyPermissionsHandler)
+		roleGroup := authGroup.Group("/roles", middleware.RequirePermission(model.PermRoleManage))
+		{
+			roleGroup.GET("", handler.ListRolesHandler)
+			roleGroup.POST("", handler.CreateRoleHandler)
+			roleGroup.PUT("/:id", handler.UpdateRoleHandler)
+			roleGroup.DELETE("/:id", handler.DeleteRoleHandler)
+		}
+
+		// 登录日志与登录安全设置
+		authGroup.GET("/login-logs", middleware.RequirePermission(model.PermAuditRead), handler.ListLoginLogsHandler)
+		authGroup.GET("/login-logs/mine", handler.ListMyLoginLogsHandler)
+		authGroup.GET("/settings/login-security", middleware.RequirePermission(model.PermSettingsManage), handler.GetLoginSecurityHandler)
+		authGroup.PUT("/settings/login-security", middleware.RequirePermission(model.PermSettingsManage), handler.UpdateLoginSecurityHandler)
+		authGroup.GET("/settings/agent-secret-rotation", middleware.RequirePermission(model.PermSettingsManage), handler.GetAgentSecretRotationHandler)
+		authGroup.PUT("/settings/agent-secret-rotation", middleware.RequirePermission(model.PermSettingsManage), handler.UpdateAgentSecretRotationHandler)
+
+		// 资产授权规则
+		authRuleGroup := authGroup.Group("/asset-auth-rules", middleware.RequirePermission(model.PermAssetAuthRuleManage))
+		{
+			authRuleGroup.GET("", handler.ListAssetAuthRulesHandler)
+			authRuleGroup.POST("", handler.CreateAssetAuthRuleHandler)
+			authRuleGroup.PUT("/:id", handler.UpdateAssetAuthRuleHandler)
+			authRuleGroup.DELETE("/:id", handler.DeleteAssetAuthRuleHandler)
+		}
+
+		// 命令拦截规则与审批
+		ruleGroup := authGroup.Group("/command-rules", middleware.RequirePermission(model.PermCommandRuleManage))
+		{
+			ruleGroup.GET("", handler.ListCommandRulesHandler)
+			ruleGroup.POST("", handler.CreateCommandRuleHandler)
+			ruleGroup.PUT("/:id", handler.UpdateCommandRuleHandler)
+			ruleGroup.DELETE("/:id", handler.DeleteCommandRuleHandler)
+		}
+		approvalGroup := authGroup.Group("/command-approvals", middleware.RequirePermission(model.PermCommandApprove))
+		{
+			approvalGroup.GET("", handler.ListCommandApprovalsHandler)
+			approvalGroup.POST("/:id/approve", handler.ApproveCommandHandler)
+			approvalGroup.POST("/:id/reject", handler.RejectCommandHandler)
+		}
+
+		// 审计事件查询与导出
+		authGroup.GET("/audit-events", middleware.RequirePermission(model.PermAuditRead), handler.ListAuditEventsHandler)
+		authGroup.GET("/audit-events/export", middleware.RequirePermission(model.PermAuditRead), handler.ExportAuditEventsHandler)
+
+		// 注册审批相关（需要 register:approve 权限），审批需登录才能记录审批人
+		authGroup.POST("/approve", middleware.RequirePermission(model.PermRegisterApprove), handler.ApproveHandler)
+		registerGroup := authGroup.Group("/register", middleware.RequirePermission(model.PermRegisterApprove))
 		{
 			registerGroup.GET("/pending", handler.PendingAppliesHandler)
 			registerGroup.POST("/reject", handler.RejectApplyHandler)
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// AgentSecrets 资产的 Agent HMAC 密钥：当前密钥、轮换后仍在过渡期内的旧密钥、已下发待确认的新密钥
+type AgentSecrets struct {
+	Current         string     `db:"agent_secret_key"`
+	Previous        string     `db:"agent_secret_prev"`
+	PreviousExpires *time.Time `db:"agent_secret_prev_expires_at"`
+	Pending         string     `db:"agent_secret_pending"`
+	PendingID       string     `db:"agent_secret_pending_id"`
+	PendingExpires  *time.Time `db:"agent_secret_pending_expires_at"`
+	RotatedAt       *time.Time `db:"agent_secret_rotated_at"`
+	State           string     `db:"agent_state"` // 见 AgentState*，吊销或资产已删除时任何密钥都不再有效
+	Deleted         bool       `db:"is_deleted"`
+}
+
+// AgentSecretRotation Agent 密钥定期轮换设置
+type AgentSecretRotation struct {
+	IntervalDays int `json:"interval_days"` // 距上次轮换（或注册）超过该天数的在线 Agent 自动轮换，0 表示不定期轮换
+	OverlapHours int `json:"overlap_hours"` // 轮换后旧密钥继续有效的小时数
+}
@@ -0,0 +1,11 @@
+package model
+
+// Agent 状态（assets.agent_state）
+const (
+	// AgentStateActive 正常
+	AgentStateActive = "active"
+	// AgentStateQuarantined 隔离：继续接收心跳以便观察，但禁止建立终端会话
+	AgentStateQuarantined = "quarantined"
+	// AgentStateRevoked 吊销：密钥作废，心跳和长连接都被拒绝，不能重新注册，不可恢复
+	AgentStateRevoked = "revoked"
+)
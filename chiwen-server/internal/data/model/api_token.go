@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// APITokenPrefix API 令牌的固定前缀，AuthRequired 据此区分 API 令牌和 JWT
+const APITokenPrefix = "cwt_"
+
+// APIToken 自动化客户端（CI、脚本）使用的长期令牌，只保存哈希
+type APIToken struct {
+	ID          uint       `db:"id" json:"id"`
+	UserID      uint       `db:"user_id" json:"user_id"`
+	Name        string     `db:"name" json:"name"`
+	TokenPrefix string     `db:"token_prefix" json:"token_prefix"` // 令牌开头几位，便于辨认
+	TokenHash   string     `db:"token_hash" json:"-"`
+	Scopes      StringList `db:"scopes" json:"scopes"` // 可使用的权限点，不超过所属用户的权限
+	ExpiresAt   time.Time  `db:"expires_at" json:"expires_at"`
+	LastUsedAt  *time.Time `db:"last_used_at" json:"last_used_at"`
+	LastUsedIP  string     `db:"last_used_ip" json:"last_used_ip"`
+	RevokedAt   *time.Time `db:"revoked_at" json:"revoked_at"`
+	CreatedBy   string     `db:"created_by" json:"created_by"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+}
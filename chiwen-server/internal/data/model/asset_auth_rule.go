@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+// AssetAuthRule 资产授权规则：把用户/用户组授权到资产（按ID或标签选择），可限定主机账号和有效时间
+//
+//	UserIDs、GroupIDs 至少配置一项；AssetIDs、AssetLabels 至少配置一项，两者满足其一即匹配；
+//	HostAccounts 为空表示资产上该用户可用的主机账号都可以使用；
+//	ValidFrom、ValidUntil 为空表示不限
+type AssetAuthRule struct {
+	ID           int64      `db:"id" json:"id"`
+	Name         string     `db:"name" json:"name" binding:"required"`
+	UserIDs      UintList   `db:"user_ids" json:"user_ids"`
+	GroupIDs     UintList   `db:"group_ids" json:"group_ids"`
+	AssetIDs     StringList `db:"asset_ids" json:"asset_ids"`
+	AssetLabels  StringMap  `db:"asset_labels" json:"asset_labels"`
+	HostAccounts StringList `db:"host_accounts" json:"host_accounts"`
+	ValidFrom    *time.Time `db:"valid_from" json:"valid_from"`
+	ValidUntil   *time.Time `db:"valid_until" json:"valid_until"`
+	Enabled      bool       `db:"enabled" json:"enabled"`
+	Description  string     `db:"description" json:"description"`
+	CreatedBy    string     `db:"created_by" json:"created_by"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// ActiveAt 判断规则在 t 时刻是否生效
+func (r *AssetAuthRule) ActiveAt(t time.Time) bool {
+	if !r.Enabled {
+		return false
+	}
+	if r.ValidFrom != nil && t.Before(*r.ValidFrom) {
+		return false
+	}
+	if r.ValidUntil != nil && !t.Before(*r.ValidUntil) {
+		return false
+	}
+	return true
+}
+
+// MatchesUser 判断规则是否授权给该用户（直接授权或通过用户组）
+func (r *AssetAuthRule) MatchesUser(userID uint, groupIDs []uint) bool {
+	return r.UserIDs.Contains(userID) || r.GroupIDs.Intersects(groupIDs)
+}
+
+// MatchesAsset 判断规则是否覆盖该资产
+func (r *AssetAuthRule) MatchesAsset(assetID string, labels map[string]interface{}) bool {
+	if r.AssetIDs.Contains(assetID) {
+		return true
+	}
+	return len(r.AssetLabels) > 0 && r.AssetLabels.MatchLabels(labels)
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEvent 一次变更类接口调用的审计记录
+type AuditEvent struct {
+	ID           int64           `db:"id" json:"id"`
+	ActorID      uint            `db:"actor_id" json:"actor_id"`
+	Actor        string          `db:"actor" json:"actor"`
+	Action       string          `db:"action" json:"action"` // 方法 + 路由模板，如 "DELETE /api/v1/assets/:id"
+	Method       string          `db:"method" json:"method"`
+	Path         string          `db:"path" json:"path"`
+	ResourceType string          `db:"resource_type" json:"resource_type"`
+	ResourceID   string          `db:"resource_id" json:"resource_id"`
+	Before       json.RawMessage `db:"before_data" json:"before,omitempty"`
+	After        json.RawMessage `db:"after_data" json:"after,omitempty"`
+	Diff         json.RawMessage `db:"diff" json:"diff,omitempty"`
+	StatusCode   int             `db:"status_code" json:"status_code"`
+	ClientIP     string          `db:"client_ip" json:"client_ip"`
+	CreatedAt    time.Time       `db:"created_at" json:"created_at"`
+}
+
+// AuditFilter 审计事件查询条件
+type AuditFilter struct {
+	Actor        string
+	Action       string // 模糊匹配
+	ResourceType string
+	ResourceID   string
+	Start        *time.Time
+	End          *time.Time
+	Page         int
+	PageSize     int
+}
@@ -0,0 +1,51 @@
+package model
+
+import "time"
+
+// 命令规则动作
+const (
+	CommandActionDeny    = "deny"    // 直接拦截
+	CommandActionConfirm = "confirm" // 需要第二位审批人确认后才执行
+)
+
+// CommandRule 命令拦截规则
+// 作用范围：AssetLabels 为空表示所有资产；UserIDs、GroupIDs 都为空表示所有用户
+type CommandRule struct {
+	ID          int64     `db:"id" json:"id"`
+	Name        string    `db:"name" json:"name" binding:"required"`
+	Pattern     string    `db:"pattern" json:"pattern" binding:"required"` // Go 正则，匹配整条命令行
+	Action      string    `db:"action" json:"action" binding:"required,oneof=deny confirm"`
+	AssetLabels StringMap `db:"asset_labels" json:"asset_labels"`
+	UserIDs     UintList  `db:"user_ids" json:"user_ids"`
+	GroupIDs    UintList  `db:"group_ids" json:"group_ids"`
+	Priority    int       `db:"priority" json:"priority"` // 越大越先匹配
+	Enabled     bool      `db:"enabled" json:"enabled"`
+	Description string    `db:"description" json:"description"`
+	CreatedBy   string    `db:"created_by" json:"created_by"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// 命令审批状态
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+)
+
+// CommandApproval 命中 confirm 规则的命令审批单
+type CommandApproval struct {
+	ID         string     `db:"id" json:"id"`
+	RuleID     int64      `db:"rule_id" json:"rule_id"`
+	RuleName   string     `db:"rule_name" json:"rule_name"`
+	SessionID  string     `db:"session_id" json:"session_id"`
+	AssetID    string     `db:"asset_id" json:"asset_id"`
+	UserID     string     `db:"user_id" json:"user_id"`
+	Command    string     `db:"command" json:"command"`
+	Status     string     `db:"status" json:"status"`
+	ApproverID *uint      `db:"approver_id" json:"approver_id"`
+	Reason     string     `db:"reason" json:"reason"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	DecidedAt  *time.Time `db:"decided_at" json:"decided_at"`
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// HostAccount 资产上的操作系统账号，用户连接终端时以该账号身份启动 shell
+// 使用范围：UserIDs、GroupIDs 都为空表示所有平台用户可用
+type HostAccount struct {
+	ID          int64     `db:"id" json:"id"`
+	AssetID     string    `db:"asset_id" json:"asset_id"`
+	OSUsername  string    `db:"os_username" json:"os_username" binding:"required"`
+	UserIDs     UintList  `db:"user_ids" json:"user_ids"`
+	GroupIDs    UintList  `db:"group_ids" json:"group_ids"`
+	IsDefault   bool      `db:"is_default" json:"is_default"` // 未指定账号时优先使用
+	Enabled     bool      `db:"enabled" json:"enabled"`
+	Description string    `db:"description" json:"description"`
+	CreatedBy   string    `db:"created_by" json:"created_by"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Allows 判断平台用户是否可以使用该账号
+func (a *HostAccount) Allows(userID uint, groupIDs []uint) bool {
+	if !a.Enabled {
+		return false
+	}
+	if len(a.UserIDs) == 0 && len(a.GroupIDs) == 0 {
+		return true
+	}
+	return a.UserIDs.Contains(userID) || a.GroupIDs.Intersects(groupIDs)
+}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// scanJSON 把 MySQL JSON 列（[]byte/string/NULL）解析到 dst
+func scanJSON(src interface{}, dst interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		if len(v) == 0 {
+			return nil
+		}
+		return json.Unmarshal(v, dst)
+	case string:
+		if v == "" {
+			return nil
+		}
+		return json.Unmarshal([]byte(v), dst)
+	default:
+		return fmt.Errorf("unsupported JSON column type %T", src)
+	}
+}
+
+// StringMap JSON 对象列，例如资产标签选择器 {"env":"prod"}
+type StringMap map[string]string
+
+// Scan 实现 sql.Scanner
+func (m *StringMap) Scan(src interface{}) error {
+	*m = StringMap{}
+	return scanJSON(src, (*map[string]string)(m))
+}
+
+// Value 实现 driver.Valuer
+func (m StringMap) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(map[string]string(m))
+	return string(b), err
+}
+
+// UintList JSON 数字数组列，例如用户ID列表 [1,2,3]
+type UintList []uint
+
+// Scan 实现 sql.Scanner
+func (l *UintList) Scan(src interface{}) error {
+	*l = UintList{}
+	return scanJSON(src, (*[]uint)(l))
+}
+
+// Value 实现 driver.Valuer
+func (l UintList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]uint(l))
+	return string(b), err
+}
+
+// Contains 判断列表中是否包含 id
+func (l UintList) Contains(id uint) bool {
+	for _, v := range l {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Intersects 判断两个列表是否有交集
+func (l UintList) Intersects(other []uint) bool {
+	for _, v := range other {
+		if l.Contains(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// StringList JSON 字符串数组列，例如资产ID列表 ["a","b"]
+type StringList []string
+
+// Scan 实现 sql.Scanner
+func (l *StringList) Scan(src interface{}) error {
+	*l = StringList{}
+	return scanJSON(src, (*[]string)(l))
+}
+
+// Value 实现 driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]string(l))
+	return string(b), err
+}
+
+// Contains 判断列表中是否包含 s
+func (l StringList) Contains(s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchLabels 判断资产标签是否满足选择器（选择器中每个 key=value 都必须匹配，空选择器匹配所有资产）
+func (m StringMap) MatchLabels(labels map[string]interface{}) bool {
+	for k, want := range m {
+		got, ok := labels[k]
+		if !ok || fmt.Sprint(got) != want {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// 登录结果
+const (
+	LoginResultSuccess = "success"
+	LoginResultFailure = "failure"
+)
+
+// LoginLog 登录日志
+type LoginLog struct {
+	ID        int64     `db:"id" json:"id"`
+	UserID    uint      `db:"user_id" json:"user_id"` // 用户不存在时为 0
+	Username  string    `db:"username" json:"username"`
+	ClientIP  string    `db:"client_ip" json:"client_ip"`
+	UserAgent string    `db:"user_agent" json:"user_agent"`
+	Result    string    `db:"result" json:"result"`
+	Reason    string    `db:"reason" json:"reason"` // 失败原因
+	MFAUsed   bool      `db:"mfa_used" json:"mfa_used"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// LoginLogFilter 登录日志查询条件
+type LoginLogFilter struct {
+	UserID   uint
+	Username string
+	ClientIP string
+	Result   string
+	Start    *time.Time
+	End      *time.Time
+	Page     int
+	PageSize int
+}
+
+// UserLoginState 登录保护相关的用户状态
+type UserLoginState struct {
+	ID               uint       `db:"id"`
+	FailedLoginCount int        `db:"failed_login_count"`
+	LockedUntil      *time.Time `db:"locked_until"`
+	LoginIPs         StringList `db:"login_ips"`
+	BindLoginIP      bool       `db:"bind_login_ip"`
+}
+
+// LoginSecurity 登录安全设置，存放在 system_settings 中
+type LoginSecurity struct {
+	// MaxFailures 账号连续登录失败达到该次数后锁定，0 表示不锁定
+	MaxFailures    int `json:"max_failures" binding:"min=0,max=100"`
+	LockoutMinutes int `json:"lockout_minutes" binding:"min=1,max=1440"`
+	// IPMaxFailures 同一 IP 在窗口期内失败达到该次数后拒绝登录，0 表示不限制
+	IPMaxFailures   int `json:"ip_max_failures" binding:"min=0,max=10000"`
+	IPWindowMinutes int `json:"ip_window_minutes" binding:"min=1,max=1440"`
+	// IPAllowlist 全局登录 IP 白名单（IP 或 CIDR），为空时不限制
+	IPAllowlist StringList `json:"ip_allowlist"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// UserMFA 用户的 TOTP 配置
+type UserMFA struct {
+	UserID        uint       `db:"user_id" json:"user_id"`
+	Secret        string     `db:"secret" json:"-"`
+	Enabled       bool       `db:"enabled" json:"enabled"`
+	LastUsedStep  int64      `db:"last_used_step" json:"-"`
+	RecoveryCodes StringList `db:"recovery_codes" json:"-"`
+	EnabledAt     *time.Time `db:"enabled_at" json:"enabled_at"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// MFA 策略模式
+const (
+	MFAPolicyOff       = "off"       // 用户自愿开启
+	MFAPolicyAll       = "all"       // 所有用户必须开启
+	MFAPolicySensitive = "sensitive" // 被授权访问敏感资产的用户（以及管理员）必须开启
+)
+
+// MFAPolicy MFA 强制策略，存放在 system_settings 中
+type MFAPolicy struct {
+	Mode string `json:"mode" binding:"required,oneof=off all sensitive"`
+	// SensitiveLabels 敏感资产的标签选择器，mode=sensitive 时必填，如 {"env":"prod"}
+	SensitiveLabels StringMap `json:"sensitive_labels"`
+}
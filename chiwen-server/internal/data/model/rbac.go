@@ -0,0 +1,75 @@
+package model
+
+import "time"
+
+// 权限点，格式为 资源:动作
+const (
+	PermAssetRead           = "asset:read"
+	PermAssetUpdate         = "asset:update"
+	PermAssetDelete         = "asset:delete"
+	PermHostAccountManage   = "host_account:manage"
+	PermRegisterApprove     = "register:approve"
+	PermAgentManage         = "agent:manage"
+	PermTTYConnect          = "tty:connect"
+	PermSessionAudit        = "session:audit"
+	PermSessionCollaborate  = "session:collaborate"
+	PermSessionTerminate    = "session:terminate"
+	PermCommandRuleManage   = "command_rule:manage"
+	PermCommandApprove      = "command:approve"
+	PermAssetAuthRuleManage = "asset_auth_rule:manage"
+	PermUserManage          = "user:manage"
+	PermRoleManage          = "role:manage"
+	PermAuditRead           = "audit:read"
+	PermSettingsManage      = "settings:manage"
+)
+
+// Permission 权限点说明
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Permissions 系统支持的全部权限点
+var Permissions = []Permission{
+	{PermAssetRead, "查看资产及主机账号"},
+	{PermAssetUpdate, "修改资产标签"},
+	{PermAssetDelete, "删除资产"},
+	{PermHostAccountManage, "管理主机账号"},
+	{PermRegisterApprove, "审批或拒绝 Agent 注册申请"},
+	{PermAgentManage, "轮换 Agent 密钥，隔离或吊销 Agent"},
+	{PermTTYConnect, "连接终端"},
+	{PermSessionAudit, "查看所有人的录像、命令，旁观在线会话"},
+	{PermSessionCollaborate, "以协同或接管模式加入在线会话（还需要 tty:connect 及该资产的授权）"},
+	{PermSessionTerminate, "强制结束会话"},
+	{PermCommandRuleManage, "管理命令拦截规则"},
+	{PermCommandApprove, "审批高危命令"},
+	{PermAssetAuthRuleManage, "管理资产授权规则"},
+	{PermUserManage, "管理用户和用户组"},
+	{PermRoleManage, "管理角色及角色分配"},
+	{PermAuditRead, "查看登录日志和操作审计"},
+	{PermSettingsManage, "修改 MFA 策略、登录安全等系统设置"},
+}
+
+// IsValidPermission 判断是否为已定义的权限点
+func IsValidPermission(name string) bool {
+	for _, p := range Permissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRoleName 内置默认角色，所有登录用户自动拥有
+const DefaultRoleName = "default"
+
+// Role 角色：一组权限点，可分配给用户或用户组
+type Role struct {
+	ID          uint       `db:"id" json:"id"`
+	Name        string     `db:"name" json:"name" binding:"required,max=64"`
+	Description string     `db:"description" json:"description"`
+	Permissions StringList `db:"permissions" json:"permissions"`
+	Builtin     bool       `db:"builtin" json:"builtin"` // 内置角色不能删除和改名
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at" json:"updated_at"`
+}
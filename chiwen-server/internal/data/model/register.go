@@ -20,6 +20,10 @@ type Asset struct {
 	CreatedAt time.Time `db:"created_at"`
 	UpdatedAt time.Time `db:"updated_at"`
 	IsDeleted bool      `db:"is_deleted"`
+
+	AgentState       string         `db:"agent_state"`        // active/quarantined/revoked
+	AgentStateReason sql.NullString `db:"agent_state_reason"` // 隔离或吊销原因
+	ClockSkewSeconds sql.NullInt64  `db:"clock_skew_seconds"` // Agent 时钟偏差（秒），正数表示 Agent 时间超前
 }
 
 // GetLabelsJSON 安全获取 Labels JSON
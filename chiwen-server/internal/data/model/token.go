@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// RefreshToken 服务端保存的刷新令牌（只保存哈希）
+type RefreshToken struct {
+	ID           int64      `db:"id" json:"id"`
+	TokenHash    string     `db:"token_hash" json:"-"`
+	FamilyID     string     `db:"family_id" json:"family_id"`
+	UserID       uint       `db:"user_id" json:"user_id"`
+	AccessJTI    string     `db:"access_jti" json:"-"`
+	ClientIP     string     `db:"client_ip" json:"client_ip"`
+	UserAgent    string     `db:"user_agent" json:"user_agent"`
+	ExpiresAt    time.Time  `db:"expires_at" json:"expires_at"`
+	UsedAt       *time.Time `db:"used_at" json:"used_at"`
+	RevokedAt    *time.Time `db:"revoked_at" json:"revoked_at"`
+	RevokeReason string     `db:"revoke_reason" json:"revoke_reason"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+}
+
+// RevokedToken 已吊销的访问令牌
+type RevokedToken struct {
+	JTI       string    `db:"jti"`
+	UserID    uint      `db:"user_id"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// UserTokenRevocation 用户级的令牌吊销时间
+type UserTokenRevocation struct {
+	UserID    uint      `db:"id"`
+	RevokedAt time.Time `db:"tokens_revoked_at"`
+}
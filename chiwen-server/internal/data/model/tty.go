@@ -6,26 +6,51 @@ import (
 
 // TTYSession TTY会话模型
 type TTYSession struct {
-	ID           string    `db:"id" json:"id"`                       // 会话ID
-	AssetID      string    `db:"asset_id" json:"asset_id"`           // 机器ID
-	UserID       string    `db:"user_id" json:"user_id"`             // 用户ID
-	Token        string    `db:"token" json:"token"`                 // 一次性Token
-	Status       string    `db:"status" json:"status"`               // 状态：pending, connected, closed
-	Command      string    `db:"command" json:"command"`             // 执行的命令，默认是/bin/bash
-	TerminalCols int       `db:"terminal_cols" json:"terminal_cols"` // 终端列数  修改后
-	TerminalRows int       `db:"terminal_rows" json:"terminal_rows"` // 终端行数  修改后
-	CreatedAt    time.Time `db:"created_at" json:"created_at"`       // 创建时间
-	ConnectedAt  time.Time `db:"connected_at" json:"connected_at"`   // 连接时间
-	ClosedAt     time.Time `db:"closed_at" json:"closed_at"`         // 关闭时间
-	BrowserIP    string    `db:"browser_ip" json:"browser_ip"`       // 浏览器IP
-	AgentIP      string    `db:"agent_ip" json:"agent_ip"`           // Agent IP
-	RecordFile   string    `db:"record_file" json:"record_file"`     // 录像文件路径
-	ErrorMessage string    `db:"error_message" json:"error_message"` // 错误信息
+	ID           string     `db:"id" json:"id"`                       // 会话ID
+	AssetID      string     `db:"asset_id" json:"asset_id"`           // 机器ID
+	UserID       string     `db:"user_id" json:"user_id"`             // 用户ID
+	Token        string     `db:"token" json:"token"`                 // 一次性Token
+	Status       string     `db:"status" json:"status"`               // 状态：pending, connected, detached, closed
+	Command      string     `db:"command" json:"command"`             // 执行的命令，默认是/bin/bash
+	TerminalCols int        `db:"terminal_cols" json:"terminal_cols"` // 终端列数  修改后
+	TerminalRows int        `db:"terminal_rows" json:"terminal_rows"` // 终端行数  修改后
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`       // 创建时间
+	ConnectedAt  *time.Time `db:"connected_at" json:"connected_at"`   // 连接时间（未连接时为 NULL）
+	ClosedAt     *time.Time `db:"closed_at" json:"closed_at"`         // 关闭时间（未关闭时为 NULL）
+	BrowserIP    string     `db:"browser_ip" json:"browser_ip"`       // 浏览器IP
+	AgentIP      string     `db:"agent_ip" json:"agent_ip"`           // Agent IP
+	RecordFile   string     `db:"record_file" json:"record_file"`     // 录像文件路径
+	ErrorMessage string     `db:"error_message" json:"error_message"` // 错误信息
+	OSAccount    string     `db:"os_account" json:"os_account"`       // 主机账号，空表示 Agent 运行账号
+}
+
+// TTYRecording 会话录像列表项（不包含一次性 token 等敏感字段）
+type TTYRecording struct {
+	SessionID  string     `db:"id" json:"session_id"`
+	AssetID    string     `db:"asset_id" json:"asset_id"`
+	Hostname   string     `db:"hostname" json:"hostname"`
+	UserID     string     `db:"user_id" json:"user_id"`
+	Username   string     `db:"username" json:"username"`
+	Status     string     `db:"status" json:"status"`
+	BrowserIP  string     `db:"browser_ip" json:"browser_ip"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	ClosedAt   *time.Time `db:"closed_at" json:"closed_at"`
+	RecordFile string     `db:"record_file" json:"-"`
+	Size       int64      `db:"-" json:"size"` // 录像文件大小（字节），文件丢失时为 0
+}
+
+// TTYRecordingFilter 录像查询条件
+type TTYRecordingFilter struct {
+	AssetID  string
+	UserID   string
+	Page     int
+	PageSize int
 }
 
 // TTYTokenInfo Token信息（不存储，只用于传输）
 type TTYTokenInfo struct {
-	Token   string `json:"token"`
-	WsURL   string `json:"ws_url"`
-	Expires int64  `json:"expires_in"` // 过期时间（秒）
+	Token     string `json:"token"`
+	WsURL     string `json:"ws_url"`
+	Expires   int64  `json:"expires_in"` // 过期时间（秒）
+	OSAccount string `json:"os_account"` // 主机账号，空表示 Agent 运行账号
 }
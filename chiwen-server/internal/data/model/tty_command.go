@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// TTYCommand 从会话录像中提取出的命令
+type TTYCommand struct {
+	ID         int64     `db:"id" json:"id"`
+	SessionID  string    `db:"session_id" json:"session_id"`
+	AssetID    string    `db:"asset_id" json:"asset_id"`
+	Hostname   string    `db:"hostname" json:"hostname"` // 仅查询时关联 assets 表
+	UserID     string    `db:"user_id" json:"user_id"`
+	Username   string    `db:"username" json:"username"` // 仅查询时关联 users 表
+	ExecutedAt time.Time `db:"executed_at" json:"executed_at"`
+	Command    string    `db:"command" json:"command"`
+	Partial    bool      `db:"partial" json:"partial"`     // 命令行还原不完整（使用了方向键/Tab 等）
+	ExitCode   *int      `db:"exit_code" json:"exit_code"` // 无法检测时为 NULL
+}
+
+// TTYCommandFilter 命令搜索条件
+type TTYCommandFilter struct {
+	AssetID  string
+	UserID   string
+	From     *time.Time
+	To       *time.Time
+	Keyword  string // 全文检索
+	Regex    string // MySQL REGEXP
+	Page     int
+	PageSize int
+}
@@ -8,6 +8,7 @@ type TTYToken struct {
 	Token        string     `db:"token"`
 	UserID       string     `db:"user_id"`
 	AssetID      string     `db:"asset_id"`
+	OSAccount    string     `db:"os_account"` // 主机账号，空表示 Agent 运行账号
 	TerminalCols int        `db:"terminal_cols"`
 	TerminalRows int        `db:"terminal_rows"`
 	Status       string     `db:"status"` // pending, used, expired
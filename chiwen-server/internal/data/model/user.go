@@ -24,3 +24,43 @@ type User struct {
 func (User) TableName() string {
 	return "users"
 }
+
+// UserProfile 用户管理接口返回的用户信息（不含密码，可为 NULL 的列统一为空串）
+type UserProfile struct {
+	ID          uint       `db:"id" json:"id"`
+	Username    string     `db:"username" json:"username"`
+	Name        string     `db:"name" json:"name"`
+	Email       string     `db:"email" json:"email"`
+	Phone       string     `db:"phone" json:"phone"`
+	IsActive    bool       `db:"is_active" json:"is_active"`
+	IsAdmin     bool       `db:"is_admin" json:"is_admin"`
+	LdapDN      string     `db:"ldap_dn" json:"ldap_dn"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at" json:"updated_at"`
+	LastLoginAt *time.Time `db:"last_login_at" json:"last_login_at"`
+	LastLoginIP string     `db:"last_login_ip" json:"last_login_ip"`
+	LockedUntil *time.Time `db:"locked_until" json:"locked_until"`
+	LoginIPs    StringList `db:"login_ips" json:"login_ips"`
+	BindLoginIP bool       `db:"bind_login_ip" json:"bind_login_ip"`
+	GroupIDs    []uint     `db:"-" json:"group_ids,omitempty"`
+	RoleIDs     []uint     `db:"-" json:"role_ids,omitempty"`
+}
+
+// UserFilter 用户查询条件
+type UserFilter struct {
+	Keyword  string // 匹配用户名、姓名、邮箱
+	IsActive *bool
+	Page     int
+	PageSize int
+}
+
+// UserGroup 用户组
+type UserGroup struct {
+	ID          uint      `db:"id" json:"id"`
+	Name        string    `db:"name" json:"name" binding:"required,max=64"`
+	Description string    `db:"description" json:"description"`
+	MemberCount int       `db:"member_count" json:"member_count"`
+	RoleIDs     []uint    `db:"-" json:"role_ids,omitempty"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
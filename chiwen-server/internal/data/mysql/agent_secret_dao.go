@@ -0,0 +1,222 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/pkg/envelope"
+)
+
+// 保存 Agent 密钥的列
+const (
+	colAgentSecret        = "agent_secret_key"
+	colAgentSecretPrev    = "agent_secret_prev"
+	colAgentSecretPending = "agent_secret_pending"
+)
+
+// AgentSecretAAD Agent 密钥密文绑定的上下文：资产ID和所在的列，密文不能挪到其他资产或其他列（如把旧密钥挪回当前列）
+func AgentSecretAAD(assetID, column string) string {
+	return assetID + "|" + column
+}
+
+// sealAgentSecret 加密 Agent 密钥后入库，密文绑定资产ID和列；未配置主密钥时为明文
+func sealAgentSecret(assetID, column, secret string) (string, error) {
+	sealed, err := envelope.Seal(secret, AgentSecretAAD(assetID, column))
+	if err != nil {
+		return "", fmt.Errorf("encrypt agent secret: %w", err)
+	}
+	return sealed, nil
+}
+
+// openAgentSecret 解密库中的 Agent 密钥，兼容未加密的历史数据；
+// 早期版本的密文只绑定资产ID，解密失败时按旧格式再试一次，执行 secrets rekey 后全部改为按列绑定
+func openAgentSecret(assetID, column, stored string) (string, error) {
+	secret, err := envelope.Open(stored, AgentSecretAAD(assetID, column))
+	if err != nil {
+		var legacyErr error
+		if secret, legacyErr = envelope.Open(stored, assetID); legacyErr != nil {
+			return "", fmt.Errorf("decrypt agent secret of %s: %w", assetID, err)
+		}
+	}
+	return secret, nil
+}
+
+// GetAgentSecrets 查询资产的全部 Agent 密钥
+func GetAgentSecrets(assetID string) (*model.AgentSecrets, error) {
+	var s model.AgentSecrets
+	err := db.Get(&s, `
+		SELECT IFNULL(agent_secret_key, '') AS agent_secret_key,
+		       IFNULL(agent_secret_prev, '') AS agent_secret_prev, agent_secret_prev_expires_at,
+		       IFNULL(agent_secret_pending, '') AS agent_secret_pending,
+		       IFNULL(agent_secret_pending_id, '') AS agent_secret_pending_id, agent_secret_pending_expires_at,
+		       agent_secret_rotated_at, agent_state, is_deleted
+		FROM assets WHERE id = ?`, assetID)
+	if err != nil {
+		return nil, err
+	}
+	for col, v := range map[string]*string{colAgentSecret: &s.Current, colAgentSecretPrev: &s.Previous, colAgentSecretPending: &s.Pending} {
+		if *v, err = openAgentSecret(assetID, col, *v); err != nil {
+			return nil, err
+		}
+	}
+	return &s, nil
+}
+
+// SetPendingAgentSecret 登记已下发、等待 Agent 确认的新密钥（覆盖未完成的轮换）
+func SetPendingAgentSecret(assetID, secret, rotationID string, expiresAt time.Time) error {
+	secret, err := sealAgentSecret(assetID, colAgentSecretPending, secret)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		UPDATE assets SET agent_secret_pending = ?, agent_secret_pending_id = ?, agent_secret_pending_expires_at = ?
+		WHERE id = ?`, secret, rotationID, expiresAt, assetID)
+	return err
+}
+
+// PromotePendingAgentSecret Agent 确认后启用新密钥，原密钥保留到 prevExpiresAt；返回是否生效（轮换ID不匹配时不变）。
+// 密文绑定了所在的列，换列时要解密后按新列重新加密
+func PromotePendingAgentSecret(assetID, rotationID string, prevExpiresAt time.Time) (bool, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var row struct {
+		Current string `db:"agent_secret_key"`
+		Pending string `db:"agent_secret_pending"`
+	}
+	err = tx.Get(&row, `
+		SELECT IFNULL(agent_secret_key, '') AS agent_secret_key, agent_secret_pending
+		FROM assets
+		WHERE id = ? AND agent_secret_pending_id = ? AND agent_secret_pending IS NOT NULL
+		FOR UPDATE`, assetID, rotationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	current, err := openAgentSecret(assetID, colAgentSecret, row.Current)
+	if err != nil {
+		return false, err
+	}
+	pending, err := openAgentSecret(assetID, colAgentSecretPending, row.Pending)
+	if err != nil {
+		return false, err
+	}
+	var prev sql.NullString
+	if current != "" {
+		if prev.String, err = sealAgentSecret(assetID, colAgentSecretPrev, current); err != nil {
+			return false, err
+		}
+		prev.Valid = true
+	}
+	next, err := sealAgentSecret(assetID, colAgentSecret, pending)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE assets SET
+			agent_secret_prev = ?,
+			agent_secret_prev_expires_at = ?,
+			agent_secret_key = ?,
+			agent_secret_pending = NULL,
+			agent_secret_pending_id = NULL,
+			agent_secret_pending_expires_at = NULL,
+			agent_secret_rotated_at = NOW()
+		WHERE id = ?`,
+		prev, prevExpiresAt, next, assetID)
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ClearPendingAgentSecret Agent 拒绝或处理失败时丢弃待确认的新密钥
+func ClearPendingAgentSecret(assetID, rotationID string) error {
+	_, err := db.Exec(`
+		UPDATE assets SET agent_secret_pending = NULL, agent_secret_pending_id = NULL, agent_secret_pending_expires_at = NULL
+		WHERE id = ? AND agent_secret_pending_id = ?`, assetID, rotationID)
+	return err
+}
+
+// CleanupAgentSecrets 清除已过期的旧密钥和未确认的新密钥
+func CleanupAgentSecrets() (int64, error) {
+	r1, err := db.Exec(`
+		UPDATE assets SET agent_secret_prev = NULL, agent_secret_prev_expires_at = NULL
+		WHERE agent_secret_prev_expires_at IS NOT NULL AND agent_secret_prev_expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	r2, err := db.Exec(`
+		UPDATE assets SET agent_secret_pending = NULL, agent_secret_pending_id = NULL, agent_secret_pending_expires_at = NULL
+		WHERE agent_secret_pending_expires_at IS NOT NULL AND agent_secret_pending_expires_at < NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	n1, _ := r1.RowsAffected()
+	n2, _ := r2.RowsAffected()
+	return n1 + n2, nil
+}
+
+// ListAgentSecretRotationDue 查询上次轮换（从未轮换时按注册时间）早于 before 且没有进行中轮换的资产ID
+func ListAgentSecretRotationDue(before time.Time) ([]string, error) {
+	ids := []string{}
+	err := db.Select(&ids, `
+		SELECT id FROM assets
+		WHERE is_deleted = 0 AND agent_secret_key IS NOT NULL
+		  AND COALESCE(agent_secret_rotated_at, created_at) < ?
+		  AND (agent_secret_pending_id IS NULL OR agent_secret_pending_expires_at < NOW())`, before)
+	return ids, err
+}
+
+// agentSecretColumns 保存 Agent 密钥的列
+var agentSecretColumns = []string{colAgentSecret, colAgentSecretPrev, colAgentSecretPending}
+
+// TransformAgentSecrets 逐条改写库中的 Agent 密钥（包括已删除资产），fn 返回新值和是否需要更新，
+// 加解密时用 AgentSecretAAD(assetID, column) 绑定上下文；
+// 按原值条件更新，与运行中的服务并发修改同一列时跳过该列，返回更新的列数和跳过的列数
+func TransformAgentSecrets(fn func(assetID, column, stored string) (string, bool, error)) (updated, skipped int, err error) {
+	var ids []string
+	if err := db.Select(&ids, `SELECT id FROM assets`); err != nil {
+		return 0, 0, err
+	}
+	for _, id := range ids {
+		for _, col := range agentSecretColumns {
+			var stored sql.NullString
+			if err := db.Get(&stored, `SELECT `+col+` FROM assets WHERE id = ?`, id); err != nil {
+				return updated, skipped, err
+			}
+			if !stored.Valid || stored.String == "" {
+				continue
+			}
+			v, changed, err := fn(id, col, stored.String)
+			if err != nil {
+				return updated, skipped, fmt.Errorf("asset %s %s: %w", id, col, err)
+			}
+			if !changed {
+				continue
+			}
+			result, err := db.Exec(`UPDATE assets SET `+col+` = ?, updated_at = updated_at WHERE id = ? AND `+col+` = ?`, v, id, stored.String)
+			if err != nil {
+				return updated, skipped, err
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				updated++
+			} else {
+				skipped++
+			}
+		}
+	}
+	return updated, skipped, nil
+}
@@ -0,0 +1,39 @@
+package mysql
+
+import "github.com/chiwen/server/internal/data/model"
+
+// SetAgentQuarantine 隔离或解除隔离（已吊销、已删除的资产不变），返回是否生效
+func SetAgentQuarantine(assetID string, quarantined bool, reason, by string) (bool, error) {
+	state := model.AgentStateActive
+	if quarantined {
+		state = model.AgentStateQuarantined
+	}
+	result, err := db.Exec(`
+		UPDATE assets SET agent_state = ?, agent_state_reason = NULLIF(?, ''),
+			agent_state_changed_by = ?, agent_state_changed_at = NOW(), updated_at = updated_at
+		WHERE id = ? AND is_deleted = 0 AND agent_state <> ?`,
+		state, reason, by, assetID, model.AgentStateRevoked)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// RevokeAgent 吊销 Agent：作废全部密钥（含轮换中的新旧密钥），返回资产是否存在
+func RevokeAgent(assetID, reason, by string) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE assets SET agent_state = ?, agent_state_reason = NULLIF(?, ''),
+			agent_state_changed_by = ?, agent_state_changed_at = NOW(),
+			agent_secret_key = NULL,
+			agent_secret_prev = NULL, agent_secret_prev_expires_at = NULL,
+			agent_secret_pending = NULL, agent_secret_pending_id = NULL, agent_secret_pending_expires_at = NULL,
+			updated_at = updated_at
+		WHERE id = ?`,
+		model.AgentStateRevoked, reason, by, assetID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,67 @@
+package mysql
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"go.uber.org/zap"
+)
+
+const apiTokenColumns = `id, user_id, name, token_prefix, token_hash, scopes, expires_at,
+	last_used_at, IFNULL(last_used_ip, '') AS last_used_ip, revoked_at, IFNULL(created_by, '') AS created_by, created_at`
+
+// CreateAPIToken 写入 API 令牌
+func CreateAPIToken(t *model.APIToken) error {
+	result, err := db.Exec(`
+		INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.UserID, t.Name, t.TokenPrefix, t.TokenHash, t.Scopes, t.ExpiresAt, t.CreatedBy)
+	if err != nil {
+		zap.L().Error("CreateAPIToken failed", zap.Uint("user_id", t.UserID), zap.Error(err))
+		return err
+	}
+	id, _ := result.LastInsertId()
+	t.ID = uint(id)
+	return nil
+}
+
+// GetAPITokenByHash 按令牌哈希查询
+func GetAPITokenByHash(hash string) (*model.APIToken, error) {
+	var t model.APIToken
+	if err := db.Get(&t, `SELECT `+apiTokenColumns+` FROM api_tokens WHERE token_hash = ?`, hash); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListAPITokens 查询用户的 API 令牌（含已吊销、已过期的）
+func ListAPITokens(userID uint) ([]model.APIToken, error) {
+	tokens := []model.APIToken{}
+	err := db.Select(&tokens, `SELECT `+apiTokenColumns+` FROM api_tokens WHERE user_id = ? ORDER BY id DESC`, userID)
+	return tokens, err
+}
+
+// RevokeAPIToken 吊销用户的某个 API 令牌
+func RevokeAPIToken(userID, id uint) error {
+	result, err := db.Exec(`UPDATE api_tokens SET revoked_at = IFNULL(revoked_at, NOW()) WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var exists int
+		if err := db.Get(&exists, `SELECT COUNT(*) FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID); err != nil {
+			return err
+		}
+		if exists == 0 {
+			return sql.ErrNoRows
+		}
+	}
+	return nil
+}
+
+// TouchAPIToken 记录令牌最近一次使用
+func TouchAPIToken(id uint, ip string, at time.Time) error {
+	_, err := db.Exec(`UPDATE api_tokens SET last_used_at = ?, last_used_ip = ? WHERE id = ?`, at, ip, id)
+	return err
+}
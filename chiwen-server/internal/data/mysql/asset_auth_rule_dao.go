@@ -0,0 +1,91 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/chiwen/server/internal/data/model"
+	"go.uber.org/zap"
+)
+
+const assetAuthRuleColumns = `
+	id, name, user_ids, group_ids, asset_ids, asset_labels, host_accounts,
+	valid_from, valid_until, enabled,
+	IFNULL(description, '') AS description, IFNULL(created_by, '') AS created_by,
+	created_at, updated_at`
+
+// ListAssetAuthRules 查询所有资产授权规则
+func ListAssetAuthRules() ([]model.AssetAuthRule, error) {
+	rules := []model.AssetAuthRule{}
+	err := db.Select(&rules, `SELECT `+assetAuthRuleColumns+` FROM asset_auth_rules ORDER BY id ASC`)
+	return rules, err
+}
+
+// ListEnabledAssetAuthRules 查询启用的资产授权规则（有效时间由调用方判断）
+func ListEnabledAssetAuthRules() ([]model.AssetAuthRule, error) {
+	rules := []model.AssetAuthRule{}
+	err := db.Select(&rules, `SELECT `+assetAuthRuleColumns+` FROM asset_auth_rules WHERE enabled = 1 ORDER BY id ASC`)
+	return rules, err
+}
+
+// GetAssetAuthRule 查询单条资产授权规则
+func GetAssetAuthRule(id int64) (*model.AssetAuthRule, error) {
+	var rule model.AssetAuthRule
+	err := db.Get(&rule, `SELECT `+assetAuthRuleColumns+` FROM asset_auth_rules WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// CreateAssetAuthRule 新增资产授权规则
+func CreateAssetAuthRule(rule *model.AssetAuthRule) error {
+	result, err := db.NamedExec(`
+		INSERT INTO asset_auth_rules
+			(name, user_ids, group_ids, asset_ids, asset_labels, host_accounts,
+			 valid_from, valid_until, enabled, description, created_by)
+		VALUES
+			(:name, :user_ids, :group_ids, :asset_ids, :asset_labels, :host_accounts,
+			 :valid_from, :valid_until, :enabled, :description, :created_by)`,
+		rule)
+	if err != nil {
+		zap.L().Error("CreateAssetAuthRule failed", zap.String("name", rule.Name), zap.Error(err))
+		return err
+	}
+	rule.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// UpdateAssetAuthRule 更新资产授权规则
+func UpdateAssetAuthRule(rule *model.AssetAuthRule) error {
+	result, err := db.NamedExec(`
+		UPDATE asset_auth_rules
+		SET name = :name, user_ids = :user_ids, group_ids = :group_ids,
+		    asset_ids = :asset_ids, asset_labels = :asset_labels, host_accounts = :host_accounts,
+		    valid_from = :valid_from, valid_until = :valid_until,
+		    enabled = :enabled, description = :description
+		WHERE id = :id`,
+		rule)
+	if err != nil {
+		zap.L().Error("UpdateAssetAuthRule failed", zap.Int64("id", rule.ID), zap.Error(err))
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := GetAssetAuthRule(rule.ID); errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteAssetAuthRule 删除资产授权规则
+func DeleteAssetAuthRule(id int64) error {
+	result, err := db.Exec(`DELETE FROM asset_auth_rules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package mysql
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/chiwen/server/internal/data/model"
+	"go.uber.org/zap"
+)
+
+const auditEventColumns = `id, actor_id, actor, action, method, path, resource_type, resource_id,
+	before_data, after_data, diff, status_code, client_ip, created_at`
+
+// jsonValue 空的 JSON 写入 NULL
+func jsonValue(v json.RawMessage) interface{} {
+	if len(v) == 0 {
+		return nil
+	}
+	return string(v)
+}
+
+// CreateAuditEvent 写入审计事件
+func CreateAuditEvent(e *model.AuditEvent) error {
+	_, err := db.Exec(`
+		INSERT INTO audit_events (actor_id, actor, action, method, path, resource_type, resource_id,
+		    before_data, after_data, diff, status_code, client_ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ActorID, e.Actor, e.Action, e.Method, e.Path, e.ResourceType, e.ResourceID,
+		jsonValue(e.Before), jsonValue(e.After), jsonValue(e.Diff), e.StatusCode, e.ClientIP)
+	if err != nil {
+		zap.L().Error("CreateAuditEvent failed", zap.String("action", e.Action), zap.String("actor", e.Actor), zap.Error(err))
+	}
+	return err
+}
+
+func auditWhere(f model.AuditFilter) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if f.Actor != "" {
+		conds = append(conds, "actor = ?")
+		args = append(args, f.Actor)
+	}
+	if f.Action != "" {
+		conds = append(conds, "action LIKE ?")
+		args = append(args, "%"+f.Action+"%")
+	}
+	if f.ResourceType != "" {
+		conds = append(conds, "resource_type = ?")
+		args = append(args, f.ResourceType)
+	}
+	if f.ResourceID != "" {
+		conds = append(conds, "resource_id = ?")
+		args = append(args, f.ResourceID)
+	}
+	if f.Start != nil {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, *f.Start)
+	}
+	if f.End != nil {
+		conds = append(conds, "created_at < ?")
+		args = append(args, *f.End)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// ListAuditEvents 分页查询审计事件，按时间倒序
+func ListAuditEvents(f model.AuditFilter) ([]model.AuditEvent, int, error) {
+	where, args := auditWhere(f)
+	var total int
+	if err := db.Get(&total, `SELECT COUNT(*) FROM audit_events`+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	events := []model.AuditEvent{}
+	err := db.Select(&events, `SELECT `+auditEventColumns+` FROM audit_events`+where+`
+		ORDER BY id DESC LIMIT ? OFFSET ?`,
+		append(args, f.PageSize, (f.Page-1)*f.PageSize)...)
+	return events, total, err
+}
+
+// EachAuditEvent 按时间顺序逐条读取审计事件（导出用，不一次性加载到内存），最多 limit 条
+func EachAuditEvent(f model.AuditFilter, limit int, fn func(*model.AuditEvent) error) error {
+	where, args := auditWhere(f)
+	rows, err := db.Queryx(`SELECT `+auditEventColumns+` FROM audit_events`+where+` ORDER BY id ASC LIMIT ?`,
+		append(args, limit)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e model.AuditEvent
+		if err := rows.StructScan(&e); err != nil {
+			return err
+		}
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
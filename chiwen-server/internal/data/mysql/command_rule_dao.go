@@ -0,0 +1,148 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/chiwen/server/internal/data/model"
+	"go.uber.org/zap"
+)
+
+const commandRuleColumns = `
+	id, name, pattern, action, asset_labels, user_ids, group_ids, priority, enabled,
+	IFNULL(description, '') AS description, IFNULL(created_by, '') AS created_by,
+	created_at, updated_at`
+
+// ListCommandRules 查询所有命令规则，按优先级从高到低
+func ListCommandRules() ([]model.CommandRule, error) {
+	rules := []model.CommandRule{}
+	err := db.Select(&rules, `SELECT `+commandRuleColumns+` FROM command_rules ORDER BY priority DESC, id ASC`)
+	return rules, err
+}
+
+// GetCommandRule 查询单条命令规则
+func GetCommandRule(id int64) (*model.CommandRule, error) {
+	var rule model.CommandRule
+	err := db.Get(&rule, `SELECT `+commandRuleColumns+` FROM command_rules WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// CreateCommandRule 新增命令规则
+func CreateCommandRule(rule *model.CommandRule) error {
+	result, err := db.NamedExec(`
+		INSERT INTO command_rules
+			(name, pattern, action, asset_labels, user_ids, group_ids, priority, enabled, description, created_by)
+		VALUES
+			(:name, :pattern, :action, :asset_labels, :user_ids, :group_ids, :priority, :enabled, :description, :created_by)`,
+		rule)
+	if err != nil {
+		zap.L().Error("CreateCommandRule failed", zap.String("name", rule.Name), zap.Error(err))
+		return err
+	}
+	rule.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// UpdateCommandRule 更新命令规则
+func UpdateCommandRule(rule *model.CommandRule) error {
+	result, err := db.NamedExec(`
+		UPDATE command_rules
+		SET name = :name, pattern = :pattern, action = :action, asset_labels = :asset_labels,
+		    user_ids = :user_ids, group_ids = :group_ids, priority = :priority,
+		    enabled = :enabled, description = :description
+		WHERE id = :id`,
+		rule)
+	if err != nil {
+		zap.L().Error("UpdateCommandRule failed", zap.Int64("id", rule.ID), zap.Error(err))
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := GetCommandRule(rule.ID); errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteCommandRule 删除命令规则
+func DeleteCommandRule(id int64) error {
+	result, err := db.Exec(`DELETE FROM command_rules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreateCommandApproval 新建审批单
+func CreateCommandApproval(a *model.CommandApproval) error {
+	_, err := db.NamedExec(`
+		INSERT INTO command_approvals
+			(id, rule_id, rule_name, session_id, asset_id, user_id, command, status, created_at)
+		VALUES
+			(:id, :rule_id, :rule_name, :session_id, :asset_id, :user_id, :command, :status, :created_at)`,
+		a)
+	if err != nil {
+		zap.L().Error("CreateCommandApproval failed", zap.String("id", a.ID), zap.Error(err))
+	}
+	return err
+}
+
+// DecideCommandApproval 把 pending 状态的审批单改为最终状态，返回 false 表示审批单不存在或已被处理
+func DecideCommandApproval(id, status string, approverID *uint, reason string) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE command_approvals
+		SET status = ?, approver_id = ?, reason = ?, decided_at = NOW()
+		WHERE id = ? AND status = 'pending'`,
+		status, approverID, reason, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// GetCommandApproval 查询审批单
+func GetCommandApproval(id string) (*model.CommandApproval, error) {
+	var a model.CommandApproval
+	err := db.Get(&a, `
+		SELECT id, rule_id, IFNULL(rule_name, '') AS rule_name, session_id, asset_id, user_id, command,
+		       status, approver_id, IFNULL(reason, '') AS reason, created_at, decided_at
+		FROM command_approvals WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListCommandApprovals 按状态查询审批单（status 为空时查询全部），最多返回 200 条
+func ListCommandApprovals(status string) ([]model.CommandApproval, error) {
+	query := `
+		SELECT id, rule_id, IFNULL(rule_name, '') AS rule_name, session_id, asset_id, user_id, command,
+		       status, approver_id, IFNULL(reason, '') AS reason, created_at, decided_at
+		FROM command_approvals`
+	var args []interface{}
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at DESC LIMIT 200`
+
+	approvals := []model.CommandApproval{}
+	err := db.Select(&approvals, query, args...)
+	return approvals, err
+}
+
+// ExpirePendingCommandApprovals 服务重启后遗留的 pending 审批单已无人等待，统一标记为过期
+func ExpirePendingCommandApprovals() error {
+	_, err := db.Exec(`
+		UPDATE command_approvals
+		SET status = 'expired', reason = 'server restarted', decided_at = NOW()
+		WHERE status = 'pending'`)
+	return err
+}
@@ -26,7 +26,7 @@ func GetAgentSecretKeyByID(id string) (string, error) {
 		return "", errors.New("agent secret key not found or empty")
 	}
 
-	return secret.String, nil
+	return openAgentSecret(id, colAgentSecret, secret.String)
 }
 
 // GetAssetByID 获取资产信息
@@ -35,7 +35,7 @@ func GetAssetByID(id string) (*model.Asset, error) {
 
 	var a model.Asset
 	query := `SELECT id, client_public_key, hostname, labels, allowed_users, static_info, dynamic_info, status, 
-	                 created_at, updated_at, is_deleted 
+	                 created_at, updated_at, is_deleted, agent_state, agent_state_reason, clock_skew_seconds 
 	          FROM assets WHERE id = ? AND is_deleted = 0`
 
 	err := db.Get(&a, query, id)
@@ -156,13 +156,19 @@ func UpdateAssetHeartbeat(id string) error {
 	return nil
 }
 
+// UpdateAgentClockSkew 记录 Agent 时钟偏差（秒）
+func UpdateAgentClockSkew(id string, skew int64) error {
+	_, err := db.Exec(`UPDATE assets SET clock_skew_seconds = ?, updated_at = updated_at WHERE id = ?`, skew, id)
+	return err
+}
+
 // GetAssetsList 获取资产列表
 func GetAssetsList() ([]model.Asset, error) {
 	zap.L().Debug("GetAssetsList called")
 
 	var assets []model.Asset
 	query := `SELECT id, client_public_key, hostname, labels, allowed_users, static_info, dynamic_info, status, 
-	                 created_at, updated_at, is_deleted 
+	                 created_at, updated_at, is_deleted, agent_state, agent_state_reason, clock_skew_seconds 
 	          FROM assets WHERE is_deleted = 0 ORDER BY updated_at DESC`
 
 	err := db.Select(&assets, query)
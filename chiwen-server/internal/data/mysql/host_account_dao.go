@@ -0,0 +1,117 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/chiwen/server/internal/data/model"
+	driver "github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+)
+
+const hostAccountColumns = `
+	id, asset_id, os_username, user_ids, group_ids, is_default, enabled,
+	IFNULL(description, '') AS description, IFNULL(created_by, '') AS created_by,
+	created_at, updated_at`
+
+// ListHostAccounts 查询资产上的账号，默认账号排在前面
+func ListHostAccounts(assetID string) ([]model.HostAccount, error) {
+	accounts := []model.HostAccount{}
+	err := db.Select(&accounts, `SELECT `+hostAccountColumns+`
+		FROM host_accounts WHERE asset_id = ?
+		ORDER BY is_default DESC, os_username ASC`, assetID)
+	return accounts, err
+}
+
+// GetHostAccount 查询单个账号
+func GetHostAccount(id int64) (*model.HostAccount, error) {
+	var account model.HostAccount
+	err := db.Get(&account, `SELECT `+hostAccountColumns+` FROM host_accounts WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// CreateHostAccount 新增账号；设为默认账号时取消同一资产上其他账号的默认标记
+func CreateHostAccount(a *model.HostAccount) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if a.IsDefault {
+		if _, err := tx.Exec(`UPDATE host_accounts SET is_default = 0 WHERE asset_id = ?`, a.AssetID); err != nil {
+			return err
+		}
+	}
+	result, err := tx.NamedExec(`
+		INSERT INTO host_accounts
+			(asset_id, os_username, user_ids, group_ids, is_default, enabled, description, created_by)
+		VALUES
+			(:asset_id, :os_username, :user_ids, :group_ids, :is_default, :enabled, :description, :created_by)`,
+		a)
+	if err != nil {
+		zap.L().Error("CreateHostAccount failed",
+			zap.String("asset_id", a.AssetID),
+			zap.String("os_username", a.OSUsername),
+			zap.Error(err))
+		return err
+	}
+	a.ID, _ = result.LastInsertId()
+	return tx.Commit()
+}
+
+// UpdateHostAccount 更新账号（asset_id 不可修改）
+func UpdateHostAccount(a *model.HostAccount) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if a.IsDefault {
+		if _, err := tx.Exec(`UPDATE host_accounts SET is_default = 0 WHERE asset_id = ? AND id != ?`, a.AssetID, a.ID); err != nil {
+			return err
+		}
+	}
+	result, err := tx.NamedExec(`
+		UPDATE host_accounts
+		SET os_username = :os_username, user_ids = :user_ids, group_ids = :group_ids,
+		    is_default = :is_default, enabled = :enabled, description = :description
+		WHERE id = :id AND asset_id = :asset_id`,
+		a)
+	if err != nil {
+		zap.L().Error("UpdateHostAccount failed", zap.Int64("id", a.ID), zap.Error(err))
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var exists int
+		if err := tx.Get(&exists, `SELECT COUNT(*) FROM host_accounts WHERE id = ? AND asset_id = ?`, a.ID, a.AssetID); err != nil {
+			return err
+		}
+		if exists == 0 {
+			return sql.ErrNoRows
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteHostAccount 删除账号
+func DeleteHostAccount(assetID string, id int64) error {
+	result, err := db.Exec(`DELETE FROM host_accounts WHERE id = ? AND asset_id = ?`, id, assetID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// IsDuplicateEntry 判断是否为唯一键冲突（MySQL 1062）
+func IsDuplicateEntry(err error) bool {
+	var me *driver.MySQLError
+	return errors.As(err, &me) && me.Number == 1062
+}
@@ -0,0 +1,133 @@
+package mysql
+
+import (
+	"strings"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"go.uber.org/zap"
+)
+
+// CreateLoginLog 写入一条登录日志
+func CreateLoginLog(l *model.LoginLog) error {
+	_, err := db.Exec(`
+		INSERT INTO login_logs (user_id, username, client_ip, user_agent, result, reason, mfa_used)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		l.UserID, l.Username, l.ClientIP, l.UserAgent, l.Result, l.Reason, l.MFAUsed)
+	if err != nil {
+		zap.L().Error("CreateLoginLog failed", zap.String("username", l.Username), zap.Error(err))
+	}
+	return err
+}
+
+// ListLoginLogs 分页查询登录日志，按时间倒序
+func ListLoginLogs(f model.LoginLogFilter) ([]model.LoginLog, int, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if f.UserID != 0 {
+		conds = append(conds, "user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.Username != "" {
+		conds = append(conds, "username = ?")
+		args = append(args, f.Username)
+	}
+	if f.ClientIP != "" {
+		conds = append(conds, "client_ip = ?")
+		args = append(args, f.ClientIP)
+	}
+	if f.Result != "" {
+		conds = append(conds, "result = ?")
+		args = append(args, f.Result)
+	}
+	if f.Start != nil {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, *f.Start)
+	}
+	if f.End != nil {
+		conds = append(conds, "created_at < ?")
+		args = append(args, *f.End)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := db.Get(&total, `SELECT COUNT(*) FROM login_logs`+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	logs := []model.LoginLog{}
+	err := db.Select(&logs, `
+		SELECT id, user_id, username, client_ip, user_agent, result, reason, mfa_used, created_at
+		FROM login_logs`+where+` ORDER BY id DESC LIMIT ? OFFSET ?`,
+		append(args, f.PageSize, (f.Page-1)*f.PageSize)...)
+	return logs, total, err
+}
+
+// GetUserLoginState 按用户名查询登录保护状态
+func GetUserLoginState(username string) (*model.UserLoginState, error) {
+	var s model.UserLoginState
+	err := db.Get(&s, `
+		SELECT id, failed_login_count, locked_until, login_ips, bind_login_ip
+		FROM users WHERE username = ?`, username)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// IncrLoginFailures 累加连续失败次数，达到 maxFailures 时锁定到 lockUntil 并清零计数，返回是否被锁定
+func IncrLoginFailures(userID uint, maxFailures int, lockUntil time.Time) (bool, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.Get(&count, `SELECT failed_login_count FROM users WHERE id = ? FOR UPDATE`, userID); err != nil {
+		return false, err
+	}
+	count++
+	locked := maxFailures > 0 && count >= maxFailures
+	if locked {
+		_, err = tx.Exec(`UPDATE users SET failed_login_count = 0, locked_until = ? WHERE id = ?`, lockUntil, userID)
+	} else {
+		_, err = tx.Exec(`UPDATE users SET failed_login_count = ? WHERE id = ?`, count, userID)
+	}
+	if err != nil {
+		return false, err
+	}
+	return locked, tx.Commit()
+}
+
+// ResetLoginFailures 登录成功或管理员解锁时清除失败计数和锁定
+func ResetLoginFailures(userID uint) error {
+	result, err := db.Exec(`UPDATE users SET failed_login_count = 0, locked_until = NULL WHERE id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	return checkUserAffected(result, userID)
+}
+
+// SetUserLoginIPs 设置用户的登录 IP 白名单和绑定选项
+func SetUserLoginIPs(userID uint, ips model.StringList, bind bool) error {
+	result, err := db.Exec(`UPDATE users SET login_ips = ?, bind_login_ip = ? WHERE id = ?`, ips, bind, userID)
+	if err != nil {
+		return err
+	}
+	return checkUserAffected(result, userID)
+}
+
+// BindUserLoginIP 开启绑定且尚未登记 IP 时，把本次登录 IP 写入白名单
+func BindUserLoginIP(userID uint, ip string) error {
+	_, err := db.Exec(`
+		UPDATE users SET login_ips = JSON_ARRAY(?)
+		WHERE id = ? AND bind_login_ip = 1 AND (login_ips IS NULL OR JSON_LENGTH(login_ips) = 0)`,
+		ip, userID)
+	return err
+}
@@ -0,0 +1,92 @@
+package mysql
+
+import (
+	"github.com/chiwen/server/internal/data/model"
+	"go.uber.org/zap"
+)
+
+const userMFAColumns = `user_id, secret, enabled, last_used_step, recovery_codes, enabled_at, created_at, updated_at`
+
+// GetUserMFA 查询用户的 TOTP 配置
+func GetUserMFA(userID uint) (*model.UserMFA, error) {
+	var m model.UserMFA
+	if err := db.Get(&m, `SELECT `+userMFAColumns+` FROM user_mfa WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// SaveMFAEnrollment 保存待验证的新密钥（重新绑定时覆盖旧配置，验证前不启用）
+func SaveMFAEnrollment(userID uint, secret string) error {
+	_, err := db.Exec(`
+		INSERT INTO user_mfa (user_id, secret, enabled, last_used_step, recovery_codes)
+		VALUES (?, ?, 0, 0, '[]')
+		ON DUPLICATE KEY UPDATE secret = VALUES(secret), enabled = 0, last_used_step = 0,
+		    recovery_codes = '[]', enabled_at = NULL`,
+		userID, secret)
+	if err != nil {
+		zap.L().Error("SaveMFAEnrollment failed", zap.Uint("user_id", userID), zap.Error(err))
+	}
+	return err
+}
+
+// EnableMFA 首个验证码校验通过后启用，并写入恢复码哈希
+func EnableMFA(userID uint, step int64, recoveryHashes []string) error {
+	_, err := db.Exec(`
+		UPDATE user_mfa SET enabled = 1, enabled_at = NOW(), last_used_step = ?, recovery_codes = ?
+		WHERE user_id = ?`,
+		step, model.StringList(recoveryHashes), userID)
+	return err
+}
+
+// UseMFAStep 记录已使用的时间步；只有 step 大于已记录的值才会成功，返回是否成功（防止并发重放）
+func UseMFAStep(userID uint, step int64) (bool, error) {
+	result, err := db.Exec(`UPDATE user_mfa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n == 1, nil
+}
+
+// UseRecoveryCode 消费一个恢复码（按哈希移除），返回是否存在
+func UseRecoveryCode(userID uint, hash string) (bool, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var codes model.StringList
+	if err := tx.Get(&codes, `SELECT recovery_codes FROM user_mfa WHERE user_id = ? AND enabled = 1 FOR UPDATE`, userID); err != nil {
+		return false, err
+	}
+	remaining := make(model.StringList, 0, len(codes))
+	found := false
+	for _, c := range codes {
+		if !found && c == hash {
+			found = true
+			continue
+		}
+		remaining = append(remaining, c)
+	}
+	if !found {
+		return false, nil
+	}
+	if _, err := tx.Exec(`UPDATE user_mfa SET recovery_codes = ? WHERE user_id = ?`, remaining, userID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ReplaceRecoveryCodes 重新生成恢复码
+func ReplaceRecoveryCodes(userID uint, hashes []string) error {
+	_, err := db.Exec(`UPDATE user_mfa SET recovery_codes = ? WHERE user_id = ?`, model.StringList(hashes), userID)
+	return err
+}
+
+// DeleteUserMFA 关闭并删除用户的 TOTP 配置
+func DeleteUserMFA(userID uint) error {
+	_, err := db.Exec(`DELETE FROM user_mfa WHERE user_id = ?`, userID)
+	return err
+}
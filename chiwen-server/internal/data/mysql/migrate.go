@@ -0,0 +1,124 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// migrateSchema 对已有的表做增量变更（新增列、扩展枚举等），可重复执行
+func migrateSchema() error {
+	// tty_sessions.status 增加 detached（浏览器断线、会话保留中）
+	if err := ensureEnumValue("tty_sessions", "status", "detached",
+		`ALTER TABLE tty_sessions MODIFY status enum('pending','connected','detached','closed','error')
+			CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci DEFAULT 'pending' COMMENT '会话状态'`); err != nil {
+		return err
+	}
+
+	// 终端令牌和会话记录使用的主机账号
+	if err := addColumnIfNotExists("tty_tokens", "os_account",
+		`ALTER TABLE tty_tokens ADD COLUMN os_account varchar(32) COLLATE utf8mb4_unicode_ci DEFAULT '' COMMENT '目标主机账号，空表示 Agent 运行账号'`); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("tty_sessions", "os_account",
+		`ALTER TABLE tty_sessions ADD COLUMN os_account varchar(32) COLLATE utf8mb4_unicode_ci DEFAULT '' COMMENT '目标主机账号，空表示 Agent 运行账号'`); err != nil {
+		return err
+	}
+
+	// 用户令牌吊销时间：此时间之前签发的访问令牌全部失效（退出所有会话、禁用用户）
+	if err := addColumnIfNotExists("users", "tokens_revoked_at",
+		`ALTER TABLE users ADD COLUMN tokens_revoked_at datetime(3) DEFAULT NULL COMMENT '此时间之前签发的令牌全部失效'`); err != nil {
+		return err
+	}
+
+	// 登录保护：连续失败锁定、登录 IP 白名单/绑定
+	for _, col := range []struct{ name, sql string }{
+		{"failed_login_count", `ALTER TABLE users ADD COLUMN failed_login_count int NOT NULL DEFAULT '0' COMMENT '连续登录失败次数'`},
+		{"locked_until", `ALTER TABLE users ADD COLUMN locked_until datetime DEFAULT NULL COMMENT '账号锁定截止时间'`},
+		{"login_ips", `ALTER TABLE users ADD COLUMN login_ips json DEFAULT NULL COMMENT '允许登录的 IP/CIDR，为空不限制'`},
+		{"bind_login_ip", `ALTER TABLE users ADD COLUMN bind_login_ip tinyint(1) NOT NULL DEFAULT '0' COMMENT '首次登录时绑定登录 IP'`},
+	} {
+		if err := addColumnIfNotExists("users", col.name, col.sql); err != nil {
+			return err
+		}
+	}
+
+	// Agent 密钥在线轮换：过渡期内新旧密钥同时有效
+	for _, col := range []struct{ name, sql string }{
+		{"agent_secret_prev", `ALTER TABLE assets ADD COLUMN agent_secret_prev text COLLATE utf8mb4_unicode_ci COMMENT '轮换前的 secret，过渡期内仍有效'`},
+		{"agent_secret_prev_expires_at", `ALTER TABLE assets ADD COLUMN agent_secret_prev_expires_at datetime DEFAULT NULL COMMENT '旧 secret 失效时间'`},
+		{"agent_secret_pending", `ALTER TABLE assets ADD COLUMN agent_secret_pending text COLLATE utf8mb4_unicode_ci COMMENT '已下发、等待 Agent 确认的新 secret'`},
+		{"agent_secret_pending_id", `ALTER TABLE assets ADD COLUMN agent_secret_pending_id varchar(64) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '轮换ID'`},
+		{"agent_secret_pending_expires_at", `ALTER TABLE assets ADD COLUMN agent_secret_pending_expires_at datetime DEFAULT NULL COMMENT '新 secret 等待确认的截止时间'`},
+		{"agent_secret_rotated_at", `ALTER TABLE assets ADD COLUMN agent_secret_rotated_at datetime DEFAULT NULL COMMENT '最近一次轮换完成时间'`},
+		// Agent 重新注册：请求时间戳只增不减，防止重放
+		{"last_reenroll_ts", `ALTER TABLE assets ADD COLUMN last_reenroll_ts bigint NOT NULL DEFAULT '0' COMMENT '最近一次重新注册请求的时间戳'`},
+		{"reenrolled_at", `ALTER TABLE assets ADD COLUMN reenrolled_at datetime DEFAULT NULL COMMENT '最近一次重新注册（更换公钥）时间'`},
+		// Agent 隔离与吊销
+		{"agent_state", `ALTER TABLE assets ADD COLUMN agent_state varchar(16) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT 'active' COMMENT 'Agent 状态：active/quarantined/revoked'`},
+		{"agent_state_reason", `ALTER TABLE assets ADD COLUMN agent_state_reason varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '隔离或吊销原因'`},
+		{"agent_state_changed_by", `ALTER TABLE assets ADD COLUMN agent_state_changed_by varchar(64) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '最近一次修改 Agent 状态的用户'`},
+		{"agent_state_changed_at", `ALTER TABLE assets ADD COLUMN agent_state_changed_at datetime DEFAULT NULL COMMENT '最近一次修改 Agent 状态的时间'`},
+		// Agent 时钟偏差（Agent 时间 - 服务端时间，秒）
+		{"clock_skew_seconds", `ALTER TABLE assets ADD COLUMN clock_skew_seconds int DEFAULT NULL COMMENT 'Agent 时钟偏差（秒），正数表示 Agent 时间超前'`},
+	} {
+		if err := addColumnIfNotExists("assets", col.name, col.sql); err != nil {
+			return err
+		}
+	}
+
+	zap.L().Info("Schema migrations applied")
+	return nil
+}
+
+// columnType 查询列类型（如 enum('a','b')、varchar(64)），列不存在时返回空串
+func columnType(table, column string) (string, error) {
+	var types []string
+	err := db.Select(&types, `
+		SELECT COLUMN_TYPE FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`,
+		table, column)
+	if err != nil || len(types) == 0 {
+		return "", err
+	}
+	return types[0], nil
+}
+
+// addColumnIfNotExists 表存在但缺少列时执行 alterSQL
+func addColumnIfNotExists(table, column, alterSQL string) error {
+	typ, err := columnType(table, column)
+	if err != nil {
+		return fmt.Errorf("query %s.%s type failed: %w", table, column, err)
+	}
+	if typ != "" {
+		return nil
+	}
+	var tables int
+	if err := db.Get(&tables, `
+		SELECT COUNT(*) FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`, table); err != nil || tables == 0 {
+		return err
+	}
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("alter %s add %s failed: %w", table, column, err)
+	}
+	zap.L().Info("Column added", zap.String("table", table), zap.String("column", column))
+	return nil
+}
+
+// ensureEnumValue 枚举列缺少 value 时执行 alterSQL
+func ensureEnumValue(table, column, value, alterSQL string) error {
+	typ, err := columnType(table, column)
+	if err != nil {
+		return fmt.Errorf("query %s.%s type failed: %w", table, column, err)
+	}
+	if typ == "" || !strings.HasPrefix(typ, "enum(") || strings.Contains(typ, "'"+value+"'") {
+		return nil
+	}
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("alter %s.%s failed: %w", table, column, err)
+	}
+	zap.L().Info("Enum column extended", zap.String("table", table), zap.String("column", column), zap.String("value", value))
+	return nil
+}
@@ -49,6 +49,12 @@ func InitDB() (err error) {
 		return err
 	}
 
+	// 已有表的增量变更
+	if err := migrateSchema(); err != nil {
+		zap.L().Error("migrate schema failed", zap.Error(err))
+		return err
+	}
+
 	return nil
 }
 
@@ -98,6 +104,357 @@ func createTablesIfNotExist() error {
 		return fmt.Errorf("insert admin user failed: %w", err)
 	}
 
+	// 创建 tty_commands 表（会话命令索引）
+	ttyCommandsTableSQL := `
+	CREATE TABLE IF NOT EXISTS tty_commands (
+		id bigint unsigned NOT NULL AUTO_INCREMENT,
+		session_id varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '会话ID',
+		asset_id varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '机器ID',
+		user_id varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '用户ID',
+		executed_at datetime(3) NOT NULL COMMENT '回车时间',
+		command text COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '命令行',
+		partial tinyint(1) NOT NULL DEFAULT '0' COMMENT '命令行还原不完整',
+		exit_code int DEFAULT NULL COMMENT '退出码（无法检测时为 NULL）',
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (id),
+		KEY idx_session_id (session_id),
+		KEY idx_asset_time (asset_id, executed_at),
+		KEY idx_user_time (user_id, executed_at),
+		KEY idx_executed_at (executed_at),
+		FULLTEXT KEY ft_command (command) WITH PARSER ngram
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='TTY会话命令索引';
+	`
+	if _, err := db.Exec(ttyCommandsTableSQL); err != nil {
+		return fmt.Errorf("create tty_commands table failed: %w", err)
+	}
+
+	// 用户组及成员（命令规则、授权规则按用户组匹配）
+	userGroupsTableSQL := `
+	CREATE TABLE IF NOT EXISTS user_groups (
+		id int unsigned NOT NULL AUTO_INCREMENT,
+		name varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+		description varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (id),
+		UNIQUE KEY uk_name (name)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='用户组';
+	`
+	if _, err := db.Exec(userGroupsTableSQL); err != nil {
+		return fmt.Errorf("create user_groups table failed: %w", err)
+	}
+
+	userGroupMembersTableSQL := `
+	CREATE TABLE IF NOT EXISTS user_group_members (
+		group_id int unsigned NOT NULL,
+		user_id int unsigned NOT NULL,
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (group_id, user_id),
+		KEY idx_user_id (user_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='用户组成员';
+	`
+	if _, err := db.Exec(userGroupMembersTableSQL); err != nil {
+		return fmt.Errorf("create user_group_members table failed: %w", err)
+	}
+
+	// 命令拦截规则与审批单
+	commandRulesTableSQL := `
+	CREATE TABLE IF NOT EXISTS command_rules (
+		id bigint unsigned NOT NULL AUTO_INCREMENT,
+		name varchar(128) COLLATE utf8mb4_unicode_ci NOT NULL,
+		pattern varchar(1024) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '正则表达式',
+		action enum('deny','confirm') COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT 'deny',
+		asset_labels json DEFAULT NULL COMMENT '资产标签选择器，空表示所有资产',
+		user_ids json DEFAULT NULL COMMENT '用户ID列表，与 group_ids 都为空表示所有用户',
+		group_ids json DEFAULT NULL COMMENT '用户组ID列表',
+		priority int NOT NULL DEFAULT '0' COMMENT '越大越先匹配',
+		enabled tinyint(1) NOT NULL DEFAULT '1',
+		description varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		created_by varchar(64) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (id),
+		KEY idx_enabled_priority (enabled, priority)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='命令拦截规则';
+	`
+	if _, err := db.Exec(commandRulesTableSQL); err != nil {
+		return fmt.Errorf("create command_rules table failed: %w", err)
+	}
+
+	commandApprovalsTableSQL := `
+	CREATE TABLE IF NOT EXISTS command_approvals (
+		id varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+		rule_id bigint unsigned NOT NULL,
+		rule_name varchar(128) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		session_id varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+		asset_id varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+		user_id varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+		command text COLLATE utf8mb4_unicode_ci NOT NULL,
+		status enum('pending','approved','rejected','expired') COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT 'pending',
+		approver_id int unsigned DEFAULT NULL,
+		reason varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		decided_at timestamp NULL DEFAULT NULL,
+		PRIMARY KEY (id),
+		KEY idx_status (status),
+		KEY idx_session_id (session_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='命令审批单';
+	`
+	if _, err := db.Exec(commandApprovalsTableSQL); err != nil {
+		return fmt.Errorf("create command_approvals table failed: %w", err)
+	}
+
+	// 资产上的操作系统账号
+	hostAccountsTableSQL := `
+	CREATE TABLE IF NOT EXISTS host_accounts (
+		id bigint unsigned NOT NULL AUTO_INCREMENT,
+		asset_id varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+		os_username varchar(32) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '目标主机上的系统账号',
+		user_ids json DEFAULT NULL COMMENT '可使用的用户ID列表，与 group_ids 都为空表示所有用户',
+		group_ids json DEFAULT NULL COMMENT '可使用的用户组ID列表',
+		is_default tinyint(1) NOT NULL DEFAULT '0' COMMENT '未指定账号时优先使用',
+		enabled tinyint(1) NOT NULL DEFAULT '1',
+		description varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		created_by varchar(64) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (id),
+		UNIQUE KEY uk_asset_os_username (asset_id, os_username)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='主机账号';
+	`
+	if _, err := db.Exec(hostAccountsTableSQL); err != nil {
+		return fmt.Errorf("create host_accounts table failed: %w", err)
+	}
+
+	// 资产授权规则
+	assetAuthRulesTableSQL := `
+	CREATE TABLE IF NOT EXISTS asset_auth_rules (
+		id bigint unsigned NOT NULL AUTO_INCREMENT,
+		name varchar(128) COLLATE utf8mb4_unicode_ci NOT NULL,
+		user_ids json DEFAULT NULL COMMENT '授权的用户ID列表',
+		group_ids json DEFAULT NULL COMMENT '授权的用户组ID列表',
+		asset_ids json DEFAULT NULL COMMENT '授权的资产ID列表',
+		asset_labels json DEFAULT NULL COMMENT '资产标签选择器，与 asset_ids 满足其一即可',
+		host_accounts json DEFAULT NULL COMMENT '可使用的主机账号，空表示不限',
+		valid_from datetime DEFAULT NULL COMMENT '生效时间，空表示立即生效',
+		valid_until datetime DEFAULT NULL COMMENT '失效时间，空表示永久',
+		enabled tinyint(1) NOT NULL DEFAULT '1',
+		description varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		created_by varchar(64) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (id),
+		KEY idx_enabled (enabled)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='资产授权规则';
+	`
+	if _, err := db.Exec(assetAuthRulesTableSQL); err != nil {
+		return fmt.Errorf("create asset_auth_rules table failed: %w", err)
+	}
+
+	// 系统设置（JSON 值，如 MFA 策略）
+	systemSettingsTableSQL := `
+	CREATE TABLE IF NOT EXISTS system_settings (
+		name varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+		value json NOT NULL,
+		updated_by varchar(64) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		updated_at timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (name)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='系统设置';
+	`
+	if _, err := db.Exec(systemSettingsTableSQL); err != nil {
+		return fmt.Errorf("create system_settings table failed: %w", err)
+	}
+
+	// 用户 TOTP 多因素认证
+	userMFATableSQL := `
+	CREATE TABLE IF NOT EXISTS user_mfa (
+		user_id int unsigned NOT NULL,
+		secret varchar(128) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT 'TOTP 密钥（base32）',
+		enabled tinyint(1) NOT NULL DEFAULT '0' COMMENT '验证首个验证码后启用',
+		last_used_step bigint NOT NULL DEFAULT '0' COMMENT '最近一次使用的时间步，防止验证码重放',
+		recovery_codes json DEFAULT NULL COMMENT '恢复码的 SHA-256 哈希',
+		enabled_at timestamp NULL DEFAULT NULL,
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='用户多因素认证';
+	`
+	if _, err := db.Exec(userMFATableSQL); err != nil {
+		return fmt.Errorf("create user_mfa table failed: %w", err)
+	}
+
+	// 刷新令牌（只保存哈希），每次刷新轮换，同一次登录派生的令牌属于同一条令牌链
+	refreshTokensTableSQL := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id bigint unsigned NOT NULL AUTO_INCREMENT,
+		token_hash char(64) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '刷新令牌的 SHA-256',
+		family_id char(32) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '令牌链ID，检测到重放时整条链作废',
+		user_id int unsigned NOT NULL,
+		access_jti varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '同时签发的访问令牌ID',
+		client_ip varchar(45) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		user_agent varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		expires_at datetime NOT NULL,
+		used_at datetime DEFAULT NULL COMMENT '已轮换，再次使用视为重放',
+		revoked_at datetime DEFAULT NULL,
+		revoke_reason varchar(64) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (id),
+		UNIQUE KEY uk_token_hash (token_hash),
+		KEY idx_family_id (family_id),
+		KEY idx_user_id (user_id),
+		KEY idx_access_jti (access_jti),
+		KEY idx_expires_at (expires_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='刷新令牌';
+	`
+	if _, err := db.Exec(refreshTokensTableSQL); err != nil {
+		return fmt.Errorf("create refresh_tokens table failed: %w", err)
+	}
+
+	// 已吊销的访问令牌（退出登录），过期后清理
+	revokedTokensTableSQL := `
+	CREATE TABLE IF NOT EXISTS revoked_tokens (
+		jti varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+		user_id int unsigned NOT NULL,
+		reason varchar(64) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		expires_at datetime NOT NULL COMMENT '访问令牌原本的过期时间',
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (jti),
+		KEY idx_expires_at (expires_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='已吊销的访问令牌';
+	`
+	if _, err := db.Exec(revokedTokensTableSQL); err != nil {
+		return fmt.Errorf("create revoked_tokens table failed: %w", err)
+	}
+
+	// 登录日志
+	loginLogsTableSQL := `
+	CREATE TABLE IF NOT EXISTS login_logs (
+		id bigint unsigned NOT NULL AUTO_INCREMENT,
+		user_id int unsigned NOT NULL DEFAULT '0' COMMENT '用户不存在时为 0',
+		username varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+		client_ip varchar(45) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		user_agent varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		result enum('success','failure') COLLATE utf8mb4_unicode_ci NOT NULL,
+		reason varchar(128) COLLATE utf8mb4_unicode_ci DEFAULT '' COMMENT '失败原因',
+		mfa_used tinyint(1) NOT NULL DEFAULT '0',
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (id),
+		KEY idx_user_id (user_id),
+		KEY idx_username (username),
+		KEY idx_client_ip (client_ip),
+		KEY idx_created_at (created_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='登录日志';
+	`
+	if _, err := db.Exec(loginLogsTableSQL); err != nil {
+		return fmt.Errorf("create login_logs table failed: %w", err)
+	}
+
+	// 管理操作审计（所有变更类接口）
+	auditEventsTableSQL := `
+	CREATE TABLE IF NOT EXISTS audit_events (
+		id bigint unsigned NOT NULL AUTO_INCREMENT,
+		actor_id int unsigned NOT NULL DEFAULT '0',
+		actor varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+		action varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '方法 + 路由模板',
+		method varchar(10) COLLATE utf8mb4_unicode_ci NOT NULL,
+		path varchar(512) COLLATE utf8mb4_unicode_ci NOT NULL,
+		resource_type varchar(64) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		resource_id varchar(128) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		before_data json DEFAULT NULL COMMENT '变更前的状态',
+		after_data json DEFAULT NULL COMMENT '变更后的状态（默认为脱敏后的请求体）',
+		diff json DEFAULT NULL COMMENT '有变化的字段 {"field":{"before":x,"after":y}}',
+		status_code int NOT NULL DEFAULT '0',
+		client_ip varchar(45) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (id),
+		KEY idx_actor (actor),
+		KEY idx_resource (resource_type, resource_id),
+		KEY idx_created_at (created_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='管理操作审计';
+	`
+	if _, err := db.Exec(auditEventsTableSQL); err != nil {
+		return fmt.Errorf("create audit_events table failed: %w", err)
+	}
+
+	// 角色及其分配（用户、用户组）
+	rolesTableSQL := `
+	CREATE TABLE IF NOT EXISTS roles (
+		id int unsigned NOT NULL AUTO_INCREMENT,
+		name varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+		description varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		permissions json DEFAULT NULL COMMENT '权限点列表 ["asset:read",...]',
+		builtin tinyint(1) NOT NULL DEFAULT '0' COMMENT '内置角色不能删除和改名',
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (id),
+		UNIQUE KEY uk_name (name)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='角色';
+	`
+	if _, err := db.Exec(rolesTableSQL); err != nil {
+		return fmt.Errorf("create roles table failed: %w", err)
+	}
+
+	userRolesTableSQL := `
+	CREATE TABLE IF NOT EXISTS user_roles (
+		user_id int unsigned NOT NULL,
+		role_id int unsigned NOT NULL,
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, role_id),
+		KEY idx_role_id (role_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='用户角色';
+	`
+	if _, err := db.Exec(userRolesTableSQL); err != nil {
+		return fmt.Errorf("create user_roles table failed: %w", err)
+	}
+
+	userGroupRolesTableSQL := `
+	CREATE TABLE IF NOT EXISTS user_group_roles (
+		group_id int unsigned NOT NULL,
+		role_id int unsigned NOT NULL,
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (group_id, role_id),
+		KEY idx_role_id (role_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='用户组角色';
+	`
+	if _, err := db.Exec(userGroupRolesTableSQL); err != nil {
+		return fmt.Errorf("create user_group_roles table failed: %w", err)
+	}
+
+	// 内置角色：default 所有登录用户自动拥有，保持升级前普通用户可查看资产、连接终端的行为
+	insertRolesSQL := `
+	INSERT IGNORE INTO roles (name, description, permissions, builtin) VALUES
+	('default', '所有登录用户自动拥有', '["asset:read","tty:connect"]', 1),
+	('operator', '运维：资产维护、注册审批、命令审批', '["asset:read","asset:update","register:approve","tty:connect","command:approve","session:terminate"]', 1),
+	('auditor', '审计：查看录像、命令、登录日志和操作审计', '["asset:read","session:audit","audit:read"]', 1)
+	`
+	if _, err := db.Exec(insertRolesSQL); err != nil {
+		return fmt.Errorf("insert builtin roles failed: %w", err)
+	}
+
+	// API 令牌（只保存 SHA-256 哈希）
+	apiTokensTableSQL := `
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id int unsigned NOT NULL AUTO_INCREMENT,
+		user_id int unsigned NOT NULL,
+		name varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+		token_prefix varchar(16) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '令牌开头几位，便于辨认',
+		token_hash char(64) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT 'SHA-256(令牌)',
+		scopes json DEFAULT NULL COMMENT '可使用的权限点',
+		expires_at datetime NOT NULL,
+		last_used_at datetime DEFAULT NULL,
+		last_used_ip varchar(45) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		revoked_at datetime DEFAULT NULL,
+		created_by varchar(64) COLLATE utf8mb4_unicode_ci DEFAULT '',
+		created_at timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (id),
+		UNIQUE KEY uk_token_hash (token_hash),
+		KEY idx_user_id (user_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='API令牌';
+	`
+	if _, err := db.Exec(apiTokensTableSQL); err != nil {
+		return fmt.Errorf("create api_tokens table failed: %w", err)
+	}
+
 	zap.L().Info("Tables created/verified successfully")
 	return nil
 }
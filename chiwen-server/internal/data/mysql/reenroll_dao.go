@@ -0,0 +1,49 @@
+package mysql
+
+// GetEnrolledPublicKey 查询未删除资产当前登记的客户端公钥和 Agent 状态，资产不存在时返回 sql.ErrNoRows
+func GetEnrolledPublicKey(assetID string) (pubKey, state string, err error) {
+	var row struct {
+		PubKey string `db:"client_public_key"`
+		State  string `db:"agent_state"`
+	}
+	err = db.Get(&row, `SELECT IFNULL(client_public_key, '') AS client_public_key, agent_state FROM assets WHERE id = ? AND is_deleted = 0`, assetID)
+	return row.PubKey, row.State, err
+}
+
+// ReenrollAsset 重新注册：更换客户端公钥和 Agent 密钥，清除进行中的轮换，资产的标签、授权和历史记录不变。
+// 仅当公钥仍为 oldPubKey 且 ts 大于上次重新注册的时间戳时生效，返回是否生效
+func ReenrollAsset(assetID, oldPubKey, newPubKey, secret string, ts int64) (bool, error) {
+	secret, err := sealAgentSecret(assetID, colAgentSecret, secret)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE assets SET
+			client_public_key = ?,
+			agent_secret_key = ?,
+			agent_secret_prev = NULL, agent_secret_prev_expires_at = NULL,
+			agent_secret_pending = NULL, agent_secret_pending_id = NULL, agent_secret_pending_expires_at = NULL,
+			agent_secret_rotated_at = NOW(),
+			last_reenroll_ts = ?,
+			reenrolled_at = NOW()
+		WHERE id = ? AND is_deleted = 0 AND agent_state <> 'revoked' AND client_public_key = ? AND last_reenroll_ts < ?`,
+		newPubKey, secret, ts, assetID, oldPubKey, ts)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	// 注册状态轮询按申请表中的公钥加密下发密钥，需同步更新
+	if _, err := tx.Exec(`UPDATE agent_register_apply SET client_public_key = ? WHERE id = ?`, newPubKey, assetID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -96,6 +96,11 @@ func DeleteApply(id string) error {
 
 // CreateAsset 写入正式资产表
 func CreateAsset(id, hostname, clientPubKey, agentSecretKey string) (*model.Asset, error) {
+	// 密钥加密后入库（未配置主密钥时为明文）
+	agentSecretKey, err := sealAgentSecret(id, colAgentSecret, agentSecretKey)
+	if err != nil {
+		return nil, err
+	}
 	zap.L().Info("Creating asset record",
 		zap.String("id", id),
 		zap.String("hostname", hostname),
@@ -188,6 +193,11 @@ func CreateAsset(id, hostname, clientPubKey, agentSecretKey string) (*model.Asse
 
 // CreateAssetWithAllowedUsers 写入正式资产表，支持自定义 allowed_users
 func CreateAssetWithAllowedUsers(id, hostname, clientPubKey, agentSecretKey, allowedUsersJSON string) error {
+	// 密钥加密后入库（未配置主密钥时为明文）
+	agentSecretKey, err := sealAgentSecret(id, colAgentSecret, agentSecretKey)
+	if err != nil {
+		return err
+	}
 	// 创建基本的静态信息JSON，包含hostname
 	// 这样前端在客户端发送第一次心跳之前就能显示一些基本信息
 	basicStaticInfo := map[string]interface{}{
@@ -204,7 +214,7 @@ func CreateAssetWithAllowedUsers(id, hostname, clientPubKey, agentSecretKey, all
 	}
 
 	// 解析 allowedUsersJSON 字符串为 JSON 数组
-	// 如果解析失败，使用默认值 JSON_ARRAY(5)
+	// 如果解析失败，使用空数组（访问权限由资产授权规则控制）
 	var allowedUsersParam interface{}
 	if allowedUsersJSON != "" {
 		// 尝试解析为 JSON
@@ -214,11 +224,11 @@ func CreateAssetWithAllowedUsers(id, hostname, clientPubKey, agentSecretKey, all
 			allowedUsersParam = allowedUsersJSON
 		} else {
 			// 解析失败，使用默认值
-			allowedUsersParam = "JSON_ARRAY(5)"
+			allowedUsersParam = "[]"
 		}
 	} else {
 		// 空字符串，使用默认值
-		allowedUsersParam = "JSON_ARRAY(5)"
+		allowedUsersParam = "[]"
 	}
 
 	query := `
@@ -255,6 +265,11 @@ func CreateAssetWithAllowedUsers(id, hostname, clientPubKey, agentSecretKey, all
 
 // CreateAssetWithStaticAndUsers 写入正式资产表，支持自定义 static_info 和 allowed_users
 func CreateAssetWithStaticAndUsers(id, hostname, clientPubKey, agentSecretKey, staticInfoJSON, allowedUsersJSON string) error {
+	// 密钥加密后入库（未配置主密钥时为明文）
+	agentSecretKey, err := sealAgentSecret(id, colAgentSecret, agentSecretKey)
+	if err != nil {
+		return err
+	}
 	// 清理客户端公钥格式
 	cleanPubKey := strings.TrimSpace(clientPubKey)
 
@@ -272,7 +287,7 @@ func CreateAssetWithStaticAndUsers(id, hostname, clientPubKey, agentSecretKey, s
 	}
 
 	// 解析 allowedUsersJSON 字符串为 JSON 数组
-	// 如果解析失败，使用默认值 JSON_ARRAY(5)
+	// 如果解析失败，使用空数组（访问权限由资产授权规则控制）
 	var allowedUsersParam interface{}
 	if allowedUsersJSON != "" {
 		// 尝试解析为 JSON
@@ -282,11 +297,11 @@ func CreateAssetWithStaticAndUsers(id, hostname, clientPubKey, agentSecretKey, s
 			allowedUsersParam = allowedUsersJSON
 		} else {
 			// 解析失败，使用默认值
-			allowedUsersParam = "JSON_ARRAY(5)"
+			allowedUsersParam = "[]"
 		}
 	} else {
 		// 空字符串，使用默认值
-		allowedUsersParam = "JSON_ARRAY(5)"
+		allowedUsersParam = "[]"
 	}
 
 	query := `
@@ -304,7 +319,7 @@ func CreateAssetWithStaticAndUsers(id, hostname, clientPubKey, agentSecretKey, s
 			agent_secret_key = VALUES(agent_secret_key),
 			static_info = VALUES(static_info)
 	`
-	_, err := db.Exec(query, id, hostname, cleanPubKey, `{}`, allowedUsersParam, agentSecretKey, staticInfoJSON, `{}`)
+	_, err = db.Exec(query, id, hostname, cleanPubKey, `{}`, allowedUsersParam, agentSecretKey, staticInfoJSON, `{}`)
 
 	if err != nil {
 		zap.L().Error("Failed to create/update asset with static info and allowed users",
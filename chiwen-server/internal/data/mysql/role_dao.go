@@ -0,0 +1,160 @@
+package mysql
+
+import (
+	"database/sql"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const roleColumns = `id, name, IFNULL(description, '') AS description, permissions, builtin, created_at, updated_at`
+
+// ListRoles 查询所有角色
+func ListRoles() ([]model.Role, error) {
+	roles := []model.Role{}
+	err := db.Select(&roles, `SELECT `+roleColumns+` FROM roles ORDER BY id ASC`)
+	return roles, err
+}
+
+// GetRole 查询单个角色
+func GetRole(id uint) (*model.Role, error) {
+	var r model.Role
+	if err := db.Get(&r, `SELECT `+roleColumns+` FROM roles WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CreateRole 新增角色
+func CreateRole(r *model.Role) error {
+	result, err := db.Exec(`INSERT INTO roles (name, description, permissions) VALUES (?, ?, ?)`,
+		r.Name, r.Description, r.Permissions)
+	if err != nil {
+		zap.L().Error("CreateRole failed", zap.String("name", r.Name), zap.Error(err))
+		return err
+	}
+	id, _ := result.LastInsertId()
+	r.ID = uint(id)
+	return nil
+}
+
+// UpdateRole 修改角色
+func UpdateRole(r *model.Role) error {
+	result, err := db.Exec(`UPDATE roles SET name = ?, description = ?, permissions = ? WHERE id = ?`,
+		r.Name, r.Description, r.Permissions, r.ID)
+	if err != nil {
+		zap.L().Error("UpdateRole failed", zap.Uint("id", r.ID), zap.Error(err))
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := GetRole(r.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteRole 删除角色及其分配关系
+func DeleteRole(id uint) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_roles WHERE role_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_group_roles WHERE role_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM roles WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// GetUserRoleIDs 查询直接分配给用户的角色ID
+func GetUserRoleIDs(userID uint) ([]uint, error) {
+	ids := []uint{}
+	err := db.Select(&ids, `SELECT role_id FROM user_roles WHERE user_id = ? ORDER BY role_id`, userID)
+	return ids, err
+}
+
+// GetUserGroupRoleIDs 查询分配给用户组的角色ID
+func GetUserGroupRoleIDs(groupID uint) ([]uint, error) {
+	ids := []uint{}
+	err := db.Select(&ids, `SELECT role_id FROM user_group_roles WHERE group_id = ? ORDER BY role_id`, groupID)
+	return ids, err
+}
+
+// UserHasRoles 用户是否被分配了角色（直接分配或通过所在用户组），不含所有人都有的默认角色
+func UserHasRoles(userID uint) (bool, error) {
+	var n int
+	err := db.Get(&n, `
+		SELECT (SELECT COUNT(*) FROM user_roles WHERE user_id = ?)
+		     + (SELECT COUNT(*) FROM user_group_roles gr
+		        JOIN user_group_members m ON m.group_id = gr.group_id
+		        WHERE m.user_id = ?)`, userID, userID)
+	return n > 0, err
+}
+
+// replaceRoles 在事务中把 table 里 ownerCol = ownerID 的角色整体替换为 roleIDs（忽略不存在的角色）
+func replaceRoles(table, ownerCol string, ownerID uint, roleIDs []uint) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM `+table+` WHERE `+ownerCol+` = ?`, ownerID); err != nil {
+		return err
+	}
+	if len(roleIDs) > 0 {
+		query, args, err := sqlx.In(`
+			INSERT INTO `+table+` (`+ownerCol+`, role_id)
+			SELECT ?, id FROM roles WHERE id IN (?)`, ownerID, roleIDs)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetUserRoles 设置用户的角色（整体替换）
+func SetUserRoles(userID uint, roleIDs []uint) error {
+	if _, err := GetUserProfile(userID); err != nil {
+		return err
+	}
+	return replaceRoles("user_roles", "user_id", userID, roleIDs)
+}
+
+// SetUserGroupRoles 设置用户组的角色（整体替换）
+func SetUserGroupRoles(groupID uint, roleIDs []uint) error {
+	if _, err := GetUserGroup(groupID); err != nil {
+		return err
+	}
+	return replaceRoles("user_group_roles", "group_id", groupID, roleIDs)
+}
+
+// ListUserPermissions 查询用户生效的全部角色权限：默认角色 + 直接分配的角色 + 所在用户组的角色
+func ListUserPermissions(userID uint) ([]model.StringList, error) {
+	perms := []model.StringList{}
+	err := db.Select(&perms, `
+		SELECT permissions FROM roles
+		WHERE name = ?
+		   OR id IN (SELECT role_id FROM user_roles WHERE user_id = ?)
+		   OR id IN (SELECT gr.role_id FROM user_group_roles gr
+		             JOIN user_group_members m ON m.group_id = gr.group_id
+		             WHERE m.user_id = ?)`,
+		model.DefaultRoleName, userID, userID)
+	return perms, err
+}
@@ -0,0 +1,33 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// GetSetting 读取系统设置到 dst，不存在时返回 false
+func GetSetting(name string, dst interface{}) (bool, error) {
+	var value []byte
+	err := db.Get(&value, `SELECT value FROM system_settings WHERE name = ?`, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(value, dst)
+}
+
+// SaveSetting 保存系统设置
+func SaveSetting(name string, value interface{}, updatedBy string) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO system_settings (name, value, updated_by) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE value = VALUES(value), updated_by = VALUES(updated_by)`,
+		name, string(b), updatedBy)
+	return err
+}
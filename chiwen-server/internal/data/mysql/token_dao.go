@@ -0,0 +1,127 @@
+package mysql
+
+import (
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"go.uber.org/zap"
+)
+
+const refreshTokenColumns = `id, token_hash, family_id, user_id, access_jti, client_ip, user_agent,
+	expires_at, used_at, revoked_at, revoke_reason, created_at`
+
+// CreateRefreshToken 保存新签发的刷新令牌
+func CreateRefreshToken(t *model.RefreshToken) error {
+	_, err := db.Exec(`
+		INSERT INTO refresh_tokens (token_hash, family_id, user_id, access_jti, client_ip, user_agent, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.TokenHash, t.FamilyID, t.UserID, t.AccessJTI, t.ClientIP, t.UserAgent, t.ExpiresAt)
+	if err != nil {
+		zap.L().Error("CreateRefreshToken failed", zap.Uint("user_id", t.UserID), zap.Error(err))
+	}
+	return err
+}
+
+// GetRefreshToken 按哈希查询刷新令牌
+func GetRefreshToken(hash string) (*model.RefreshToken, error) {
+	var t model.RefreshToken
+	if err := db.Get(&t, `SELECT `+refreshTokenColumns+` FROM refresh_tokens WHERE token_hash = ?`, hash); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListRefreshFamily 查询一条令牌链上的全部刷新令牌
+func ListRefreshFamily(familyID string) ([]model.RefreshToken, error) {
+	var tokens []model.RefreshToken
+	err := db.Select(&tokens, `SELECT `+refreshTokenColumns+` FROM refresh_tokens WHERE family_id = ? ORDER BY id`, familyID)
+	return tokens, err
+}
+
+// GetRefreshFamilyByAccessJTI 查询与访问令牌一同签发的刷新令牌所在的令牌链，不存在时返回空串
+func GetRefreshFamilyByAccessJTI(jti string) (string, error) {
+	var families []string
+	if err := db.Select(&families, `SELECT family_id FROM refresh_tokens WHERE access_jti = ? LIMIT 1`, jti); err != nil {
+		return "", err
+	}
+	if len(families) == 0 {
+		return "", nil
+	}
+	return families[0], nil
+}
+
+// MarkRefreshTokenUsed 轮换时标记旧令牌已使用，返回是否成功（并发刷新时只有一个请求成功）
+func MarkRefreshTokenUsed(id int64) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE refresh_tokens SET used_at = NOW()
+		WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n == 1, nil
+}
+
+// RevokeRefreshFamily 作废整条令牌链
+func RevokeRefreshFamily(familyID, reason string) error {
+	_, err := db.Exec(`
+		UPDATE refresh_tokens SET revoked_at = NOW(), revoke_reason = ?
+		WHERE family_id = ? AND revoked_at IS NULL`, reason, familyID)
+	return err
+}
+
+// RevokeUserRefreshTokens 作废用户的全部刷新令牌
+func RevokeUserRefreshTokens(userID uint, reason string) error {
+	_, err := db.Exec(`
+		UPDATE refresh_tokens SET revoked_at = NOW(), revoke_reason = ?
+		WHERE user_id = ? AND revoked_at IS NULL`, reason, userID)
+	return err
+}
+
+// RevokeAccessToken 把访问令牌加入吊销列表
+func RevokeAccessToken(jti string, userID uint, expiresAt time.Time, reason string) error {
+	_, err := db.Exec(`
+		INSERT IGNORE INTO revoked_tokens (jti, user_id, reason, expires_at) VALUES (?, ?, ?, ?)`,
+		jti, userID, reason, expiresAt)
+	return err
+}
+
+// ListRevokedAccessTokens 查询尚未过期的已吊销访问令牌
+func ListRevokedAccessTokens() ([]model.RevokedToken, error) {
+	var tokens []model.RevokedToken
+	err := db.Select(&tokens, `SELECT jti, user_id, expires_at FROM revoked_tokens WHERE expires_at > NOW()`)
+	return tokens, err
+}
+
+// SetUserTokensRevokedAt 记录用户的令牌吊销时间
+func SetUserTokensRevokedAt(userID uint, at time.Time) error {
+	result, err := db.Exec(`UPDATE users SET tokens_revoked_at = ? WHERE id = ?`, at, userID)
+	if err != nil {
+		return err
+	}
+	return checkUserAffected(result, userID)
+}
+
+// ListUserTokenRevocations 查询 since 之后吊销过令牌的用户
+func ListUserTokenRevocations(since time.Time) ([]model.UserTokenRevocation, error) {
+	var list []model.UserTokenRevocation
+	err := db.Select(&list, `SELECT id, tokens_revoked_at FROM users WHERE tokens_revoked_at > ?`, since)
+	return list, err
+}
+
+// CleanupExpiredTokens 清理已过期的刷新令牌和吊销记录
+func CleanupExpiredTokens() (int64, error) {
+	var total int64
+	for _, query := range []string{
+		`DELETE FROM refresh_tokens WHERE expires_at < NOW() LIMIT 1000`,
+		`DELETE FROM revoked_tokens WHERE expires_at < NOW() LIMIT 1000`,
+	} {
+		result, err := db.Exec(query)
+		if err != nil {
+			return total, err
+		}
+		n, _ := result.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,97 @@
+package mysql
+
+import (
+	"strings"
+
+	"github.com/chiwen/server/internal/data/model"
+	"go.uber.org/zap"
+)
+
+// ReplaceSessionCommands 重建某个会话的命令索引（先删后插，支持重复执行）
+func ReplaceSessionCommands(sessionID string, commands []model.TTYCommand) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM tty_commands WHERE session_id = ?`, sessionID); err != nil {
+		return err
+	}
+
+	if len(commands) > 0 {
+		_, err = tx.NamedExec(`
+			INSERT INTO tty_commands
+				(session_id, asset_id, user_id, executed_at, command, partial, exit_code)
+			VALUES
+				(:session_id, :asset_id, :user_id, :executed_at, :command, :partial, :exit_code)`,
+			commands)
+		if err != nil {
+			zap.L().Error("Failed to insert tty commands",
+				zap.String("session_id", sessionID),
+				zap.Int("count", len(commands)),
+				zap.Error(err))
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SearchTTYCommands 按机器、用户、时间范围、关键字和正则搜索命令，按执行时间倒序
+func SearchTTYCommands(f model.TTYCommandFilter) ([]model.TTYCommand, int, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if f.AssetID != "" {
+		conds = append(conds, "c.asset_id = ?")
+		args = append(args, f.AssetID)
+	}
+	if f.UserID != "" {
+		conds = append(conds, "c.user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.From != nil {
+		conds = append(conds, "c.executed_at >= ?")
+		args = append(args, *f.From)
+	}
+	if f.To != nil {
+		conds = append(conds, "c.executed_at < ?")
+		args = append(args, *f.To)
+	}
+	if f.Keyword != "" {
+		conds = append(conds, "MATCH(c.command) AGAINST (? IN BOOLEAN MODE)")
+		args = append(args, f.Keyword)
+	}
+	if f.Regex != "" {
+		conds = append(conds, "c.command REGEXP ?")
+		args = append(args, f.Regex)
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := db.Get(&total, `SELECT COUNT(*) FROM tty_commands c`+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT c.id, c.session_id, c.asset_id, IFNULL(a.hostname, '') AS hostname,
+		       c.user_id, IFNULL(u.username, '') AS username,
+		       c.executed_at, c.command, c.partial, c.exit_code
+		FROM tty_commands c
+		LEFT JOIN assets a ON a.id = c.asset_id
+		LEFT JOIN users u ON CAST(u.id AS CHAR) = c.user_id` + where + `
+		ORDER BY c.executed_at DESC
+		LIMIT ? OFFSET ?`
+
+	commands := []model.TTYCommand{}
+	if err := db.Select(&commands, query, append(args, f.PageSize, (f.Page-1)*f.PageSize)...); err != nil {
+		return nil, 0, err
+	}
+	return commands, total, nil
+}
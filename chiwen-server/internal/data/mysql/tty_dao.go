@@ -2,6 +2,7 @@ package mysql
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/chiwen/server/internal/data/model"
@@ -40,7 +41,7 @@ func GetActiveSessionsCount(assetID string) (int, error) {
 	query := `
 		SELECT COUNT(*) 
 		FROM tty_sessions 
-		WHERE asset_id = ? AND status IN ('pending', 'connected')
+		WHERE asset_id = ? AND status IN ('pending', 'connected', 'detached')
 		  AND created_at > DATE_SUB(NOW(), INTERVAL 30 MINUTE)
 	`
 	err := db.Get(&count, query, assetID)
@@ -53,7 +54,7 @@ func GetUserActiveSessionsCount(userID string) (int, error) {
 	query := `
 		SELECT COUNT(*) 
 		FROM tty_sessions 
-		WHERE user_id = ? AND status IN ('pending', 'connected')
+		WHERE user_id = ? AND status IN ('pending', 'connected', 'detached')
 		  AND created_at > DATE_SUB(NOW(), INTERVAL 30 MINUTE)
 	`
 	err := db.Get(&count, query, userID)
@@ -108,8 +109,8 @@ func CreateTTYSession(session *model.TTYSession) error {
 	query := `
 		INSERT INTO tty_sessions 
 			(id, asset_id, user_id, token, status, command, terminal_cols, terminal_rows, 
-			 created_at, browser_ip)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			 created_at, connected_at, browser_ip, os_account)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	zap.L().Debug("Creating TTY session",
@@ -130,7 +131,9 @@ func CreateTTYSession(session *model.TTYSession) error {
 		session.TerminalCols,
 		session.TerminalRows,
 		session.CreatedAt,
+		session.ConnectedAt,
 		session.BrowserIP,
+		session.OSAccount,
 	)
 
 	if err != nil {
@@ -157,13 +160,18 @@ func min(a, b int) int {
 	return b
 }
 
+// ttySessionColumns tty_sessions 的完整查询列（可为 NULL 的字符串列统一转成空串，避免扫描失败）
+const ttySessionColumns = `
+	id, asset_id, user_id, token, status, command, terminal_cols, terminal_rows,
+	created_at, connected_at, closed_at,
+	IFNULL(browser_ip, '') AS browser_ip, IFNULL(agent_ip, '') AS agent_ip,
+	IFNULL(record_file, '') AS record_file, IFNULL(error_message, '') AS error_message,
+	IFNULL(os_account, '') AS os_account`
+
 // GetTTYSessionByToken 通过Token获取会话
 func GetTTYSessionByToken(token string) (*model.TTYSession, error) {
 	var session model.TTYSession
-	query := `
-		SELECT id, asset_id, user_id, token, status, command, terminal_cols, terminal_rows,
-		       created_at, connected_at, closed_at, browser_ip, agent_ip,
-		       record_file, error_message
+	query := `SELECT ` + ttySessionColumns + `
 		FROM tty_sessions
 		WHERE token = ? AND status != 'closed'
 	`
@@ -197,13 +205,13 @@ func GetAgentTTYSessions(assetID string) ([]model.TTYSession, error) {
 }
 
 // CreateTTYToken 插入一次性 token（用于授权阶段）
-func CreateTTYToken(token, userID, assetID string, cols, rows int, expireAt time.Time) error {
+func CreateTTYToken(token, userID, assetID, osAccount string, cols, rows int, expireAt time.Time) error {
 	query := `
 		INSERT INTO tty_tokens 
-			(token, user_id, asset_id, terminal_cols, terminal_rows, expire_at, created_at, status)
-		VALUES (?, ?, ?, ?, ?, ?, NOW(), 'pending')
+			(token, user_id, asset_id, os_account, terminal_cols, terminal_rows, expire_at, created_at, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NOW(), 'pending')
 	`
-	_, err := db.Exec(query, token, userID, assetID, cols, rows, expireAt)
+	_, err := db.Exec(query, token, userID, assetID, osAccount, cols, rows, expireAt)
 	if err != nil {
 		zap.L().Error("CreateTTYToken failed", zap.String("token", token[:8]+"..."), zap.Error(err))
 	}
@@ -220,7 +228,8 @@ func ConsumeTTYToken(token string) (*model.TTYToken, error) {
 
 	var t model.TTYToken
 	err = tx.Get(&t, `
-		SELECT id, token, user_id, asset_id, terminal_cols, terminal_rows, expire_at 
+		SELECT id, token, user_id, asset_id, IFNULL(os_account, '') AS os_account,
+		       terminal_cols, terminal_rows, expire_at 
 		FROM tty_tokens 
 		WHERE token = ? AND status = 'pending' 
 		FOR UPDATE`, token)
@@ -243,3 +252,101 @@ func ConsumeTTYToken(token string) (*model.TTYToken, error) {
 
 	return &t, nil
 }
+
+// GetTTYSessionByID 通过会话ID获取会话（任何状态）
+func GetTTYSessionByID(id string) (*model.TTYSession, error) {
+	var session model.TTYSession
+	query := `SELECT ` + ttySessionColumns + ` FROM tty_sessions WHERE id = ?`
+	if err := db.Get(&session, query, id); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// UpdateTTYSessionRecordFile 记录会话录像文件路径
+func UpdateTTYSessionRecordFile(id, recordFile string) error {
+	_, err := db.Exec(`UPDATE tty_sessions SET record_file = ? WHERE id = ?`, recordFile, id)
+	if err != nil {
+		zap.L().Error("Failed to update TTY session record file",
+			zap.String("session_id", id),
+			zap.String("record_file", recordFile),
+			zap.Error(err))
+	}
+	return err
+}
+
+// CloseTTYSession 标记会话关闭并记录关闭时间，errMsg 为空时保留原有 error_message
+func CloseTTYSession(id, errMsg string) error {
+	query := `
+		UPDATE tty_sessions
+		SET status = 'closed',
+		    closed_at = NOW(),
+		    error_message = IF(? = '', error_message, ?)
+		WHERE id = ?
+	`
+	_, err := db.Exec(query, errMsg, errMsg, id)
+	if err != nil {
+		zap.L().Error("Failed to close TTY session",
+			zap.String("session_id", id),
+			zap.Error(err))
+	}
+	return err
+}
+
+// ListActiveTTYSessions 查询未关闭的会话，userID、assetID 为空表示不限
+func ListActiveTTYSessions(userID, assetID string) ([]model.TTYSession, error) {
+	query := `SELECT ` + ttySessionColumns + ` FROM tty_sessions WHERE status IN ('pending', 'connected', 'detached')`
+	var args []interface{}
+	if userID != "" {
+		query += ` AND user_id = ?`
+		args = append(args, userID)
+	}
+	if assetID != "" {
+		query += ` AND asset_id = ?`
+		args = append(args, assetID)
+	}
+
+	sessions := []model.TTYSession{}
+	err := db.Select(&sessions, query+` ORDER BY created_at`, args...)
+	return sessions, err
+}
+
+// ListTTYRecordings 分页查询有录像的会话，按创建时间倒序
+func ListTTYRecordings(f model.TTYRecordingFilter) ([]model.TTYRecording, int, error) {
+	var (
+		conds = []string{"s.record_file IS NOT NULL", "s.record_file != ''"}
+		args  []interface{}
+	)
+	if f.AssetID != "" {
+		conds = append(conds, "s.asset_id = ?")
+		args = append(args, f.AssetID)
+	}
+	if f.UserID != "" {
+		conds = append(conds, "s.user_id = ?")
+		args = append(args, f.UserID)
+	}
+	where := " WHERE " + strings.Join(conds, " AND ")
+
+	var total int
+	if err := db.Get(&total, `SELECT COUNT(*) FROM tty_sessions s`+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT s.id, s.asset_id, IFNULL(a.hostname, '') AS hostname,
+		       s.user_id, IFNULL(u.username, '') AS username,
+		       s.status, IFNULL(s.browser_ip, '') AS browser_ip,
+		       s.created_at, s.closed_at, s.record_file
+		FROM tty_sessions s
+		LEFT JOIN assets a ON a.id = s.asset_id
+		LEFT JOIN users u ON CAST(u.id AS CHAR) = s.user_id` + where + `
+		ORDER BY s.created_at DESC
+		LIMIT ? OFFSET ?`
+
+	recordings := []model.TTYRecording{}
+	err := db.Select(&recordings, query, append(args, f.PageSize, (f.Page-1)*f.PageSize)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return recordings, total, nil
+}
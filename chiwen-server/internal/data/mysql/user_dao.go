@@ -0,0 +1,189 @@
+package mysql
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/chiwen/server/internal/data/model"
+	"go.uber.org/zap"
+)
+
+const userProfileColumns = `
+	id, username, IFNULL(name, '') AS name, IFNULL(email, '') AS email, IFNULL(phone, '') AS phone,
+	is_active, is_admin, IFNULL(ldap_dn, '') AS ldap_dn, created_at, updated_at,
+	last_login_at, IFNULL(last_login_ip, '') AS last_login_ip, locked_until, login_ips, bind_login_ip`
+
+// ListUsers 分页查询用户
+func ListUsers(f model.UserFilter) ([]model.UserProfile, int, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if f.Keyword != "" {
+		like := "%" + f.Keyword + "%"
+		conds = append(conds, "(username LIKE ? OR name LIKE ? OR email LIKE ?)")
+		args = append(args, like, like, like)
+	}
+	if f.IsActive != nil {
+		conds = append(conds, "is_active = ?")
+		args = append(args, *f.IsActive)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := db.Get(&total, `SELECT COUNT(*) FROM users`+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	users := []model.UserProfile{}
+	err := db.Select(&users, `SELECT `+userProfileColumns+` FROM users`+where+`
+		ORDER BY id ASC LIMIT ? OFFSET ?`,
+		append(args, f.PageSize, (f.Page-1)*f.PageSize)...)
+	return users, total, err
+}
+
+// GetUserProfile 查询单个用户
+func GetUserProfile(id uint) (*model.UserProfile, error) {
+	var u model.UserProfile
+	if err := db.Get(&u, `SELECT `+userProfileColumns+` FROM users WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetUserByUsername 按用户名查询用户（包括已禁用的），用于登录认证
+func GetUserByUsername(username string) (*model.User, error) {
+	var u model.User
+	err := db.Get(&u, `
+		SELECT id, username, password_hash, name, email, phone, is_active, is_admin,
+		       ldap_dn, created_at, updated_at, last_login_at, last_login_ip
+		FROM users WHERE username = ?`, username)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// CreateUser 新增用户，返回用户ID；LdapDN 非空表示由 LDAP 同步的用户
+func CreateUser(u *model.User) (uint, error) {
+	result, err := db.Exec(`
+		INSERT INTO users (username, password_hash, name, email, phone, is_active, is_admin, ldap_dn)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		u.Username, u.PasswordHash, u.Name, u.Email, u.Phone, u.IsActive, u.IsAdmin, u.LdapDN.String)
+	if err != nil {
+		zap.L().Error("CreateUser failed", zap.String("username", u.Username), zap.Error(err))
+		return 0, err
+	}
+	id, _ := result.LastInsertId()
+	return uint(id), nil
+}
+
+// UpdateUser 修改用户基本信息和管理员标记
+func UpdateUser(id uint, name, email, phone string, isAdmin bool) error {
+	result, err := db.Exec(`
+		UPDATE users SET name = ?, email = ?, phone = ?, is_admin = ? WHERE id = ?`,
+		name, email, phone, isAdmin, id)
+	if err != nil {
+		zap.L().Error("UpdateUser failed", zap.Uint("id", id), zap.Error(err))
+		return err
+	}
+	return checkUserAffected(result, id)
+}
+
+// UpdateLDAPUser 用 LDAP 目录中的属性刷新用户信息，isAdmin 为 nil 时保留原管理员标记
+func UpdateLDAPUser(id uint, dn, name, email, phone string, isAdmin *bool) error {
+	_, err := db.Exec(`
+		UPDATE users
+		SET ldap_dn = ?, name = ?, email = ?, phone = ?, is_admin = IFNULL(?, is_admin)
+		WHERE id = ?`,
+		dn, name, email, phone, isAdmin, id)
+	if err != nil {
+		zap.L().Error("UpdateLDAPUser failed", zap.Uint("id", id), zap.Error(err))
+	}
+	return err
+}
+
+// UpdateUserLogin 记录最近登录时间和IP
+func UpdateUserLogin(id uint, ip string) error {
+	_, err := db.Exec(`UPDATE users SET last_login_at = NOW(), last_login_ip = ? WHERE id = ?`, ip, id)
+	return err
+}
+
+// UpdateUserPassword 修改用户密码哈希
+func UpdateUserPassword(id uint, passwordHash string) error {
+	result, err := db.Exec(`UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, id)
+	if err != nil {
+		zap.L().Error("UpdateUserPassword failed", zap.Uint("id", id), zap.Error(err))
+		return err
+	}
+	return checkUserAffected(result, id)
+}
+
+// SetUserActive 启用/禁用用户
+func SetUserActive(id uint, active bool) error {
+	result, err := db.Exec(`UPDATE users SET is_active = ? WHERE id = ?`, active, id)
+	if err != nil {
+		zap.L().Error("SetUserActive failed", zap.Uint("id", id), zap.Error(err))
+		return err
+	}
+	return checkUserAffected(result, id)
+}
+
+// DeleteUser 删除用户及其用户组成员关系、MFA 配置和刷新令牌
+func DeleteUser(id uint) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_group_members WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_mfa WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM refresh_tokens WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_roles WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM api_tokens WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		zap.L().Error("DeleteUser failed", zap.Uint("id", id), zap.Error(err))
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// CountActiveAdmins 统计启用中的管理员数量
+func CountActiveAdmins() (int, error) {
+	var n int
+	err := db.Get(&n, `SELECT COUNT(*) FROM users WHERE is_admin = 1 AND is_active = 1`)
+	return n, err
+}
+
+// checkUserAffected 更新未影响任何行时区分"用户不存在"和"值未变化"
+func checkUserAffected(result sql.Result, id uint) error {
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+	var exists int
+	if err := db.Get(&exists, `SELECT COUNT(*) FROM users WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
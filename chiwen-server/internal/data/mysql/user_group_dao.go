@@ -0,0 +1,189 @@
+package mysql
+
+import (
+	"database/sql"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// GetUserGroupIDs 查询用户所属的用户组ID
+func GetUserGroupIDs(userID uint) ([]uint, error) {
+	ids := []uint{}
+	err := db.Select(&ids, `SELECT group_id FROM user_group_members WHERE user_id = ?`, userID)
+	return ids, err
+}
+
+const userGroupColumns = `
+	g.id, g.name, IFNULL(g.description, '') AS description,
+	(SELECT COUNT(*) FROM user_group_members m WHERE m.group_id = g.id) AS member_count,
+	g.created_at, g.updated_at`
+
+// ListUserGroups 查询所有用户组
+func ListUserGroups() ([]model.UserGroup, error) {
+	groups := []model.UserGroup{}
+	err := db.Select(&groups, `SELECT `+userGroupColumns+` FROM user_groups g ORDER BY g.id ASC`)
+	return groups, err
+}
+
+// GetUserGroup 查询单个用户组
+func GetUserGroup(id uint) (*model.UserGroup, error) {
+	var g model.UserGroup
+	if err := db.Get(&g, `SELECT `+userGroupColumns+` FROM user_groups g WHERE g.id = ?`, id); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// CreateUserGroup 新增用户组
+func CreateUserGroup(g *model.UserGroup) error {
+	result, err := db.Exec(`INSERT INTO user_groups (name, description) VALUES (?, ?)`, g.Name, g.Description)
+	if err != nil {
+		zap.L().Error("CreateUserGroup failed", zap.String("name", g.Name), zap.Error(err))
+		return err
+	}
+	id, _ := result.LastInsertId()
+	g.ID = uint(id)
+	return nil
+}
+
+// UpdateUserGroup 修改用户组
+func UpdateUserGroup(g *model.UserGroup) error {
+	result, err := db.Exec(`UPDATE user_groups SET name = ?, description = ? WHERE id = ?`, g.Name, g.Description, g.ID)
+	if err != nil {
+		zap.L().Error("UpdateUserGroup failed", zap.Uint("id", g.ID), zap.Error(err))
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := GetUserGroup(g.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteUserGroup 删除用户组及其成员关系
+func DeleteUserGroup(id uint) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_group_members WHERE group_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_group_roles WHERE group_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM user_groups WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// ListUserGroupMembers 查询用户组成员
+func ListUserGroupMembers(groupID uint) ([]model.UserProfile, error) {
+	users := []model.UserProfile{}
+	err := db.Select(&users, `SELECT `+userProfileColumns+` FROM users
+		WHERE id IN (SELECT user_id FROM user_group_members WHERE group_id = ?)
+		ORDER BY id ASC`, groupID)
+	return users, err
+}
+
+// AddUserGroupMembers 把用户加入用户组，已是成员的忽略；返回实际新增的数量
+func AddUserGroupMembers(groupID uint, userIDs []uint) (int64, error) {
+	if len(userIDs) == 0 {
+		return 0, nil
+	}
+	query, args, err := sqlx.In(`
+		INSERT IGNORE INTO user_group_members (group_id, user_id)
+		SELECT ?, id FROM users WHERE id IN (?)`, groupID, userIDs)
+	if err != nil {
+		return 0, err
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		zap.L().Error("AddUserGroupMembers failed", zap.Uint("group_id", groupID), zap.Error(err))
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RemoveUserGroupMember 把用户移出用户组
+func RemoveUserGroupMember(groupID, userID uint) error {
+	result, err := db.Exec(`DELETE FROM user_group_members WHERE group_id = ? AND user_id = ?`, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SyncUserGroupsByName 同步外部目录映射的用户组：managed 为受同步管理的组名，
+// 用户加入 member 中的组（不存在时自动创建），退出 managed 中其余的组；不在 managed 中的组不受影响
+func SyncUserGroupsByName(userID uint, managed, member []string) error {
+	if len(managed) == 0 {
+		return nil
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, name := range member {
+		if _, err := tx.Exec(`INSERT IGNORE INTO user_groups (name, description) VALUES (?, 'LDAP')`, name); err != nil {
+			return err
+		}
+	}
+
+	var stale []string
+	for _, name := range managed {
+		if !containsString(member, name) {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) > 0 {
+		query, args, err := sqlx.In(`
+			DELETE FROM user_group_members
+			WHERE user_id = ? AND group_id IN (SELECT id FROM user_groups WHERE name IN (?))`,
+			userID, stale)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+
+	if len(member) > 0 {
+		query, args, err := sqlx.In(`
+			INSERT IGNORE INTO user_group_members (group_id, user_id)
+			SELECT id, ? FROM user_groups WHERE name IN (?)`,
+			userID, member)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+// Package asciicast 实现 asciicast v2 录像格式（https://docs.asciinema.org/manual/asciicast/v2/）
+// 文件第一行为 JSON 头，之后每行一个事件：[相对秒数, 事件类型, 数据]
+package asciicast
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// 事件类型
+const (
+	EventOutput = "o" // 终端输出
+	EventInput  = "i" // 用户输入（按键）
+	EventResize = "r" // 终端尺寸变化，数据格式为 "{cols}x{rows}"
+)
+
+// Header asciicast v2 文件头
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Writer 将终端事件追加写入 .cast 文件，可被多个 goroutine 并发调用
+type Writer struct {
+	mu     sync.Mutex
+	file   *os.File
+	buf    *bufio.Writer
+	start  time.Time
+	closed bool
+
+	// 终端数据按字节分段到达，多字节字符可能被拆到两段里；
+	// 每类事件末尾不完整的字符先暂存，和下一段拼接后再写入，避免录像中出现乱码
+	carry map[string][]byte
+}
+
+// Create 创建录像文件并写入文件头（父目录不存在时自动创建）
+func Create(path string, header Header) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("create record dir: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("create record file: %w", err)
+	}
+
+	start := time.Now()
+	header.Version = 2
+	if header.Timestamp == 0 {
+		header.Timestamp = start.Unix()
+	}
+
+	w := &Writer{
+		file:  f,
+		buf:   bufio.NewWriter(f),
+		start: start,
+	}
+
+	data, err := json.Marshal(header)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := w.writeLine(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// WriteOutput 记录一段终端输出
+func (w *Writer) WriteOutput(data []byte) error {
+	return w.writeData(EventOutput, data)
+}
+
+// WriteInput 记录一段用户输入
+func (w *Writer) WriteInput(data []byte) error {
+	return w.writeData(EventInput, data)
+}
+
+// writeData 写入字节数据事件，末尾不完整的 UTF-8 字符留到下一次
+func (w *Writer) writeData(typ string, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+
+	if prev := w.carry[typ]; len(prev) > 0 {
+		data = append(prev, data...)
+	}
+	n := CompleteUTF8(data)
+	if n < len(data) {
+		if w.carry == nil {
+			w.carry = make(map[string][]byte)
+		}
+		w.carry[typ] = append([]byte(nil), data[n:]...)
+	} else {
+		delete(w.carry, typ)
+	}
+	if n == 0 {
+		return nil
+	}
+	return w.writeEventLocked(typ, string(data[:n]))
+}
+
+// CompleteUTF8 返回 b 中以完整 UTF-8 字符结尾的最长前缀长度
+func CompleteUTF8(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if utf8.FullRune(b[i:]) {
+				return len(b)
+			}
+			return i
+		}
+	}
+	return len(b)
+}
+
+// WriteResize 记录一次终端尺寸变化
+func (w *Writer) WriteResize(cols, rows int) error {
+	return w.writeEvent(EventResize, fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (w *Writer) writeEvent(typ, data string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.writeEventLocked(typ, data)
+}
+
+func (w *Writer) writeEventLocked(typ, data string) error {
+	elapsed := time.Since(w.start).Seconds()
+	line, err := json.Marshal([]interface{}{roundSeconds(elapsed), typ, data})
+	if err != nil {
+		return err
+	}
+	return w.writeLine(line)
+}
+
+// writeLine 写入一行并立即刷盘，保证进程异常退出时录像尽量完整
+func (w *Writer) writeLine(line []byte) error {
+	if _, err := w.buf.Write(line); err != nil {
+		return err
+	}
+	if err := w.buf.WriteByte('\n'); err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
+
+// Close 关闭录像文件，重复调用是安全的
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	// 暂存的残缺字符原样写出
+	for _, typ := range []string{EventOutput, EventInput} {
+		if rest := w.carry[typ]; len(rest) > 0 {
+			w.writeEventLocked(typ, string(rest))
+		}
+	}
+	w.closed = true
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// roundSeconds 保留 6 位小数（微秒精度），与 asciinema 输出一致
+func roundSeconds(s float64) float64 {
+	return float64(int64(s*1e6)) / 1e6
+}
@@ -0,0 +1,204 @@
+package asciicast
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 回放倍速范围
+const (
+	MinSpeed = 0.5
+	MaxSpeed = 8.0
+)
+
+// Status 回放进度
+type Status struct {
+	Position float64 `json:"position"` // 当前位置（录像内秒数）
+	Duration float64 `json:"duration"` // 录像总时长
+	Speed    float64 `json:"speed"`
+	Paused   bool    `json:"paused"`
+	Ended    bool    `json:"ended"`
+}
+
+// Sink 接收回放产生的输出，所有方法只会在 Player.Run 所在的 goroutine 中调用
+type Sink interface {
+	Output(data string) error
+	Resize(cols, rows int) error
+	Status(s Status) error
+}
+
+type commandKind int
+
+const (
+	cmdPause commandKind = iota
+	cmdPlay
+	cmdSeek
+	cmdSpeed
+)
+
+type command struct {
+	kind  commandKind
+	value float64
+}
+
+// Player 按录像时间轴回放事件，支持暂停、跳转和倍速
+type Player struct {
+	rec  *Recording
+	cmds chan command
+}
+
+// NewPlayer 创建回放器
+func NewPlayer(rec *Recording) *Player {
+	return &Player{rec: rec, cmds: make(chan command, 16)}
+}
+
+// Pause 暂停回放
+func (p *Player) Pause() { p.send(command{kind: cmdPause}) }
+
+// Play 继续回放（已结束时从头开始）
+func (p *Player) Play() { p.send(command{kind: cmdPlay}) }
+
+// Seek 跳转到录像内的 t 秒处
+func (p *Player) Seek(t float64) { p.send(command{kind: cmdSeek, value: t}) }
+
+// SetSpeed 设置倍速，超出 [MinSpeed, MaxSpeed] 时取边界值
+func (p *Player) SetSpeed(speed float64) { p.send(command{kind: cmdSpeed, value: speed}) }
+
+func (p *Player) send(cmd command) {
+	select {
+	case p.cmds <- cmd:
+	default:
+		// 控制命令积压说明客户端发送过快，丢弃即可
+	}
+}
+
+// Run 开始回放，直到 ctx 结束或 Sink 返回错误；回放结束后保持暂停状态，仍可跳转重播
+func (p *Player) Run(ctx context.Context, sink Sink) error {
+	var (
+		events   = p.rec.Events
+		duration = p.rec.Duration()
+		idx      int     // 下一个待播放事件
+		pos      float64 // 当前录像时间
+		speed    = 1.0
+		paused   bool
+		ended    bool
+	)
+
+	status := func() error {
+		return sink.Status(Status{Position: pos, Duration: duration, Speed: speed, Paused: paused, Ended: ended})
+	}
+
+	if err := sink.Resize(p.rec.Header.Width, p.rec.Header.Height); err != nil {
+		return err
+	}
+	if err := status(); err != nil {
+		return err
+	}
+
+	for {
+		var (
+			timer   *time.Timer
+			timerC  <-chan time.Time
+			started = time.Now()
+		)
+		if !paused && idx < len(events) {
+			wait := time.Duration((events[idx].Time - pos) / speed * float64(time.Second))
+			timer = time.NewTimer(max(wait, 0))
+			timerC = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return ctx.Err()
+
+		case <-timerC:
+			ev := events[idx]
+			idx++
+			pos = ev.Time
+			if err := emit(sink, ev); err != nil {
+				return err
+			}
+			if idx >= len(events) {
+				paused, ended = true, true
+				if err := status(); err != nil {
+					return err
+				}
+			}
+
+		case cmd := <-p.cmds:
+			if timer != nil {
+				timer.Stop()
+				// 计算被打断前已经播放到的位置
+				pos = min(pos+time.Since(started).Seconds()*speed, events[idx].Time)
+			}
+
+			switch cmd.kind {
+			case cmdPause:
+				paused = true
+			case cmdPlay:
+				if ended {
+					idx, pos = 0, 0
+					if err := snapshot(sink, p.rec, 0); err != nil {
+						return err
+					}
+				}
+				paused, ended = false, false
+			case cmdSpeed:
+				speed = min(max(cmd.value, MinSpeed), MaxSpeed)
+			case cmdSeek:
+				pos = min(max(cmd.value, 0), duration)
+				idx = sort.Search(len(events), func(i int) bool { return events[i].Time > pos })
+				ended = idx >= len(events)
+				if ended {
+					paused = true
+				}
+				if err := snapshot(sink, p.rec, idx); err != nil {
+					return err
+				}
+			}
+			if err := status(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func emit(sink Sink, ev Event) error {
+	switch ev.Type {
+	case EventOutput:
+		return sink.Output(ev.Data)
+	case EventResize:
+		if cols, rows, err := ParseResize(ev.Data); err == nil {
+			return sink.Resize(cols, rows)
+		}
+	}
+	return nil
+}
+
+// snapshot 重置终端并一次性输出前 idx 个事件的内容，用于跳转后还原屏幕
+func snapshot(sink Sink, rec *Recording, idx int) error {
+	cols, rows := rec.Header.Width, rec.Header.Height
+	var out strings.Builder
+	out.WriteString("\x1bc") // RIS：清屏并重置终端状态
+
+	for _, ev := range rec.Events[:idx] {
+		switch ev.Type {
+		case EventOutput:
+			out.WriteString(ev.Data)
+		case EventResize:
+			if c, r, err := ParseResize(ev.Data); err == nil {
+				cols, rows = c, r
+			}
+		}
+	}
+
+	if err := sink.Resize(cols, rows); err != nil {
+		return err
+	}
+	return sink.Output(out.String())
+}
@@ -0,0 +1,101 @@
+package asciicast
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Event 录像中的一个事件
+type Event struct {
+	Time float64 // 相对录像开始的秒数
+	Type string  // 事件类型，见 EventOutput 等常量
+	Data string
+}
+
+// Recording 解析后的完整录像
+type Recording struct {
+	Header Header
+	Events []Event
+}
+
+// Duration 录像总时长（秒）
+func (r *Recording) Duration() float64 {
+	if len(r.Events) == 0 {
+		return 0
+	}
+	return r.Events[len(r.Events)-1].Time
+}
+
+// ParseResize 解析 resize 事件数据 "{cols}x{rows}"
+func ParseResize(data string) (cols, rows int, err error) {
+	c, r, ok := strings.Cut(data, "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid resize event: %q", data)
+	}
+	if cols, err = strconv.Atoi(c); err != nil {
+		return 0, 0, err
+	}
+	if rows, err = strconv.Atoi(r); err != nil {
+		return 0, 0, err
+	}
+	return cols, rows, nil
+}
+
+// Open 读取并解析录像文件
+func Open(path string) (*Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read 从 r 解析 asciicast v2 数据；录像最后一行不完整（会话异常中断）时忽略该行
+func Read(r io.Reader) (*Recording, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("empty recording")
+	}
+
+	rec := &Recording{}
+	if err := json.Unmarshal(sc.Bytes(), &rec.Header); err != nil {
+		return nil, fmt.Errorf("invalid asciicast header: %w", err)
+	}
+	if rec.Header.Version != 2 {
+		return nil, fmt.Errorf("unsupported asciicast version: %d", rec.Header.Version)
+	}
+
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var raw []json.RawMessage
+		if err := json.Unmarshal(line, &raw); err != nil || len(raw) != 3 {
+			continue
+		}
+		var ev Event
+		if json.Unmarshal(raw[0], &ev.Time) != nil ||
+			json.Unmarshal(raw[1], &ev.Type) != nil ||
+			json.Unmarshal(raw[2], &ev.Data) != nil {
+			continue
+		}
+		rec.Events = append(rec.Events, ev)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
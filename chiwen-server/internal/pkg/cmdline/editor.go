@@ -0,0 +1,191 @@
+// Package cmdline 根据终端输入按键流还原用户输入的命令行
+//
+// 还原是尽力而为的：只处理常见的行编辑按键（退格、Ctrl-U、Ctrl-W、Ctrl-C），
+// 方向键、Tab 补全、历史命令（包括 Ctrl-P/Ctrl-R 等控制键）等依赖 shell 状态的编辑无法还原，
+// 这类行会被标记为 Partial。
+package cmdline
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 控制字符
+const (
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyBackspace = 0x08
+	keyTab       = 0x09
+	keyLF        = 0x0a
+	keyCtrlL     = 0x0c
+	keyCR        = 0x0d
+	keyCtrlU     = 0x15
+	keyCtrlW     = 0x17
+	keyEsc       = 0x1b
+	keyDelete    = 0x7f
+)
+
+type escState int
+
+const (
+	escNone  escState = iota
+	escStart          // 收到 ESC
+	escCSI            // ESC [ ... 直到终止字节
+	escSS3            // ESC O x
+	escOSC            // ESC ] ... 直到 BEL 或 ESC \
+)
+
+// Line 一条完整的命令行
+type Line struct {
+	Text    string
+	Partial bool // 编辑过程中出现了无法还原的按键（方向键、Tab 等），Text 可能与实际执行的不一致
+}
+
+// Editor 行编辑状态机，非并发安全
+type Editor struct {
+	buf     []rune
+	partial bool
+	esc     escState
+	params  []byte // CSI 序列的参数部分
+	pending []byte // 未凑齐的 UTF-8 多字节字符
+}
+
+// Feed 处理一段输入。每遇到回车调用一次 onEnter，offset 为回车在 data 中的下标；
+// onEnter 返回 false 时立即停止处理，剩余数据被丢弃（当前行同时被清空）。
+// 返回值为实际处理到的字节数。
+func (e *Editor) Feed(data []byte, onEnter func(line Line, offset int) bool) int {
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+
+		if e.esc != escNone {
+			e.feedEscape(b)
+			continue
+		}
+
+		if len(e.pending) > 0 || b >= utf8.RuneSelf {
+			e.pending = append(e.pending, b)
+			if utf8.FullRune(e.pending) {
+				r, _ := utf8.DecodeRune(e.pending)
+				e.pending = e.pending[:0]
+				if r != utf8.RuneError && unicode.IsPrint(r) {
+					e.buf = append(e.buf, r)
+				}
+			}
+			continue
+		}
+
+		switch b {
+		case keyCR, keyLF:
+			line := e.take()
+			if onEnter != nil && !onEnter(line, i) {
+				return i + 1
+			}
+			// \r\n 只算一次回车
+			if b == keyCR && i+1 < len(data) && data[i+1] == keyLF {
+				i++
+			}
+		case keyBackspace, keyDelete:
+			if n := len(e.buf); n > 0 {
+				e.buf = e.buf[:n-1]
+			}
+		case keyCtrlU:
+			e.buf = e.buf[:0]
+		case keyCtrlW:
+			e.deleteWord()
+		case keyCtrlC:
+			e.Reset()
+		case keyCtrlD:
+			// 空行上的 Ctrl-D 表示退出 shell，按 exit 处理以便审计
+			if len(e.buf) == 0 {
+				if onEnter != nil && !onEnter(Line{Text: "exit"}, i) {
+					return i + 1
+				}
+				continue
+			}
+			// 非空行上的 Ctrl-D 删除光标处字符
+			e.partial = true
+		case keyTab:
+			e.partial = true
+		case keyEsc:
+			e.esc = escStart
+		case keyCtrlL:
+			// 清屏不影响当前行
+		default:
+			if b >= 0x20 {
+				e.buf = append(e.buf, rune(b))
+			} else {
+				// 其余控制键（Ctrl-A/E/K/Y、Ctrl-P/N、Ctrl-R 等）会移动光标或改写行内容
+				e.partial = true
+			}
+		}
+	}
+	return len(data)
+}
+
+// feedEscape 跳过终端转义序列；光标移动类按键会让还原结果不可靠
+func (e *Editor) feedEscape(b byte) {
+	switch e.esc {
+	case escStart:
+		switch b {
+		case '[':
+			e.esc = escCSI
+			e.params = e.params[:0]
+		case 'O':
+			e.esc = escSS3
+		case ']':
+			e.esc = escOSC
+		default:
+			// Alt+键 等两字节序列
+			e.partial = true
+			e.esc = escNone
+		}
+	case escCSI:
+		if b >= 0x40 && b <= 0x7e {
+			// 只有括号粘贴模式的起止标记（ESC[200~ / ESC[201~）不影响命令内容，
+			// Delete（ESC[3~）、Home/End 等同样以 ~ 结尾，需要标记
+			if p := string(e.params); b != '~' || (p != "200" && p != "201") {
+				e.partial = true
+			}
+			e.esc = escNone
+		} else {
+			e.params = append(e.params, b)
+		}
+	case escSS3:
+		e.partial = true
+		e.esc = escNone
+	case escOSC:
+		if b == 0x07 || b == '\\' {
+			e.esc = escNone
+		}
+	}
+}
+
+func (e *Editor) deleteWord() {
+	i := len(e.buf)
+	for i > 0 && e.buf[i-1] == ' ' {
+		i--
+	}
+	for i > 0 && e.buf[i-1] != ' ' {
+		i--
+	}
+	e.buf = e.buf[:i]
+}
+
+// Current 返回当前尚未回车的输入内容
+func (e *Editor) Current() Line {
+	return Line{Text: string(e.buf), Partial: e.partial}
+}
+
+// Reset 丢弃当前输入
+func (e *Editor) Reset() {
+	e.buf = e.buf[:0]
+	e.partial = false
+	e.pending = e.pending[:0]
+}
+
+func (e *Editor) take() Line {
+	line := Line{Text: strings.TrimSpace(string(e.buf)), Partial: e.partial}
+	e.Reset()
+	return line
+}
@@ -0,0 +1,244 @@
+// Package envelope 敏感字段的信封加密：每个值使用随机数据密钥（DEK）AES-256-GCM 加密，
+// DEK 再由主密钥（KEK）加密后与密文一起保存。主密钥带 ID，可同时加载多把，
+// 新值总是使用主用密钥，旧值按 ID 找到对应密钥解密；更换主密钥后只需重新包装 DEK
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// prefix 加密值的前缀，格式 enc:v1:<key_id>:<base64(加密的DEK)>:<base64(密文)>
+	prefix = "enc:v1:"
+	// KeySize 主密钥与数据密钥长度（AES-256）
+	KeySize = 32
+)
+
+var (
+	// ErrKeyNotLoaded 加密值使用的主密钥未加载
+	ErrKeyNotLoaded = errors.New("master key not loaded")
+	// ErrMalformed 加密值格式错误
+	ErrMalformed = errors.New("malformed encrypted value")
+)
+
+var (
+	keys      map[string][]byte
+	primaryID string
+)
+
+// ParseKeys 解析主密钥列表，每项为 <key_id>:<base64 编码的 32 字节密钥>，以换行或逗号分隔，# 开头的行为注释；
+// 返回的 ids 保持书写顺序
+func ParseKeys(s string) (map[string][]byte, []string, error) {
+	parsed := make(map[string][]byte)
+	var ids []string
+	for _, line := range strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == ',' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(line, ":")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" || strings.Contains(id, " ") {
+			return nil, nil, fmt.Errorf("invalid master key entry %q, expect <key_id>:<base64 key>", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(key) != KeySize {
+			return nil, nil, fmt.Errorf("master key %q must be %d bytes base64", id, KeySize)
+		}
+		if _, dup := parsed[id]; dup {
+			return nil, nil, fmt.Errorf("duplicate master key id %q", id)
+		}
+		parsed[id] = key
+		ids = append(ids, id)
+	}
+	return parsed, ids, nil
+}
+
+// Init 加载主密钥，primary 为加密新值使用的密钥 ID；keys 为空表示不启用加密
+func Init(k map[string][]byte, primary string) error {
+	if len(k) == 0 {
+		keys, primaryID = nil, ""
+		return nil
+	}
+	if _, ok := k[primary]; !ok {
+		return fmt.Errorf("primary master key %q not found", primary)
+	}
+	keys, primaryID = k, primary
+	return nil
+}
+
+// Enabled 是否已加载主密钥
+func Enabled() bool {
+	return primaryID != ""
+}
+
+// PrimaryKeyID 当前主用密钥 ID
+func PrimaryKeyID() string {
+	return primaryID
+}
+
+// GenerateKey 生成新的主密钥（base64）
+func GenerateKey() (string, error) {
+	k := make([]byte, KeySize)
+	if _, err := rand.Read(k); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(k), nil
+}
+
+// IsSealed 是否为加密值（未加密的历史明文值返回 false）
+func IsSealed(v string) bool {
+	return strings.HasPrefix(v, prefix)
+}
+
+// KeyID 加密值使用的主密钥 ID
+func KeyID(v string) (string, bool) {
+	p, err := split(v)
+	if err != nil {
+		return "", false
+	}
+	return p.keyID, true
+}
+
+// Seal 用主用密钥加密 plaintext，aad 为绑定的上下文（如记录 ID），解密时必须一致，防止密文被挪到其他记录；
+// 未启用加密时原样返回
+func Seal(plaintext, aad string) (string, error) {
+	if !Enabled() || plaintext == "" {
+		return plaintext, nil
+	}
+	dek := make([]byte, KeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	ct, err := gcmSeal(dek, []byte(plaintext), []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := gcmSeal(keys[primaryID], dek, []byte(primaryID))
+	if err != nil {
+		return "", err
+	}
+	return join(parts{primaryID, wrapped, ct}), nil
+}
+
+// Open 解密 Seal 的结果；未加密的历史明文值原样返回
+func Open(v, aad string) (string, error) {
+	if !IsSealed(v) {
+		return v, nil
+	}
+	p, err := split(v)
+	if err != nil {
+		return "", err
+	}
+	dek, err := unwrap(p)
+	if err != nil {
+		return "", err
+	}
+	plain, err := gcmOpen(dek, p.ciphertext, []byte(aad))
+	if err != nil {
+		return "", fmt.Errorf("decrypt value: %w", err)
+	}
+	return string(plain), nil
+}
+
+// Rewrap 用主用密钥重新包装加密值的 DEK，密文本身不变；已是主用密钥时原样返回
+func Rewrap(v string) (string, error) {
+	if !Enabled() {
+		return "", ErrKeyNotLoaded
+	}
+	p, err := split(v)
+	if err != nil {
+		return "", err
+	}
+	if p.keyID == primaryID {
+		return v, nil
+	}
+	dek, err := unwrap(p)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := gcmSeal(keys[primaryID], dek, []byte(primaryID))
+	if err != nil {
+		return "", err
+	}
+	return join(parts{primaryID, wrapped, p.ciphertext}), nil
+}
+
+type parts struct {
+	keyID      string
+	wrappedDEK []byte
+	ciphertext []byte
+}
+
+func split(v string) (parts, error) {
+	if !IsSealed(v) {
+		return parts{}, ErrMalformed
+	}
+	fields := strings.Split(strings.TrimPrefix(v, prefix), ":")
+	if len(fields) != 3 || fields[0] == "" {
+		return parts{}, ErrMalformed
+	}
+	wrapped, err1 := base64.StdEncoding.DecodeString(fields[1])
+	ct, err2 := base64.StdEncoding.DecodeString(fields[2])
+	if err1 != nil || err2 != nil {
+		return parts{}, ErrMalformed
+	}
+	return parts{fields[0], wrapped, ct}, nil
+}
+
+func join(p parts) string {
+	return prefix + p.keyID + ":" +
+		base64.StdEncoding.EncodeToString(p.wrappedDEK) + ":" +
+		base64.StdEncoding.EncodeToString(p.ciphertext)
+}
+
+func unwrap(p parts) ([]byte, error) {
+	kek, ok := keys[p.keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotLoaded, p.keyID)
+	}
+	dek, err := gcmOpen(kek, p.wrappedDEK, []byte(p.keyID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key with %s: %w", p.keyID, err)
+	}
+	return dek, nil
+}
+
+// gcmSeal 返回 nonce||密文
+func gcmSeal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func gcmOpen(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
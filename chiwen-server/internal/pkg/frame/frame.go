@@ -0,0 +1,86 @@
+// Package frame 终端数据的二进制帧格式（协议版本 2），Agent↔Server、Server↔Browser 共用
+//
+//	+---------+------+--------+------------+---------+
+//	| version | type | sidLen | session_id | payload |
+//	| 1 byte  |1 byte| 1 byte | sidLen 字节 | 其余字节 |
+//	+---------+------+--------+------------+---------+
+//
+// 终端输入输出使用二进制帧原样传输字节，控制消息（new_session/resize/close_session 等）仍使用 JSON 文本帧。
+// 协议版本 1 为旧版纯 JSON 协议，终端数据放在 "data" 字符串字段中。
+package frame
+
+import (
+	"errors"
+	"strconv"
+)
+
+// 协议版本
+const (
+	VersionJSON   = 1 // 旧版：全部使用 JSON
+	VersionBinary = 2 // 终端数据使用二进制帧
+
+	// Version 本端支持的最高版本
+	Version = VersionBinary
+)
+
+// 帧类型
+const (
+	TypeOutput byte = 0x01 // 终端输出（Agent → Server → Browser）
+	TypeInput  byte = 0x02 // 用户输入（Browser → Server → Agent）
+)
+
+const headerSize = 3
+
+// ErrInvalidFrame 帧格式错误
+var ErrInvalidFrame = errors.New("invalid frame")
+
+// Frame 一个解码后的二进制帧
+type Frame struct {
+	Version   byte
+	Type      byte
+	SessionID string
+	Payload   []byte
+}
+
+// Encode 编码一个二进制帧，session_id 最长 255 字节
+func Encode(typ byte, sessionID string, payload []byte) []byte {
+	if len(sessionID) > 255 {
+		sessionID = sessionID[:255]
+	}
+	b := make([]byte, 0, headerSize+len(sessionID)+len(payload))
+	b = append(b, VersionBinary, typ, byte(len(sessionID)))
+	b = append(b, sessionID...)
+	return append(b, payload...)
+}
+
+// Decode 解码一个二进制帧，Payload 引用 b 的底层数组
+func Decode(b []byte) (Frame, error) {
+	if len(b) < headerSize {
+		return Frame{}, ErrInvalidFrame
+	}
+	if b[0] != VersionBinary {
+		return Frame{}, errors.New("unsupported frame version " + strconv.Itoa(int(b[0])))
+	}
+	end := headerSize + int(b[2])
+	if len(b) < end {
+		return Frame{}, ErrInvalidFrame
+	}
+	return Frame{
+		Version:   b[0],
+		Type:      b[1],
+		SessionID: string(b[headerSize:end]),
+		Payload:   b[end:],
+	}, nil
+}
+
+// Negotiate 根据对端声明的最高版本（查询参数 proto）确定双方使用的协议版本，未声明时为旧版 JSON
+func Negotiate(peer string) int {
+	v, err := strconv.Atoi(peer)
+	if err != nil || v < VersionJSON {
+		return VersionJSON
+	}
+	if v > Version {
+		return Version
+	}
+	return v
+}
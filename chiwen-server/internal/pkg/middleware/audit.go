@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxAuditBody 记录到审计中的请求体上限，超出时不记录请求体
+const maxAuditBody = 64 << 10
+
+const (
+	auditBeforeKey   = "audit_before"
+	auditAfterKey    = "audit_after"
+	auditResourceKey = "audit_resource"
+)
+
+// AuditBefore 处理器在变更前登记资源的原状态，用于生成变更对比
+func AuditBefore(c *gin.Context, v interface{}) {
+	c.Set(auditBeforeKey, v)
+}
+
+// AuditAfter 处理器登记资源变更后的状态，未登记时使用脱敏后的请求体
+func AuditAfter(c *gin.Context, v interface{}) {
+	c.Set(auditAfterKey, v)
+}
+
+// AuditResource 处理器指定操作的资源（路由推断不准确时使用，如资源ID在请求体中）
+func AuditResource(c *gin.Context, resourceType, resourceID string) {
+	c.Set(auditResourceKey, [2]string{resourceType, resourceID})
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// resourceFromRoute 从路由模板推断资源：最后一个路径参数及其前面的静态段，
+// 如 /api/v1/assets/:id/accounts/:account_id → accounts + account_id 的值；没有参数时取第一段
+func resourceFromRoute(c *gin.Context) (string, string) {
+	segments := strings.Split(strings.TrimPrefix(c.FullPath(), "/api/v1/"), "/")
+	for i := len(segments) - 1; i > 0; i-- {
+		if strings.HasPrefix(segments[i], ":") && !strings.HasPrefix(segments[i-1], ":") {
+			return segments[i-1], c.Param(segments[i][1:])
+		}
+	}
+	return segments[0], ""
+}
+
+// Audit 记录所有变更类请求（POST/PUT/PATCH/DELETE）的审计事件：操作人、动作、资源、变更前后对比、来源 IP；
+// 需放在 AuthRequired 之后
+func Audit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isMutating(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			buf, _ := io.ReadAll(io.LimitReader(c.Request.Body, maxAuditBody+1))
+			c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(buf), c.Request.Body))
+			if len(buf) <= maxAuditBody {
+				body = buf
+			}
+		}
+
+		c.Next()
+
+		if c.FullPath() == "" {
+			return
+		}
+		userID, username, _ := CurrentUser(c)
+		event := &model.AuditEvent{
+			ActorID:    userID,
+			Actor:      username,
+			Action:     c.Request.Method + " " + c.FullPath(),
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			StatusCode: c.Writer.Status(),
+			ClientIP:   c.ClientIP(),
+		}
+		event.ResourceType, event.ResourceID = resourceFromRoute(c)
+		if v, ok := c.Get(auditResourceKey); ok {
+			r := v.([2]string)
+			event.ResourceType, event.ResourceID = r[0], r[1]
+		}
+		if v, ok := c.Get(auditBeforeKey); ok {
+			event.Before = service.AuditJSON(v)
+		}
+		if v, ok := c.Get(auditAfterKey); ok {
+			event.After = service.AuditJSON(v)
+		} else if body != nil {
+			event.After = service.AuditJSON(body)
+		}
+
+		if err := service.RecordAuditEvent(event); err != nil {
+			zap.L().Error("Failed to record audit event", zap.String("action", event.Action), zap.Error(err))
+		}
+	}
+}
@@ -2,14 +2,18 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 
+	"github.com/chiwen/server/internal/data/model"
 	"github.com/chiwen/server/internal/pkg/utils"
+	"github.com/chiwen/server/internal/service"
 )
 
 // ==================== CORS 中间件（新增） ====================
@@ -29,25 +33,111 @@ func CORS() gin.HandlerFunc {
 	})
 }
 
-// ==================== 原来的鉴权中间件（完全不动） ====================
+const (
+	apiTokenKey           = "api_token"
+	apiTokenOwnerAdminKey = "api_token_owner_admin"
+)
+
+// ==================== 鉴权中间件 ====================
+// AuthRequired 校验 Authorization: Bearer 凭证：cwt_ 前缀的是 API 令牌，其余按 JWT 访问令牌校验并检查是否已吊销；
+// WebSocket 请求可改用 access_token 查询参数携带 JWT
 func AuthRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		auth := c.GetHeader("Authorization")
+		// 浏览器 WebSocket 无法设置请求头，允许通过 access_token 查询参数携带 JWT
+		if auth == "" && c.IsWebsocket() && c.Query("access_token") != "" {
+			auth = "Bearer " + c.Query("access_token")
+		}
 		if auth == "" || !strings.HasPrefix(auth, "Bearer ") {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "缺少 Authorization"})
 			return
 		}
 
 		tokenStr := strings.TrimPrefix(auth, "Bearer ")
+		if strings.HasPrefix(tokenStr, model.APITokenPrefix) {
+			apiTokenAuth(c, tokenStr)
+			return
+		}
 		claims, err := utils.ParseToken(tokenStr)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "无效的 token"})
 			return
 		}
+		// 已退出登录、退出所有会话或用户被禁用
+		if service.IsTokenRevoked(claims) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "token 已失效，请重新登录"})
+			return
+		}
 
+		c.Set("token_claims", claims)
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("is_admin", claims.IsAdmin)
 		c.Next()
 	}
 }
+
+// apiTokenAuth 自动化客户端使用 API 令牌认证：权限为令牌 scopes 与所属用户权限的交集；
+// 不带管理员身份，资产访问同样受授权规则限制
+func apiTokenAuth(c *gin.Context, raw string) {
+	identity, err := service.AuthenticateAPIToken(raw, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, service.ErrLoginIPNotAllowed) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "当前 IP 不允许访问"})
+			return
+		}
+		if !errors.Is(err, service.ErrInvalidAPIToken) {
+			zap.L().Error("API token authentication failed", zap.Error(err))
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "无效的 API 令牌"})
+		return
+	}
+
+	c.Set(apiTokenKey, identity.Token)
+	c.Set(apiTokenOwnerAdminKey, identity.User.IsAdmin)
+	c.Set("user_id", identity.User.ID)
+	c.Set("username", identity.User.Username)
+	c.Set("is_admin", false)
+	c.Next()
+}
+
+// CurrentAPIToken 当前请求使用的 API 令牌，JWT 登录时为 nil
+func CurrentAPIToken(c *gin.Context) *model.APIToken {
+	v, _ := c.Get(apiTokenKey)
+	t, _ := v.(*model.APIToken)
+	return t
+}
+
+// SessionOnly 仅允许交互登录的 JWT 访问（退出登录、MFA、管理 API 令牌等），拒绝 API 令牌
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CurrentAPIToken(c) != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "API 令牌不能访问此接口"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentUser 读取 AuthRequired 写入 Gin 上下文的登录用户信息
+func CurrentUser(c *gin.Context) (userID uint, username string, isAdmin bool) {
+	return c.GetUint("user_id"), c.GetString("username"), c.GetBool("is_admin")
+}
+
+// CurrentClaims 读取 AuthRequired 解析出的访问令牌
+func CurrentClaims(c *gin.Context) *utils.Claims {
+	claims, _ := c.Get("token_claims")
+	v, _ := claims.(*utils.Claims)
+	return v
+}
+
+// AdminRequired 仅允许管理员访问，需放在 AuthRequired 之后
+func AdminRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("is_admin") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "需要管理员权限"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/chiwen/server/internal/service"
+)
+
+// HasPermission 当前登录用户是否拥有权限点（管理员拥有全部权限），需在 AuthRequired 之后调用；
+// 使用 API 令牌时还要求权限点在令牌的 scopes 内
+func HasPermission(c *gin.Context, perm string) bool {
+	userID, _, isAdmin := CurrentUser(c)
+	if t := CurrentAPIToken(c); t != nil {
+		if !t.Scopes.Contains(perm) {
+			return false
+		}
+		isAdmin = c.GetBool(apiTokenOwnerAdminKey)
+	}
+	ok, err := service.HasPermission(userID, isAdmin, perm)
+	if err != nil {
+		zap.L().Error("Failed to check permission", zap.Uint("user_id", userID), zap.String("permission", perm), zap.Error(err))
+		return false
+	}
+	return ok
+}
+
+// RequirePermission 要求当前用户拥有全部指定的权限点，需放在 AuthRequired 之后
+func RequirePermission(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, perm := range perms {
+			if !HasPermission(c, perm) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "缺少权限 " + perm, "permission": perm})
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -1,51 +1,137 @@
 package utils
 
 import (
-	"os"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/sirupsen/logrus"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+// minSecretLength HS256 签名密钥最短长度
+const minSecretLength = 32
+
+var (
+	jwtSecret []byte
+	// accessTokenTTL 访问令牌有效期，过期后凭刷新令牌换取新令牌
+	accessTokenTTL = 15 * time.Minute
+)
+
+// InitJWT 设置签名密钥和访问令牌有效期；密钥未配置或过短时拒绝启动，不再使用内置默认密钥
+func InitJWT(secret string, accessTTL time.Duration) error {
+	if len(secret) < minSecretLength {
+		return fmt.Errorf("jwt secret must be at least %d bytes, set JWT_SECRET or auth.jwt.secret", minSecretLength)
+	}
+	jwtSecret = []byte(secret)
+	if accessTTL > 0 {
+		accessTokenTTL = accessTTL
+	}
+	// 签发时间精确到毫秒，"退出所有会话"之后立即重新登录签发的令牌不会被误判为已吊销
+	jwt.TimePrecision = time.Millisecond
+	return nil
+}
+
+// AccessTokenTTL 访问令牌有效期
+func AccessTokenTTL() time.Duration {
+	return accessTokenTTL
+}
 
 type Claims struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
 	IsAdmin  bool   `json:"is_admin"`
+	// Purpose 非空表示受限用途的令牌（如登录第二步的 MFA 挑战），不能用于访问接口
+	Purpose string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// 生成 Token
-func GenerateToken(userID uint, username string, isAdmin bool) (string, error) {
-	if len(jwtSecret) == 0 {
-		jwtSecret = []byte("chiwen-2025-super-secret-change-me-now!!!")
-		logrus.Warn("JWT_SECRET 未设置，使用默认密钥")
+// MFA 挑战令牌用途
+const (
+	PurposeMFAVerify = "mfa_verify" // 已绑定 TOTP，提交验证码
+	PurposeMFAEnroll = "mfa_enroll" // 策略要求 MFA 但尚未绑定，先完成绑定
+)
+
+// mfaTokenTTL MFA 挑战令牌有效期
+const mfaTokenTTL = 5 * time.Minute
+
+// GenerateToken 生成访问令牌，返回令牌和令牌 ID（jti，用于吊销）
+func GenerateToken(userID uint, username string, isAdmin bool) (string, string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", "", err
 	}
+	claims := Claims{UserID: userID, Username: username, IsAdmin: isAdmin}
+	claims.ID = jti
+	token, err := signToken(claims, accessTokenTTL)
+	return token, jti, err
+}
 
-	claims := Claims{
-		UserID:   userID,
-		Username: username,
-		IsAdmin:  isAdmin,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+// GenerateMFAToken 生成登录第二步使用的 MFA 挑战令牌
+func GenerateMFAToken(userID uint, username, purpose string) (string, error) {
+	return signToken(Claims{UserID: userID, Username: username, Purpose: purpose}, mfaTokenTTL)
+}
+
+func signToken(claims Claims, ttl time.Duration) (string, error) {
+	if len(jwtSecret) == 0 {
+		return "", errors.New("jwt secret is not initialized")
 	}
 
+	now := time.Now()
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	claims.IssuedAt = jwt.NewNumericDate(now)
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(jwtSecret)
 }
 
-// 验证 Token
-func ParseToken(tokenString string) (*Claims, error) {
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func parseClaims(tokenString string) (*Claims, error) {
+	if len(jwtSecret) == 0 {
+		return nil, errors.New("jwt secret is not initialized")
+	}
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
 		return jwtSecret, nil
-	})
-	if err != nil || !token.Valid {
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
 		return nil, err
 	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
 	return claims, nil
 }
+
+// 验证 Token（受限用途的令牌视为无效）
+func ParseToken(tokenString string) (*Claims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("token is not an access token")
+	}
+	return claims, nil
+}
+
+// ParseMFAToken 验证 MFA 挑战令牌，purposes 为允许的用途
+func ParseMFAToken(tokenString string, purposes ...string) (*Claims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range purposes {
+		if claims.Purpose == p {
+			return claims, nil
+		}
+	}
+	return nil, errors.New("invalid mfa token")
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	// agentMaxAge Agent 签名请求的最长有效期（秒）
+	agentMaxAge = 120
+	// agentNonceCacheSize 每个 Agent 记住的 nonce 数量上限，超出时淘汰最早的
+	agentNonceCacheSize = 512
+	// clockSkewReportDelta 时钟偏差变化超过该秒数才写库
+	clockSkewReportDelta = 2
+)
+
+var (
+	// ErrAgentClockSkew 时间戳过旧或超前太多
+	ErrAgentClockSkew = errors.New("agent timestamp out of range")
+	// ErrAgentReplay 重复的 nonce（请求被重放）
+	ErrAgentReplay = errors.New("replayed agent request")
+)
+
+// agentMaxFutureSkew 允许 Agent 时间戳超前服务端的秒数，默认 30
+func agentMaxFutureSkew() int64 {
+	if viper.IsSet("agent.max_future_skew") {
+		return viper.GetInt64("agent.max_future_skew")
+	}
+	return 30
+}
+
+// checkAgentTimestamp 时间戳不能早于 agentMaxAge 秒，也不能超前 agent.max_future_skew 秒
+func checkAgentTimestamp(ts int64) error {
+	now := time.Now().Unix()
+	if ts <= 0 {
+		return fmt.Errorf("%w: invalid timestamp", ErrAgentClockSkew)
+	}
+	if now-ts > agentMaxAge {
+		return fmt.Errorf("%w: timestamp expired (%ds old)", ErrAgentClockSkew, now-ts)
+	}
+	if max := agentMaxFutureSkew(); ts-now > max {
+		return fmt.Errorf("%w: timestamp %ds in the future (max %ds)", ErrAgentClockSkew, ts-now, max)
+	}
+	return nil
+}
+
+// agentReplayState 单个 Agent 近期用过的 nonce，按插入顺序淘汰
+type agentReplayState struct {
+	nonces map[string]int64 // nonce → 过期时间（unix 秒）
+	order  []string
+	// 最近一次写库的时钟偏差
+	skew         int64
+	skewReported bool
+}
+
+// prune 清除已过期的 nonce（过期后时间戳校验本身就会拒绝）
+func (s *agentReplayState) prune(now int64) {
+	i := 0
+	for ; i < len(s.order); i++ {
+		if exp, ok := s.nonces[s.order[i]]; ok && exp > now {
+			break
+		}
+		delete(s.nonces, s.order[i])
+	}
+	s.order = s.order[i:]
+}
+
+var replayGuard = struct {
+	sync.Mutex
+	agents map[string]*agentReplayState
+}{agents: make(map[string]*agentReplayState)}
+
+// recordAgentNonce 签名校验通过后登记 nonce，重复时返回 ErrAgentReplay；同时记录 Agent 时钟偏差。
+// kind 区分心跳和长连接认证。旧版 Agent 不带 nonce 时以签名代替：签名覆盖了时间戳，
+// 同一签名再次出现只可能是重放（同一秒内内容完全相同的合法请求也会被拒绝，旧版 Agent 下次重试即可）
+func recordAgentNonce(assetID, kind, nonce, signature string, ts int64) error {
+	now := time.Now().Unix()
+
+	replayGuard.Lock()
+	s := replayGuard.agents[assetID]
+	if s == nil {
+		s = &agentReplayState{nonces: make(map[string]int64)}
+		replayGuard.agents[assetID] = s
+	}
+	s.prune(now)
+	key := kind + ":" + nonce
+	if nonce == "" {
+		key = kind + ":sig:" + signature
+	}
+	if _, seen := s.nonces[key]; seen {
+		replayGuard.Unlock()
+		zap.L().Warn("Replayed agent request rejected", zap.String("asset_id", assetID), zap.String("kind", kind))
+		return ErrAgentReplay
+	}
+	if len(s.order) >= agentNonceCacheSize {
+		delete(s.nonces, s.order[0])
+		s.order = s.order[1:]
+	}
+	// 超前的时间戳要等到 ts+agentMaxAge 才会被时间戳校验拒绝，nonce 至少保留到那时
+	s.nonces[key] = ts + agentMaxAge + 1
+	s.order = append(s.order, key)
+
+	skew := ts - now
+	report := !s.skewReported || abs(skew-s.skew) >= clockSkewReportDelta
+	if report {
+		s.skew, s.skewReported = skew, true
+	}
+	replayGuard.Unlock()
+
+	if report {
+		if err := mysql.UpdateAgentClockSkew(assetID, skew); err != nil {
+			zap.L().Warn("Failed to save agent clock skew", zap.String("asset_id", assetID), zap.Error(err))
+		}
+		if abs(skew) >= 10 {
+			zap.L().Warn("Agent clock skew detected", zap.String("asset_id", assetID), zap.Int64("skew_seconds", skew))
+		}
+	}
+	return nil
+}
+
+// PruneAgentReplayCache 清理 nonce 已全部过期的 Agent，由后台任务定期调用
+func PruneAgentReplayCache() {
+	now := time.Now().Unix()
+	replayGuard.Lock()
+	defer replayGuard.Unlock()
+	for id, s := range replayGuard.agents {
+		s.prune(now)
+		if len(s.order) == 0 {
+			delete(replayGuard.agents, id)
+		}
+	}
+}
+
+// agentConnectionPayload 长连接认证的签名内容：asset_id|ts|nonce，旧版 Agent 不带 nonce 时为 asset_id+ts
+func agentConnectionPayload(assetID, tsStr, nonce string) string {
+	if nonce == "" {
+		return assetID + tsStr
+	}
+	return assetID + "|" + tsStr + "|" + nonce
+}
+
+// AuthenticateAgentConnection 校验 Agent 长连接的认证参数并登记 nonce（旧版 Agent 以签名查重）
+func AuthenticateAgentConnection(assetID string, ts int64, tsStr, nonce, signature string) error {
+	if len(nonce) > 64 {
+		return errors.New("nonce too long")
+	}
+	if err := checkAgentTimestamp(ts); err != nil {
+		return err
+	}
+	if err := VerifyAgentSignature(assetID, agentConnectionPayload(assetID, tsStr, nonce), signature); err != nil {
+		return err
+	}
+	return recordAgentNonce(assetID, "ws", nonce, signature, ts)
+}
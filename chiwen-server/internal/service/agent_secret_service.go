@@ -0,0 +1,239 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chiwen/server/internal/api/agent"
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// agentSecretRotationSetting system_settings 中 Agent 密钥定期轮换设置的名称
+	agentSecretRotationSetting = "agent_secret_rotation"
+	// pendingSecretTTL 新密钥下发后等待 Agent 确认的时间；超时未确认时 Agent 仍可用旧密钥连接
+	pendingSecretTTL = 10 * time.Minute
+)
+
+var (
+	// ErrInvalidAgentSignature Agent 签名与任何有效密钥都不匹配
+	ErrInvalidAgentSignature = errors.New("invalid agent signature")
+	// ErrInvalidRotationSettings 轮换设置不合法
+	ErrInvalidRotationSettings = errors.New("invalid agent secret rotation settings")
+)
+
+// newAgentSecret 生成新的 Agent HMAC 密钥
+func newAgentSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func agentHMAC(secret, message string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// rotationAckMessage Agent 确认轮换时用新密钥签名的内容，证明已拿到新密钥
+func rotationAckMessage(assetID, rotationID string) string {
+	return "rotate|" + assetID + "|" + rotationID
+}
+
+// VerifyAgentSignature 校验 Agent 的 HMAC 签名（base64）：依次尝试当前密钥、过渡期内的旧密钥、待确认的新密钥；
+// 用待确认的新密钥签名成功说明 Agent 已保存新密钥（确认消息可能丢失），直接启用新密钥
+func VerifyAgentSignature(assetID, message, signatureB64 string) error {
+	sig, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %v", err)
+	}
+	secrets, err := mysql.GetAgentSecrets(assetID)
+	if err != nil {
+		return err
+	}
+	if secrets.Deleted || secrets.State == model.AgentStateRevoked {
+		return ErrAgentRevoked
+	}
+	if secrets.Current == "" {
+		return errors.New("agent secret key is empty")
+	}
+
+	now := time.Now()
+	if hmac.Equal(sig, agentHMAC(secrets.Current, message)) {
+		return nil
+	}
+	if secrets.Previous != "" && secrets.PreviousExpires != nil && now.Before(*secrets.PreviousExpires) &&
+		hmac.Equal(sig, agentHMAC(secrets.Previous, message)) {
+		zap.L().Info("Agent authenticated with previous secret", zap.String("asset_id", assetID))
+		return nil
+	}
+	if secrets.Pending != "" && secrets.PendingExpires != nil && now.Before(*secrets.PendingExpires) &&
+		hmac.Equal(sig, agentHMAC(secrets.Pending, message)) {
+		if err := promoteAgentSecret(assetID, secrets.PendingID); err != nil {
+			return err
+		}
+		return nil
+	}
+	return ErrInvalidAgentSignature
+}
+
+func promoteAgentSecret(assetID, rotationID string) error {
+	settings, err := GetAgentSecretRotation()
+	if err != nil {
+		return err
+	}
+	overlap := time.Duration(settings.OverlapHours) * time.Hour
+	ok, err := mysql.PromotePendingAgentSecret(assetID, rotationID, time.Now().Add(overlap))
+	if err != nil {
+		return err
+	}
+	if ok {
+		zap.L().Info("Agent secret rotated",
+			zap.String("asset_id", assetID),
+			zap.String("rotation_id", rotationID),
+			zap.Duration("overlap", overlap))
+	}
+	return nil
+}
+
+// RotateAgentSecret 生成新密钥，用 Agent 公钥加密后通过长连接下发（rotate_secret），
+// Agent 保存后回复 rotate_secret_ack，服务端收到确认才启用新密钥；Agent 必须在线
+func RotateAgentSecret(assetID, by string) (string, error) {
+	conn, ok := agent.Get(assetID)
+	if !ok {
+		return "", agent.ErrAgentOffline
+	}
+	asset, err := mysql.GetAssetByID(assetID)
+	if err != nil {
+		return "", err
+	}
+	settings, err := GetAgentSecretRotation()
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := newAgentSecret()
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := encryptForClient(asset.ClientPubKey, secret)
+	if err != nil {
+		return "", err
+	}
+	rotationID := uuid.New().String()
+	if err := mysql.SetPendingAgentSecret(assetID, secret, rotationID, time.Now().Add(pendingSecretTTL)); err != nil {
+		return "", err
+	}
+
+	err = conn.WriteJSON(map[string]interface{}{
+		"type":             "rotate_secret",
+		"rotation_id":      rotationID,
+		"encrypted_secret": encrypted,
+		"overlap_seconds":  settings.OverlapHours * 3600,
+	})
+	if err != nil {
+		_ = mysql.ClearPendingAgentSecret(assetID, rotationID)
+		return "", fmt.Errorf("send rotate_secret failed: %w", err)
+	}
+	zap.L().Info("Agent secret rotation started",
+		zap.String("asset_id", assetID),
+		zap.String("rotation_id", rotationID),
+		zap.String("by", by))
+	return rotationID, nil
+}
+
+// ConfirmAgentSecretRotation 处理 Agent 的 rotate_secret_ack：签名须由新密钥生成；Agent 报告失败时丢弃新密钥
+func ConfirmAgentSecretRotation(assetID, rotationID, signatureB64, agentErr string) error {
+	secrets, err := mysql.GetAgentSecrets(assetID)
+	if err != nil {
+		return err
+	}
+	if rotationID == "" || secrets.PendingID != rotationID || secrets.Pending == "" {
+		return fmt.Errorf("unknown rotation %q", rotationID)
+	}
+	if agentErr != "" {
+		zap.L().Warn("Agent failed to apply new secret",
+			zap.String("asset_id", assetID),
+			zap.String("rotation_id", rotationID),
+			zap.String("error", agentErr))
+		return mysql.ClearPendingAgentSecret(assetID, rotationID)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil || !hmac.Equal(sig, agentHMAC(secrets.Pending, rotationAckMessage(assetID, rotationID))) {
+		return ErrInvalidAgentSignature
+	}
+	return promoteAgentSecret(assetID, rotationID)
+}
+
+// defaultAgentSecretRotation 未配置时不定期轮换，旧密钥过渡期 24 小时
+func defaultAgentSecretRotation() *model.AgentSecretRotation {
+	return &model.AgentSecretRotation{OverlapHours: 24}
+}
+
+// GetAgentSecretRotation 读取 Agent 密钥轮换设置
+func GetAgentSecretRotation() (*model.AgentSecretRotation, error) {
+	s := defaultAgentSecretRotation()
+	if _, err := mysql.GetSetting(agentSecretRotationSetting, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SaveAgentSecretRotation 校验并保存 Agent 密钥轮换设置
+func SaveAgentSecretRotation(s *model.AgentSecretRotation, updatedBy string) error {
+	if s.IntervalDays < 0 || s.IntervalDays > 3650 {
+		return fmt.Errorf("%w: interval_days must be between 0 and 3650", ErrInvalidRotationSettings)
+	}
+	if s.OverlapHours < 1 || s.OverlapHours > 720 {
+		return fmt.Errorf("%w: overlap_hours must be between 1 and 720", ErrInvalidRotationSettings)
+	}
+	return mysql.SaveSetting(agentSecretRotationSetting, s, updatedBy)
+}
+
+// RotateDueAgentSecrets 定期轮换：对超过轮换周期的在线 Agent 发起轮换，离线的等下次上线后再轮换
+func RotateDueAgentSecrets() {
+	settings, err := GetAgentSecretRotation()
+	if err != nil {
+		zap.L().Error("Failed to load agent secret rotation settings", zap.Error(err))
+		return
+	}
+	if settings.IntervalDays <= 0 {
+		return
+	}
+	ids, err := mysql.ListAgentSecretRotationDue(time.Now().AddDate(0, 0, -settings.IntervalDays))
+	if err != nil {
+		zap.L().Error("Failed to list agents due for secret rotation", zap.Error(err))
+		return
+	}
+	for _, id := range ids {
+		if _, online := agent.Get(id); !online {
+			continue
+		}
+		if _, err := RotateAgentSecret(id, "scheduler"); err != nil {
+			zap.L().Warn("Scheduled agent secret rotation failed", zap.String("asset_id", id), zap.Error(err))
+		}
+	}
+}
+
+// CleanupAgentSecrets 清除过期的旧密钥和超时未确认的新密钥
+func CleanupAgentSecrets() {
+	n, err := mysql.CleanupAgentSecrets()
+	if err != nil {
+		zap.L().Error("Failed to cleanup agent secrets", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		zap.L().Info("Cleaned up expired agent secrets", zap.Int64("count", n))
+	}
+}
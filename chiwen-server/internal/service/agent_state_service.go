@@ -0,0 +1,102 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/chiwen/server/internal/api/agent"
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrAgentRevoked Agent 已被吊销（或资产已删除），心跳、长连接和重新注册都被拒绝
+	ErrAgentRevoked = errors.New("agent revoked")
+	// ErrAgentQuarantined 资产已隔离，禁止建立终端会话
+	ErrAgentQuarantined = errors.New("machine is quarantined")
+)
+
+// RevokeAgent 吊销 Agent：作废密钥并断开长连接（连接上的终端会话随之关闭），不可恢复
+func RevokeAgent(assetID, reason, by string) error {
+	ok, err := mysql.RevokeAgent(assetID, reason, by)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return sql.ErrNoRows
+	}
+	online := agent.Disconnect(assetID)
+	zap.L().Warn("Agent revoked",
+		zap.String("asset_id", assetID),
+		zap.String("reason", reason),
+		zap.String("by", by),
+		zap.Bool("was_online", online))
+	return nil
+}
+
+// QuarantineAgent 隔离资产：关闭正在进行的终端会话，之后禁止新建；心跳照常接收
+func QuarantineAgent(assetID, reason, by string) error {
+	if err := setAgentQuarantine(assetID, true, reason, by); err != nil {
+		return err
+	}
+	if conn, ok := agent.Get(assetID); ok {
+		agent.Sessions.CloseAgent(conn, "资产已被隔离")
+	}
+	zap.L().Warn("Agent quarantined",
+		zap.String("asset_id", assetID),
+		zap.String("reason", reason),
+		zap.String("by", by))
+	return nil
+}
+
+// ReleaseAgentQuarantine 解除隔离
+func ReleaseAgentQuarantine(assetID, by string) error {
+	if err := setAgentQuarantine(assetID, false, "", by); err != nil {
+		return err
+	}
+	zap.L().Info("Agent quarantine released", zap.String("asset_id", assetID), zap.String("by", by))
+	return nil
+}
+
+func setAgentQuarantine(assetID string, quarantined bool, reason, by string) error {
+	ok, err := mysql.SetAgentQuarantine(assetID, quarantined, reason, by)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+	// 未生效：资产不存在，或已吊销
+	secrets, err := mysql.GetAgentSecrets(assetID)
+	if err != nil {
+		return err
+	}
+	if secrets.Deleted {
+		return sql.ErrNoRows
+	}
+	return ErrAgentRevoked
+}
+
+// checkAgentState 终端会话只允许连接正常状态的 Agent
+func checkAgentState(state string) error {
+	switch state {
+	case model.AgentStateQuarantined:
+		return ErrAgentQuarantined
+	case model.AgentStateRevoked:
+		return ErrAgentRevoked
+	}
+	return nil
+}
+
+// CheckAgentTTYAllowed 建立终端会话前检查资产未被隔离或吊销（已签发的 token 在隔离后也不能使用）
+func CheckAgentTTYAllowed(assetID string) error {
+	secrets, err := mysql.GetAgentSecrets(assetID)
+	if err != nil {
+		return err
+	}
+	if secrets.Deleted {
+		return ErrAgentRevoked
+	}
+	return checkAgentState(secrets.State)
+}
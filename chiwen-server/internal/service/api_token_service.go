@@ -0,0 +1,148 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultAPITokenDays 未指定有效期时 API 令牌的有效天数
+	defaultAPITokenDays = 90
+	// maxAPITokenDays API 令牌最长有效天数
+	maxAPITokenDays = 365
+	// apiTokenTouchInterval 最近使用时间的更新间隔，避免每个请求都写库
+	apiTokenTouchInterval = time.Minute
+)
+
+var (
+	// ErrInvalidAPIToken 令牌不存在、已吊销、已过期或所属用户已禁用
+	ErrInvalidAPIToken = errors.New("invalid api token")
+	// ErrInvalidAPITokenRequest 名称、有效期或权限范围不合法
+	ErrInvalidAPITokenRequest = errors.New("invalid api token request")
+)
+
+// APIIdentity 通过 API 令牌认证的身份
+type APIIdentity struct {
+	Token *model.APIToken
+	User  *model.UserProfile
+}
+
+// CreateAPIToken 为 owner 签发 API 令牌，返回只展示一次的明文令牌；
+// scopes 不能超出 owner 当前拥有的权限，days 为 0 时使用默认有效期
+func CreateAPIToken(owner *model.UserProfile, operatorID uint, operatorIsAdmin bool, name string, scopes []string, days int, createdBy string) (string, *model.APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return "", nil, fmt.Errorf("%w: name must be 1-64 characters", ErrInvalidAPITokenRequest)
+	}
+	if days == 0 {
+		days = defaultAPITokenDays
+	}
+	if days < 0 || days > maxAPITokenDays {
+		return "", nil, fmt.Errorf("%w: expires_in_days must be between 1 and %d", ErrInvalidAPITokenRequest, maxAPITokenDays)
+	}
+	if len(scopes) == 0 {
+		return "", nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPITokenRequest)
+	}
+	granted := model.StringList{}
+	for _, s := range scopes {
+		if !model.IsValidPermission(s) {
+			return "", nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidAPITokenRequest, s)
+		}
+		ok, err := HasPermission(owner.ID, owner.IsAdmin, s)
+		if err != nil {
+			return "", nil, err
+		}
+		if !ok {
+			return "", nil, fmt.Errorf("%w: user %s does not have permission %q", ErrInvalidAPITokenRequest, owner.Username, s)
+		}
+		// 明文令牌返回给操作人，scopes 同样不能超出操作人自己的权限
+		if operatorID != owner.ID {
+			ok, err := HasPermission(operatorID, operatorIsAdmin, s)
+			if err != nil {
+				return "", nil, err
+			}
+			if !ok {
+				return "", nil, fmt.Errorf("%w: operator does not have permission %q", ErrInvalidAPITokenRequest, s)
+			}
+		}
+		if !granted.Contains(s) {
+			granted = append(granted, s)
+		}
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	raw := model.APITokenPrefix + secret
+	t := &model.APIToken{
+		UserID:      owner.ID,
+		Name:        name,
+		TokenPrefix: raw[:len(model.APITokenPrefix)+6],
+		TokenHash:   hashToken(raw),
+		Scopes:      granted,
+		ExpiresAt:   time.Now().Add(time.Duration(days) * 24 * time.Hour).Truncate(time.Second),
+		CreatedBy:   createdBy,
+	}
+	if err := mysql.CreateAPIToken(t); err != nil {
+		return "", nil, err
+	}
+	zap.L().Info("API token created",
+		zap.Uint("id", t.ID),
+		zap.String("owner", owner.Username),
+		zap.Strings("scopes", granted),
+		zap.String("by", createdBy))
+	return raw, t, nil
+}
+
+// AuthenticateAPIToken 校验 API 令牌：未吊销、未过期、所属用户启用中，来源 IP 受全局和用户登录白名单限制
+func AuthenticateAPIToken(raw, clientIP string) (*APIIdentity, error) {
+	t, err := mysql.GetAPITokenByHash(hashToken(raw))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAPIToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if t.RevokedAt != nil || now.After(t.ExpiresAt) {
+		return nil, ErrInvalidAPIToken
+	}
+	user, err := mysql.GetUserProfile(t.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAPIToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrInvalidAPIToken
+	}
+	if err := checkRefreshIP(user, clientIP); err != nil {
+		return nil, err
+	}
+
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > apiTokenTouchInterval || t.LastUsedIP != clientIP {
+		if err := mysql.TouchAPIToken(t.ID, clientIP, now); err != nil {
+			zap.L().Warn("Failed to update api token last used", zap.Uint("id", t.ID), zap.Error(err))
+		}
+	}
+	return &APIIdentity{Token: t, User: user}, nil
+}
+
+// ListAPITokens 查询用户的 API 令牌
+func ListAPITokens(userID uint) ([]model.APIToken, error) {
+	return mysql.ListAPITokens(userID)
+}
+
+// RevokeAPIToken 吊销用户的 API 令牌，立即生效
+func RevokeAPIToken(userID, id uint) error {
+	return mysql.RevokeAPIToken(userID, id)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"go.uber.org/zap"
+)
+
+// ErrAssetNotAuthorized 没有生效的授权规则覆盖该用户和资产
+var ErrAssetNotAuthorized = errors.New("user is not allowed to access this machine")
+
+// AccessGrant 一次终端访问的授权主体及判定结果
+type AccessGrant struct {
+	UserID   uint
+	GroupIDs []uint
+	IsAdmin  bool // 管理员不受授权规则限制
+
+	// Accounts 命中的授权规则限定的主机账号，nil 表示不限
+	Accounts []string
+	RuleIDs  []int64
+}
+
+// NewAccessGrant 以登录用户身份创建授权主体，并加载其所属用户组
+func NewAccessGrant(userID uint, isAdmin bool) *AccessGrant {
+	g := &AccessGrant{UserID: userID, IsAdmin: isAdmin}
+	if groups, err := mysql.GetUserGroupIDs(userID); err == nil {
+		g.GroupIDs = groups
+	} else {
+		zap.L().Warn("Failed to load user groups for asset authorization", zap.Uint("user_id", userID), zap.Error(err))
+	}
+	return g
+}
+
+// UserIDString 用户ID的字符串形式（tty_sessions 等表中 user_id 为字符串）
+func (g *AccessGrant) UserIDString() string {
+	return strconv.FormatUint(uint64(g.UserID), 10)
+}
+
+// permitsAccount 判断授权规则是否允许使用该主机账号
+func (g *AccessGrant) permitsAccount(osUsername string) bool {
+	if g.Accounts == nil {
+		return true
+	}
+	for _, a := range g.Accounts {
+		if a == osUsername {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAssetAccess 按资产授权规则判定用户能否访问资产，并把命中规则限定的主机账号记到 grant 上
+func CheckAssetAccess(grant *AccessGrant, asset *model.Asset) error {
+	if grant.IsAdmin {
+		grant.Accounts, grant.RuleIDs = nil, nil
+		return nil
+	}
+
+	rules, err := mysql.ListEnabledAssetAuthRules()
+	if err != nil {
+		return fmt.Errorf("failed to load asset auth rules: %w", err)
+	}
+
+	matched, accounts, unrestricted := evaluateAssetAccess(grant, rules, asset, time.Now())
+	if len(matched) == 0 {
+		zap.L().Warn("Asset access denied",
+			zap.Uint("user_id", grant.UserID),
+			zap.String("asset_id", asset.ID))
+		return ErrAssetNotAuthorized
+	}
+
+	grant.RuleIDs = matched
+	grant.Accounts = nil
+	if !unrestricted {
+		grant.Accounts = accounts
+	}
+	zap.L().Debug("Asset access granted",
+		zap.Uint("user_id", grant.UserID),
+		zap.String("asset_id", asset.ID),
+		zap.Int64s("rule_ids", matched))
+	return nil
+}
+
+// evaluateAssetAccess 找出授权给该用户且覆盖该资产的生效规则，汇总规则限定的主机账号
+func evaluateAssetAccess(grant *AccessGrant, rules []model.AssetAuthRule, asset *model.Asset, now time.Time) (matched []int64, accounts []string, unrestricted bool) {
+	labels, err := asset.GetLabelsJSON()
+	if err != nil {
+		labels = map[string]interface{}{}
+	}
+	for i := range rules {
+		r := &rules[i]
+		if !r.ActiveAt(now) || !r.MatchesUser(grant.UserID, grant.GroupIDs) || !r.MatchesAsset(asset.ID, labels) {
+			continue
+		}
+		matched = append(matched, r.ID)
+		if len(r.HostAccounts) == 0 {
+			unrestricted = true
+		}
+		accounts = append(accounts, r.HostAccounts...)
+	}
+	return matched, accounts, unrestricted
+}
+
+// HasAccessToAssets 判断用户是否被授权访问 assets 中的任意一台（管理员总是返回 true）
+func HasAccessToAssets(grant *AccessGrant, assets []model.Asset) (bool, error) {
+	if grant.IsAdmin {
+		return len(assets) > 0, nil
+	}
+	rules, err := mysql.ListEnabledAssetAuthRules()
+	if err != nil {
+		return false, fmt.Errorf("failed to load asset auth rules: %w", err)
+	}
+	now := time.Now()
+	for i := range assets {
+		if matched, _, _ := evaluateAssetAccess(grant, rules, &assets[i], now); len(matched) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ValidateAssetAuthRule 校验资产授权规则
+func ValidateAssetAuthRule(rule *model.AssetAuthRule) error {
+	if len(rule.UserIDs) == 0 && len(rule.GroupIDs) == 0 {
+		return errors.New("user_ids or group_ids is required")
+	}
+	if len(rule.AssetIDs) == 0 && len(rule.AssetLabels) == 0 {
+		return errors.New("asset_ids or asset_labels is required")
+	}
+	for _, a := range rule.HostAccounts {
+		if !osUsernamePattern.MatchString(a) {
+			return fmt.Errorf("invalid host account %q", a)
+		}
+	}
+	if rule.ValidFrom != nil && rule.ValidUntil != nil && !rule.ValidUntil.After(*rule.ValidFrom) {
+		return errors.New("valid_until must be after valid_from")
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+)
+
+// maxAuditExport 单次导出的审计事件上限
+const maxAuditExport = 100000
+
+// auditRedacted 审计记录中脱敏的字段（不区分大小写，包含 password/secret/token 的字段一律脱敏）
+var auditRedacted = map[string]bool{
+	"code":           true, // MFA 验证码
+	"recovery_codes": true,
+	"private_key":    true,
+}
+
+func redactKey(key string) bool {
+	k := strings.ToLower(key)
+	return auditRedacted[k] || strings.Contains(k, "password") || strings.Contains(k, "secret") || strings.Contains(k, "token")
+}
+
+func redact(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if redactKey(k) {
+				t[k] = "******"
+			} else {
+				t[k] = redact(child)
+			}
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = redact(t[i])
+		}
+	}
+	return v
+}
+
+// AuditJSON 把任意值（结构体、map 或原始 JSON）转换为脱敏后的 JSON，无法解析时返回 nil
+func AuditJSON(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	raw, ok := v.([]byte)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(v); err != nil {
+			return nil
+		}
+	}
+	var decoded interface{}
+	if len(raw) == 0 || json.Unmarshal(raw, &decoded) != nil {
+		return nil
+	}
+	out, err := json.Marshal(redact(decoded))
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// AuditDiff 对比变更前后的 JSON 对象，返回有变化的字段 {"field":{"before":x,"after":y}}；
+// after 通常是部分更新的请求体，只比较 after 中出现的字段
+func AuditDiff(before, after json.RawMessage) json.RawMessage {
+	var b, a map[string]interface{}
+	if json.Unmarshal(before, &b) != nil || json.Unmarshal(after, &a) != nil || b == nil || a == nil {
+		return nil
+	}
+	diff := make(map[string]map[string]interface{})
+	for k, av := range a {
+		if bv, ok := b[k]; !ok || !reflect.DeepEqual(bv, av) {
+			diff[k] = map[string]interface{}{"before": b[k], "after": av}
+		}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	out, _ := json.Marshal(diff)
+	return out
+}
+
+// RecordAuditEvent 写入审计事件
+func RecordAuditEvent(e *model.AuditEvent) error {
+	if len(e.Path) > 512 {
+		e.Path = e.Path[:512]
+	}
+	if e.Diff == nil {
+		e.Diff = AuditDiff(e.Before, e.After)
+	}
+	return mysql.CreateAuditEvent(e)
+}
+
+// ListAuditEvents 分页查询审计事件
+func ListAuditEvents(f model.AuditFilter) ([]model.AuditEvent, int, error) {
+	if f.Page <= 0 {
+		f.Page = 1
+	}
+	if f.PageSize <= 0 || f.PageSize > 100 {
+		f.PageSize = 20
+	}
+	return mysql.ListAuditEvents(f)
+}
+
+// ExportAuditEvents 以 JSON Lines 格式导出审计事件，每行一个事件
+func ExportAuditEvents(f model.AuditFilter, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	err := mysql.EachAuditEvent(f, maxAuditExport, func(e *model.AuditEvent) error {
+		return enc.Encode(e)
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrUserNotFound 当前认证后端不负责该用户，由下一个后端继续尝试
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInvalidCredentials 用户名或密码错误
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrUserDisabled 用户已被禁用
+	ErrUserDisabled = errors.New("user is disabled")
+)
+
+// Authenticator 登录认证后端
+type Authenticator interface {
+	// Name 后端名称，用于日志
+	Name() string
+	// Authenticate 校验用户名密码，成功时返回本地用户记录；
+	// 后端不负责该用户时返回 ErrUserNotFound
+	Authenticate(username, password string) (*model.User, error)
+}
+
+// LocalAuthenticator 本地账号（users.password_hash，bcrypt）
+type LocalAuthenticator struct{}
+
+// Name 实现 Authenticator
+func (LocalAuthenticator) Name() string { return "local" }
+
+// Authenticate 实现 Authenticator；LDAP 同步的用户交给 LDAP 后端
+func (LocalAuthenticator) Authenticate(username, password string) (*model.User, error) {
+	user, err := mysql.GetUserByUsername(username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if user.LdapDN.String != "" {
+		return nil, ErrUserNotFound
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if !user.IsActive {
+		return nil, ErrUserDisabled
+	}
+	return user, nil
+}
+
+var (
+	authenticators     []Authenticator
+	authenticatorsOnce sync.Once
+)
+
+// loadAuthenticators 按配置组装认证后端：本地账号总是启用，auth.ldap.enabled 时追加 LDAP
+func loadAuthenticators() []Authenticator {
+	authenticatorsOnce.Do(func() {
+		authenticators = []Authenticator{LocalAuthenticator{}}
+		if viper.GetBool("auth.ldap.enabled") {
+			cfg, err := LoadLDAPConfig()
+			if err != nil {
+				zap.L().Error("LDAP 配置无效，已禁用 LDAP 登录", zap.Error(err))
+				return
+			}
+			authenticators = append(authenticators, NewLDAPAuthenticator(cfg, nil))
+			zap.L().Info("LDAP 登录已启用", zap.String("url", cfg.URL))
+		}
+	})
+	return authenticators
+}
+
+// Authenticate 依次尝试各认证后端
+func Authenticate(username, password string) (*model.User, error) {
+	// 空密码会被 LDAP 当作匿名绑定而"成功"，必须在这里拒绝
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	for _, a := range loadAuthenticators() {
+		user, err := a.Authenticate(username, password)
+		if errors.Is(err, ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			zap.L().Debug("Authentication failed", zap.String("backend", a.Name()), zap.String("username", username), zap.Error(err))
+			return nil, err
+		}
+		return user, nil
+	}
+	return nil, ErrInvalidCredentials
+}
@@ -0,0 +1,291 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ErrApprovalNotPending 审批单不存在或已被处理
+var ErrApprovalNotPending = errors.New("approval not found or already decided")
+
+// compiledRule 预编译正则后的规则
+type compiledRule struct {
+	model.CommandRule
+	re *regexp.Regexp
+}
+
+// PolicySubject 命令所在会话的上下文，会话建立时解析一次
+type PolicySubject struct {
+	SessionID   string
+	AssetID     string
+	UserID      string
+	userID      uint
+	groupIDs    []uint
+	assetLabels map[string]interface{}
+}
+
+// PolicyDecision 命令检查结果，Rule 为 nil 表示放行
+type PolicyDecision struct {
+	Action string
+	Rule   *model.CommandRule
+}
+
+// CommandPolicy 命令拦截策略引擎，规则缓存在内存中，修改规则或缓存过期后重新加载
+type CommandPolicy struct {
+	mu       sync.RWMutex
+	rules    []compiledRule
+	loaded   bool // 是否成功加载过，加载失败时沿用上一次的规则
+	loadedAt time.Time
+
+	waitersMu sync.Mutex
+	waiters   map[string]chan string // 审批单ID → 审批结果
+}
+
+const commandRuleCacheTTL = 30 * time.Second
+
+// DefaultCommandPolicy 全局策略引擎
+var DefaultCommandPolicy = &CommandPolicy{waiters: make(map[string]chan string)}
+
+// NewPolicySubject 解析会话用户所属用户组和资产标签
+func NewPolicySubject(sessionID, assetID, userID string) *PolicySubject {
+	s := &PolicySubject{SessionID: sessionID, AssetID: assetID, UserID: userID}
+
+	if id, err := strconv.ParseUint(userID, 10, 64); err == nil {
+		s.userID = uint(id)
+		if groups, err := mysql.GetUserGroupIDs(s.userID); err == nil {
+			s.groupIDs = groups
+		} else {
+			zap.L().Warn("Failed to load user groups for command policy", zap.String("user_id", userID), zap.Error(err))
+		}
+	}
+
+	if asset, err := mysql.GetAssetByID(assetID); err == nil {
+		if labels, err := asset.GetLabelsJSON(); err == nil {
+			s.assetLabels = labels
+		}
+	}
+	return s
+}
+
+// Invalidate 规则变更后清空缓存
+func (p *CommandPolicy) Invalidate() {
+	p.mu.Lock()
+	p.loadedAt = time.Time{}
+	p.mu.Unlock()
+}
+
+func (p *CommandPolicy) loadRules() ([]compiledRule, error) {
+	p.mu.RLock()
+	if time.Since(p.loadedAt) < commandRuleCacheTTL {
+		rules := p.rules
+		p.mu.RUnlock()
+		return rules, nil
+	}
+	p.mu.RUnlock()
+
+	rules, err := mysql.ListCommandRules()
+	if err != nil {
+		p.mu.RLock()
+		defer p.mu.RUnlock()
+		if p.loaded {
+			return p.rules, err
+		}
+		return nil, err
+	}
+
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, r := range rules {
+		if !r.Enabled {
+			continue
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			zap.L().Warn("Skip command rule with invalid pattern", zap.Int64("rule_id", r.ID), zap.Error(err))
+			continue
+		}
+		compiled = append(compiled, compiledRule{CommandRule: r, re: re})
+	}
+	// 优先级高的先匹配；同优先级 deny 优先于 confirm
+	sort.SliceStable(compiled, func(i, j int) bool {
+		if compiled[i].Priority != compiled[j].Priority {
+			return compiled[i].Priority > compiled[j].Priority
+		}
+		return compiled[i].Action == model.CommandActionDeny && compiled[j].Action != model.CommandActionDeny
+	})
+
+	p.mu.Lock()
+	p.rules, p.loaded, p.loadedAt = compiled, true, time.Now()
+	p.mu.Unlock()
+	return compiled, nil
+}
+
+// rulesUnavailable 规则从未加载成功时用于拒绝命令的占位规则
+var rulesUnavailable = model.CommandRule{Name: "命令规则加载失败", Action: model.CommandActionDeny}
+
+// Check 检查一条命令。partial 表示命令行无法完整还原（方向键、Tab 补全、历史命令等），
+// 实际执行的命令未知，只要有规则适用于该会话就拒绝执行（审批人同样无法判断命令内容）。
+// 规则加载失败时沿用上一次加载的规则，从未加载成功则拒绝所有命令
+func (p *CommandPolicy) Check(subject *PolicySubject, command string, partial bool) PolicyDecision {
+	rules, err := p.loadRules()
+	if err != nil {
+		zap.L().Error("Failed to load command rules", zap.Error(err))
+		if rules == nil {
+			rule := rulesUnavailable
+			return PolicyDecision{Action: model.CommandActionDeny, Rule: &rule}
+		}
+	}
+
+	for i := range rules {
+		r := &rules[i]
+		if !r.AssetLabels.MatchLabels(subject.assetLabels) {
+			continue
+		}
+		if len(r.UserIDs) > 0 || len(r.GroupIDs) > 0 {
+			if !r.UserIDs.Contains(subject.userID) && !r.GroupIDs.Intersects(subject.groupIDs) {
+				continue
+			}
+		}
+		if partial {
+			rule := r.CommandRule
+			return PolicyDecision{Action: model.CommandActionDeny, Rule: &rule}
+		}
+		if r.re.MatchString(command) {
+			rule := r.CommandRule
+			return PolicyDecision{Action: r.Action, Rule: &rule}
+		}
+	}
+	return PolicyDecision{}
+}
+
+// ApprovalTimeout 等待审批的超时时间，默认 5 分钟
+func ApprovalTimeout() time.Duration {
+	if sec := viper.GetInt("tty.command_approval_timeout"); sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	return 5 * time.Minute
+}
+
+// RequestApproval 为命中 confirm 规则的命令创建审批单，返回的 channel 会收到最终状态（approved/rejected/expired）
+func (p *CommandPolicy) RequestApproval(subject *PolicySubject, rule *model.CommandRule, command string) (*model.CommandApproval, <-chan string, error) {
+	approval := &model.CommandApproval{
+		ID:        uuid.New().String(),
+		RuleID:    rule.ID,
+		RuleName:  rule.Name,
+		SessionID: subject.SessionID,
+		AssetID:   subject.AssetID,
+		UserID:    subject.UserID,
+		Command:   command,
+		Status:    model.ApprovalPending,
+		CreatedAt: time.Now(),
+	}
+	if err := mysql.CreateCommandApproval(approval); err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan string, 1)
+	p.waitersMu.Lock()
+	p.waiters[approval.ID] = ch
+	p.waitersMu.Unlock()
+
+	time.AfterFunc(ApprovalTimeout(), func() {
+		ok, err := mysql.DecideCommandApproval(approval.ID, model.ApprovalExpired, nil, "approval timeout")
+		if err != nil {
+			// 数据库更新失败也要结束等待，审批单之后即使被批准也没有等待方
+			zap.L().Error("Failed to expire command approval", zap.String("approval_id", approval.ID), zap.Error(err))
+		}
+		if ok || err != nil {
+			p.notify(approval.ID, model.ApprovalExpired)
+		}
+	})
+
+	zap.L().Info("Command approval requested",
+		zap.String("approval_id", approval.ID),
+		zap.String("session_id", subject.SessionID),
+		zap.String("user_id", subject.UserID),
+		zap.String("command", command))
+	return approval, ch, nil
+}
+
+// CancelApproval 用户放弃执行（Ctrl-C 或会话断开）
+func (p *CommandPolicy) CancelApproval(id string) {
+	ok, err := mysql.DecideCommandApproval(id, model.ApprovalRejected, nil, "cancelled by user")
+	if err != nil {
+		zap.L().Error("Failed to cancel command approval", zap.String("approval_id", id), zap.Error(err))
+	}
+	if ok || err != nil {
+		p.notify(id, model.ApprovalRejected)
+	}
+}
+
+// Forget 等待方自行超时放弃后移除等待通道
+func (p *CommandPolicy) Forget(id string) {
+	p.waitersMu.Lock()
+	delete(p.waiters, id)
+	p.waitersMu.Unlock()
+}
+
+// Decide 审批人处理审批单，审批人不能是命令发起人
+func (p *CommandPolicy) Decide(id string, approverID uint, approve bool, reason string) error {
+	approval, err := mysql.GetCommandApproval(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrApprovalNotPending
+		}
+		return err
+	}
+	if approval.UserID == strconv.FormatUint(uint64(approverID), 10) {
+		return errors.New("approver must be different from the command owner")
+	}
+
+	status := model.ApprovalRejected
+	if approve {
+		status = model.ApprovalApproved
+	}
+	ok, err := mysql.DecideCommandApproval(id, status, &approverID, reason)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrApprovalNotPending
+	}
+
+	p.notify(id, status)
+	zap.L().Info("Command approval decided",
+		zap.String("approval_id", id),
+		zap.String("status", status),
+		zap.Uint("approver_id", approverID))
+	return nil
+}
+
+func (p *CommandPolicy) notify(id, status string) {
+	p.waitersMu.Lock()
+	ch, ok := p.waiters[id]
+	delete(p.waiters, id)
+	p.waitersMu.Unlock()
+	if ok {
+		ch <- status
+	}
+}
+
+// ValidateCommandRule 校验规则字段
+func ValidateCommandRule(rule *model.CommandRule) error {
+	if rule.Action != model.CommandActionDeny && rule.Action != model.CommandActionConfirm {
+		return fmt.Errorf("invalid action: %s", rule.Action)
+	}
+	if _, err := regexp.Compile(rule.Pattern); err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	return nil
+}
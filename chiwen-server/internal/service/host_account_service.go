@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+)
+
+// osUsernamePattern 与 useradd 默认的 NAME_REGEX 保持一致
+var osUsernamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_.-]{0,30}\$?$`)
+
+// ErrHostAccountNotAllowed 用户无权使用请求的主机账号
+var ErrHostAccountNotAllowed = errors.New("host account not allowed")
+
+// ValidateHostAccount 校验主机账号配置
+func ValidateHostAccount(a *model.HostAccount) error {
+	if !osUsernamePattern.MatchString(a.OSUsername) {
+		return fmt.Errorf("invalid os_username %q", a.OSUsername)
+	}
+	if len(a.Description) > 255 {
+		return errors.New("description is too long")
+	}
+	return nil
+}
+
+// AllowedHostAccounts 过滤出授权主体可以使用的主机账号：
+// 账号本身的用户/用户组范围（管理员不受限）与授权规则限定的账号同时满足
+func AllowedHostAccounts(accounts []model.HostAccount, grant *AccessGrant) []model.HostAccount {
+	allowed := make([]model.HostAccount, 0, len(accounts))
+	for _, a := range accounts {
+		if !a.Enabled || !grant.permitsAccount(a.OSUsername) {
+			continue
+		}
+		if grant.IsAdmin || a.Allows(grant.UserID, grant.GroupIDs) {
+			allowed = append(allowed, a)
+		}
+	}
+	return allowed
+}
+
+// ResolveHostAccount 确定本次终端会话使用的主机账号，grant 需已经过 CheckAssetAccess
+//
+//	资产未配置任何账号时沿用 Agent 运行账号（返回空串），此时不能指定账号，授权规则也不能限定账号；
+//	指定了 requested 时必须是用户可用的账号；
+//	未指定时优先使用默认账号，否则使用第一个可用账号。
+func ResolveHostAccount(assetID string, grant *AccessGrant, requested string) (string, error) {
+	accounts, err := mysql.ListHostAccounts(assetID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load host accounts: %w", err)
+	}
+	if len(accounts) == 0 {
+		if requested != "" || grant.Accounts != nil {
+			return "", fmt.Errorf("%w: no host account configured on this machine", ErrHostAccountNotAllowed)
+		}
+		return "", nil
+	}
+
+	allowed := AllowedHostAccounts(accounts, grant)
+	if requested != "" {
+		for _, a := range allowed {
+			if a.OSUsername == requested {
+				return a.OSUsername, nil
+			}
+		}
+		return "", fmt.Errorf("%w: %s", ErrHostAccountNotAllowed, requested)
+	}
+
+	// ListHostAccounts 已把默认账号排在前面
+	if len(allowed) == 0 {
+		return "", fmt.Errorf("%w: no host account available for this user", ErrHostAccountNotAllowed)
+	}
+	return allowed[0].OSUsername, nil
+}
@@ -0,0 +1,358 @@
+package service
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ldapPasswordPlaceholder LDAP 用户在本地没有密码，写入一个不可能通过 bcrypt 校验的值
+const ldapPasswordPlaceholder = "!ldap"
+
+// LDAPGroupMapping LDAP 组到本地用户组的映射
+type LDAPGroupMapping struct {
+	LDAPGroup string `mapstructure:"ldap_group"` // 组 DN
+	UserGroup string `mapstructure:"user_group"` // 本地用户组名，不存在时自动创建
+}
+
+// LDAPConfig LDAP / Active Directory 配置（auth.ldap.*）
+type LDAPConfig struct {
+	URL                string        `mapstructure:"url"` // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool          `mapstructure:"start_tls"`
+	InsecureSkipVerify bool          `mapstructure:"insecure_skip_verify"`
+	Timeout            time.Duration `mapstructure:"timeout"`
+
+	// 查询用户使用的服务账号，为空时匿名查询
+	BindDN       string `mapstructure:"bind_dn"`
+	BindPassword string `mapstructure:"bind_password"`
+
+	BaseDN     string `mapstructure:"base_dn"`
+	UserFilter string `mapstructure:"user_filter"` // %s 替换为转义后的用户名
+
+	NameAttr  string `mapstructure:"name_attr"`
+	EmailAttr string `mapstructure:"email_attr"`
+	PhoneAttr string `mapstructure:"phone_attr"`
+	GroupAttr string `mapstructure:"group_attr"` // 用户条目上记录所属组的属性，如 memberOf
+
+	// 目录不支持 memberOf 时按组搜索，GroupFilter 中 %s 替换为转义后的用户 DN
+	GroupBaseDN string `mapstructure:"group_base_dn"`
+	GroupFilter string `mapstructure:"group_filter"`
+
+	// AdminGroups 属于其中任一组的用户为管理员；为空时不同步管理员标记
+	AdminGroups  []string           `mapstructure:"admin_groups"`
+	GroupMapping []LDAPGroupMapping `mapstructure:"group_mapping"`
+}
+
+// LoadLDAPConfig 读取 auth.ldap 配置并补全默认值（默认值按 OpenLDAP，AD 需配置 sAMAccountName 过滤器）
+func LoadLDAPConfig() (LDAPConfig, error) {
+	var cfg LDAPConfig
+	if err := viper.UnmarshalKey("auth.ldap", &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return cfg, errors.New("auth.ldap.url and auth.ldap.base_dn are required")
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(&(objectClass=person)(uid=%s))"
+	}
+	if cfg.NameAttr == "" {
+		cfg.NameAttr = "displayName"
+	}
+	if cfg.EmailAttr == "" {
+		cfg.EmailAttr = "mail"
+	}
+	if cfg.PhoneAttr == "" {
+		cfg.PhoneAttr = "telephoneNumber"
+	}
+	if cfg.GroupAttr == "" {
+		cfg.GroupAttr = "memberOf"
+	}
+	if cfg.GroupBaseDN != "" && cfg.GroupFilter == "" {
+		cfg.GroupFilter = "(|(member=%s)(uniqueMember=%s))"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return cfg, nil
+}
+
+// LDAPConn LDAP 连接中认证用到的操作，*ldap.Conn 实现了该接口；测试时可替换为进程内的假目录
+type LDAPConn interface {
+	Bind(username, password string) error
+	Search(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// LDAPDialFunc 建立 LDAP 连接
+type LDAPDialFunc func(cfg LDAPConfig) (LDAPConn, error)
+
+// dialLDAP 默认的连接方式，支持 ldaps:// 和 StartTLS
+func dialLDAP(cfg LDAPConfig) (LDAPConn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	conn, err := ldap.DialURL(cfg.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(cfg.Timeout)
+	if cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// ldapUserStore LDAP 用户同步到本地时用到的用户表操作，默认为 MySQL；测试时可替换为内存实现
+type ldapUserStore interface {
+	GetUserByUsername(username string) (*model.User, error)
+	CreateUser(u *model.User) (uint, error)
+	UpdateLDAPUser(id uint, dn, name, email, phone string, isAdmin *bool) error
+	SyncUserGroupsByName(userID uint, managed, member []string) error
+}
+
+type mysqlUserStore struct{}
+
+func (mysqlUserStore) GetUserByUsername(username string) (*model.User, error) {
+	return mysql.GetUserByUsername(username)
+}
+
+func (mysqlUserStore) CreateUser(u *model.User) (uint, error) {
+	return mysql.CreateUser(u)
+}
+
+func (mysqlUserStore) UpdateLDAPUser(id uint, dn, name, email, phone string, isAdmin *bool) error {
+	return mysql.UpdateLDAPUser(id, dn, name, email, phone, isAdmin)
+}
+
+func (mysqlUserStore) SyncUserGroupsByName(userID uint, managed, member []string) error {
+	return mysql.SyncUserGroupsByName(userID, managed, member)
+}
+
+// LDAPAuthenticator LDAP / AD 认证：服务账号查询用户 DN → 以用户 DN 绑定校验密码 → 同步到本地 users
+type LDAPAuthenticator struct {
+	cfg   LDAPConfig
+	dial  LDAPDialFunc
+	users ldapUserStore
+}
+
+// NewLDAPAuthenticator 创建 LDAP 认证后端，dial 为 nil 时使用默认连接方式
+func NewLDAPAuthenticator(cfg LDAPConfig, dial LDAPDialFunc) *LDAPAuthenticator {
+	if dial == nil {
+		dial = dialLDAP
+	}
+	return &LDAPAuthenticator{cfg: cfg, dial: dial, users: mysqlUserStore{}}
+}
+
+// Name 实现 Authenticator
+func (a *LDAPAuthenticator) Name() string { return "ldap" }
+
+// ldapEntry 目录中查到的用户信息
+type ldapEntry struct {
+	DN     string
+	Name   string
+	Email  string
+	Phone  string
+	Groups []string
+}
+
+// Authenticate 实现 Authenticator
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*model.User, error) {
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial(a.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("connect ldap: %w", err)
+	}
+	defer conn.Close()
+
+	entry, err := a.lookup(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap bind: %w", err)
+	}
+
+	// 用户绑定后权限可能不足以查询组，重新以服务账号绑定
+	if a.cfg.GroupBaseDN != "" {
+		if err := a.bindService(conn); err != nil {
+			return nil, err
+		}
+		groups, err := a.searchGroups(conn, entry.DN)
+		if err != nil {
+			return nil, err
+		}
+		entry.Groups = append(entry.Groups, groups...)
+	}
+
+	return a.provision(username, entry)
+}
+
+func (a *LDAPAuthenticator) bindService(conn LDAPConn) error {
+	if a.cfg.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+		return fmt.Errorf("ldap service bind: %w", err)
+	}
+	return nil
+}
+
+// lookup 以服务账号查询用户条目，找不到或不唯一时视为不存在
+func (a *LDAPAuthenticator) lookup(conn LDAPConn, username string) (*ldapEntry, error) {
+	if err := a.bindService(conn); err != nil {
+		return nil, err
+	}
+
+	req := ldap.NewSearchRequest(
+		a.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(a.cfg.Timeout.Seconds()), false,
+		strings.ReplaceAll(a.cfg.UserFilter, "%s", ldap.EscapeFilter(username)),
+		[]string{"dn", a.cfg.NameAttr, "cn", a.cfg.EmailAttr, a.cfg.PhoneAttr, a.cfg.GroupAttr},
+		nil,
+	)
+	result, err := conn.Search(req)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		if len(result.Entries) > 1 {
+			zap.L().Warn("LDAP 用户过滤器匹配到多个条目", zap.String("username", username))
+		}
+		return nil, ErrUserNotFound
+	}
+
+	e := result.Entries[0]
+	entry := &ldapEntry{
+		DN:     e.DN,
+		Name:   e.GetAttributeValue(a.cfg.NameAttr),
+		Email:  e.GetAttributeValue(a.cfg.EmailAttr),
+		Phone:  e.GetAttributeValue(a.cfg.PhoneAttr),
+		Groups: e.GetAttributeValues(a.cfg.GroupAttr),
+	}
+	if entry.Name == "" {
+		entry.Name = e.GetAttributeValue("cn")
+	}
+	return entry, nil
+}
+
+// searchGroups 在 GroupBaseDN 下查询包含该用户的组
+func (a *LDAPAuthenticator) searchGroups(conn LDAPConn, userDN string) ([]string, error) {
+	req := ldap.NewSearchRequest(
+		a.cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(a.cfg.Timeout.Seconds()), false,
+		strings.ReplaceAll(a.cfg.GroupFilter, "%s", ldap.EscapeFilter(userDN)),
+		[]string{"dn"},
+		nil,
+	)
+	result, err := conn.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("ldap group search: %w", err)
+	}
+	groups := make([]string, 0, len(result.Entries))
+	for _, e := range result.Entries {
+		groups = append(groups, e.DN)
+	}
+	return groups, nil
+}
+
+// inGroups 判断 groups 中是否包含 dn（DN 不区分大小写）
+func inGroups(groups []string, dn string) bool {
+	for _, g := range groups {
+		if strings.EqualFold(g, dn) {
+			return true
+		}
+	}
+	return false
+}
+
+// provision 首次登录时创建本地用户，之后每次登录刷新属性、管理员标记和映射的用户组
+func (a *LDAPAuthenticator) provision(username string, entry *ldapEntry) (*model.User, error) {
+	var isAdmin *bool
+	if len(a.cfg.AdminGroups) > 0 {
+		admin := false
+		for _, g := range a.cfg.AdminGroups {
+			if inGroups(entry.Groups, g) {
+				admin = true
+				break
+			}
+		}
+		isAdmin = &admin
+	}
+
+	user, err := a.users.GetUserByUsername(username)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		newUser := &model.User{
+			Username:     username,
+			PasswordHash: ldapPasswordPlaceholder,
+			Name:         sql.NullString{String: entry.Name, Valid: true},
+			Email:        sql.NullString{String: entry.Email, Valid: true},
+			Phone:        sql.NullString{String: entry.Phone, Valid: true},
+			IsActive:     true,
+			IsAdmin:      isAdmin != nil && *isAdmin,
+			LdapDN:       sql.NullString{String: entry.DN, Valid: true},
+		}
+		id, err := a.users.CreateUser(newUser)
+		if err != nil {
+			return nil, fmt.Errorf("provision ldap user: %w", err)
+		}
+		zap.L().Info("LDAP 用户首次登录，已创建本地账号",
+			zap.Uint("id", id), zap.String("username", username), zap.String("dn", entry.DN))
+		user = &model.User{ID: id}
+	case err != nil:
+		return nil, err
+	case user.LdapDN.String == "":
+		// 同名的本地账号不会被 LDAP 接管
+		zap.L().Warn("LDAP 用户与本地账号同名，拒绝登录", zap.String("username", username))
+		return nil, ErrInvalidCredentials
+	case !user.IsActive:
+		return nil, ErrUserDisabled
+	default:
+		if err := a.users.UpdateLDAPUser(user.ID, entry.DN, entry.Name, entry.Email, entry.Phone, isAdmin); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := a.syncGroups(user.ID, entry.Groups); err != nil {
+		zap.L().Warn("同步 LDAP 用户组失败", zap.String("username", username), zap.Error(err))
+	}
+	return a.users.GetUserByUsername(username)
+}
+
+// syncGroups 按 GroupMapping 同步本地用户组成员关系
+func (a *LDAPAuthenticator) syncGroups(userID uint, groups []string) error {
+	var managed, member []string
+	for _, m := range a.cfg.GroupMapping {
+		if m.UserGroup == "" {
+			continue
+		}
+		managed = append(managed, m.UserGroup)
+		if inGroups(groups, m.LDAPGroup) {
+			member = append(member, m.UserGroup)
+		}
+	}
+	if err := a.users.SyncUserGroupsByName(userID, managed, member); err != nil {
+		return err
+	}
+	// 用户组变化会影响用户组角色带来的权限
+	InvalidatePermissions()
+	return nil
+}
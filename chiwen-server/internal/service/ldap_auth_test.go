@@ -0,0 +1,369 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	testBaseDN      = "ou=people,dc=example,dc=com"
+	testGroupBaseDN = "ou=groups,dc=example,dc=com"
+	testServiceDN   = "cn=chiwen,dc=example,dc=com"
+	testServicePass = "service-secret"
+	testAdminGroup  = "cn=admins,ou=groups,dc=example,dc=com"
+	testOpsGroup    = "cn=ops,ou=groups,dc=example,dc=com"
+	testDevGroup    = "cn=dev,ou=groups,dc=example,dc=com"
+)
+
+// fakeDirectory 进程内的假 LDAP 目录
+type fakeDirectory struct {
+	users  map[string]fakeLDAPUser // uid → 用户
+	groups map[string][]string     // 组 DN → 成员 DN（按组搜索时使用）
+}
+
+type fakeLDAPUser struct {
+	DN       string
+	Password string
+	Attrs    map[string][]string
+}
+
+var uidFilter = regexp.MustCompile(`\(uid=([^)]*)\)`)
+
+func (d *fakeDirectory) dial(LDAPConfig) (LDAPConn, error) {
+	return &fakeLDAPConn{dir: d}, nil
+}
+
+// fakeLDAPConn 记录当前绑定的 DN，未以服务账号绑定时拒绝查询
+type fakeLDAPConn struct {
+	dir    *fakeDirectory
+	bound  string
+	closed bool
+}
+
+func (c *fakeLDAPConn) Bind(username, password string) error {
+	if username == testServiceDN && password == testServicePass {
+		c.bound = username
+		return nil
+	}
+	for _, u := range c.dir.users {
+		if u.DN == username && u.Password == password {
+			c.bound = username
+			return nil
+		}
+	}
+	c.bound = ""
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (c *fakeLDAPConn) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if c.bound != testServiceDN {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("not bound as service account"))
+	}
+	result := &ldap.SearchResult{}
+	switch req.BaseDN {
+	case testBaseDN:
+		m := uidFilter.FindStringSubmatch(req.Filter)
+		if m == nil {
+			return nil, ldap.NewError(ldap.LDAPResultFilterError, errors.New("unexpected filter "+req.Filter))
+		}
+		if u, ok := c.dir.users[m[1]]; ok {
+			result.Entries = append(result.Entries, ldap.NewEntry(u.DN, u.Attrs))
+		}
+	case testGroupBaseDN:
+		for group, members := range c.dir.groups {
+			for _, member := range members {
+				if strings.Contains(req.Filter, "(member="+ldap.EscapeFilter(member)+")") {
+					result.Entries = append(result.Entries, ldap.NewEntry(group, nil))
+				}
+			}
+		}
+	default:
+		return nil, ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object"))
+	}
+	return result, nil
+}
+
+func (c *fakeLDAPConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+// fakeUserStore 内存中的本地用户表
+type fakeUserStore struct {
+	users   map[string]*model.User
+	groups  map[uint][]string // 用户ID → 所属的本地用户组
+	managed []string          // 最近一次同步时受管理的用户组
+	nextID  uint
+}
+
+func newFakeUserStore() *fakeUserStore {
+	return &fakeUserStore{users: make(map[string]*model.User), groups: make(map[uint][]string), nextID: 1}
+}
+
+func (s *fakeUserStore) GetUserByUsername(username string) (*model.User, error) {
+	u, ok := s.users[username]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	cp := *u
+	return &cp, nil
+}
+
+func (s *fakeUserStore) CreateUser(u *model.User) (uint, error) {
+	cp := *u
+	cp.ID = s.nextID
+	s.nextID++
+	s.users[u.Username] = &cp
+	return cp.ID, nil
+}
+
+func (s *fakeUserStore) UpdateLDAPUser(id uint, dn, name, email, phone string, isAdmin *bool) error {
+	for _, u := range s.users {
+		if u.ID != id {
+			continue
+		}
+		u.LdapDN = sql.NullString{String: dn, Valid: true}
+		u.Name = sql.NullString{String: name, Valid: true}
+		u.Email = sql.NullString{String: email, Valid: true}
+		u.Phone = sql.NullString{String: phone, Valid: true}
+		if isAdmin != nil {
+			u.IsAdmin = *isAdmin
+		}
+		return nil
+	}
+	return sql.ErrNoRows
+}
+
+func (s *fakeUserStore) SyncUserGroupsByName(userID uint, managed, member []string) error {
+	s.managed = managed
+	s.groups[userID] = member
+	return nil
+}
+
+func newTestDirectory() *fakeDirectory {
+	return &fakeDirectory{
+		users: map[string]fakeLDAPUser{
+			"alice": {
+				DN:       "uid=alice," + testBaseDN,
+				Password: "alice-pass",
+				Attrs: map[string][]string{
+					"displayName": {"Alice"},
+					"mail":        {"alice@example.com"},
+					"memberOf":    {testAdminGroup},
+				},
+			},
+			"bob": {
+				DN:       "uid=bob," + testBaseDN,
+				Password: "bob-pass",
+				Attrs: map[string][]string{
+					"cn":   {"Bob"},
+					"mail": {"bob@example.com"},
+				},
+			},
+		},
+		groups: map[string][]string{
+			testOpsGroup: {"uid=bob," + testBaseDN},
+			testDevGroup: {"uid=alice," + testBaseDN},
+		},
+	}
+}
+
+func newTestLDAPAuthenticator(dir *fakeDirectory, store *fakeUserStore, modify func(cfg *LDAPConfig)) *LDAPAuthenticator {
+	cfg := LDAPConfig{
+		URL:          "ldap://ldap.example.com",
+		BindDN:       testServiceDN,
+		BindPassword: testServicePass,
+		BaseDN:       testBaseDN,
+		UserFilter:   "(&(objectClass=person)(uid=%s))",
+		NameAttr:     "displayName",
+		EmailAttr:    "mail",
+		PhoneAttr:    "telephoneNumber",
+		GroupAttr:    "memberOf",
+	}
+	if modify != nil {
+		modify(&cfg)
+	}
+	a := NewLDAPAuthenticator(cfg, dir.dial)
+	a.users = store
+	return a
+}
+
+func TestLDAPAuthenticateProvisionsUser(t *testing.T) {
+	store := newFakeUserStore()
+	a := newTestLDAPAuthenticator(newTestDirectory(), store, nil)
+
+	user, err := a.Authenticate("bob", "bob-pass")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.Username != "bob" || user.LdapDN.String != "uid=bob,"+testBaseDN {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	// displayName 为空时回退到 cn
+	if user.Name.String != "Bob" || user.Email.String != "bob@example.com" {
+		t.Errorf("attributes not synced: name=%q email=%q", user.Name.String, user.Email.String)
+	}
+	if user.PasswordHash != ldapPasswordPlaceholder {
+		t.Errorf("LDAP user must not get a usable local password, got %q", user.PasswordHash)
+	}
+	if !user.IsActive || user.IsAdmin {
+		t.Errorf("unexpected flags active=%v admin=%v", user.IsActive, user.IsAdmin)
+	}
+
+	// 再次登录只刷新属性，不重复创建
+	if _, err := a.Authenticate("bob", "bob-pass"); err != nil {
+		t.Fatalf("second Authenticate: %v", err)
+	}
+	if len(store.users) != 1 {
+		t.Errorf("expected 1 local user, got %d", len(store.users))
+	}
+}
+
+func TestLDAPAuthenticateWrongPassword(t *testing.T) {
+	store := newFakeUserStore()
+	a := newTestLDAPAuthenticator(newTestDirectory(), store, nil)
+
+	for _, password := range []string{"wrong", ""} {
+		if _, err := a.Authenticate("alice", password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("password %q: expected ErrInvalidCredentials, got %v", password, err)
+		}
+	}
+	if len(store.users) != 0 {
+		t.Errorf("failed login must not provision a user")
+	}
+}
+
+func TestLDAPAuthenticateUserNotFound(t *testing.T) {
+	store := newFakeUserStore()
+	a := newTestLDAPAuthenticator(newTestDirectory(), store, nil)
+
+	if _, err := a.Authenticate("carol", "whatever"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+	// 过滤器特殊字符必须转义，不能借此匹配到其他用户
+	if _, err := a.Authenticate("*", "alice-pass"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound for wildcard username, got %v", err)
+	}
+}
+
+func TestLDAPAuthenticateLocalAccountCollision(t *testing.T) {
+	store := newFakeUserStore()
+	store.users["alice"] = &model.User{ID: 42, Username: "alice", PasswordHash: "$2a$10$local", IsActive: true}
+	store.nextID = 43
+	a := newTestLDAPAuthenticator(newTestDirectory(), store, nil)
+
+	if _, err := a.Authenticate("alice", "alice-pass"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+	local := store.users["alice"]
+	if local.LdapDN.String != "" || local.PasswordHash != "$2a$10$local" || local.IsAdmin {
+		t.Errorf("local account must not be taken over by LDAP: %+v", local)
+	}
+}
+
+func TestLDAPAuthenticateAdminGroup(t *testing.T) {
+	dir := newTestDirectory()
+	store := newFakeUserStore()
+	a := newTestLDAPAuthenticator(dir, store, func(cfg *LDAPConfig) {
+		cfg.AdminGroups = []string{strings.ToUpper(testAdminGroup)} // 组 DN 不区分大小写
+	})
+
+	alice, err := a.Authenticate("alice", "alice-pass")
+	if err != nil {
+		t.Fatalf("Authenticate alice: %v", err)
+	}
+	if !alice.IsAdmin {
+		t.Errorf("member of admin group should be admin")
+	}
+	bob, err := a.Authenticate("bob", "bob-pass")
+	if err != nil {
+		t.Fatalf("Authenticate bob: %v", err)
+	}
+	if bob.IsAdmin {
+		t.Errorf("non-member should not be admin")
+	}
+
+	// 从管理员组移除后，下次登录撤销管理员标记
+	u := dir.users["alice"]
+	u.Attrs["memberOf"] = nil
+	dir.users["alice"] = u
+	alice, err = a.Authenticate("alice", "alice-pass")
+	if err != nil {
+		t.Fatalf("Authenticate alice again: %v", err)
+	}
+	if alice.IsAdmin {
+		t.Errorf("admin flag should be revoked after leaving the admin group")
+	}
+}
+
+func TestLDAPAuthenticateWithoutAdminGroupsKeepsAdminFlag(t *testing.T) {
+	store := newFakeUserStore()
+	store.users["bob"] = &model.User{
+		ID: 7, Username: "bob", PasswordHash: ldapPasswordPlaceholder, IsActive: true, IsAdmin: true,
+		LdapDN: sql.NullString{String: "uid=bob," + testBaseDN, Valid: true},
+	}
+	a := newTestLDAPAuthenticator(newTestDirectory(), store, nil)
+
+	bob, err := a.Authenticate("bob", "bob-pass")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if !bob.IsAdmin {
+		t.Errorf("admin flag must be kept when admin_groups is not configured")
+	}
+}
+
+func TestLDAPAuthenticateGroupSync(t *testing.T) {
+	store := newFakeUserStore()
+	a := newTestLDAPAuthenticator(newTestDirectory(), store, func(cfg *LDAPConfig) {
+		cfg.GroupBaseDN = testGroupBaseDN
+		cfg.GroupFilter = "(|(member=%s)(uniqueMember=%s))"
+		cfg.GroupMapping = []LDAPGroupMapping{
+			{LDAPGroup: testOpsGroup, UserGroup: "运维"},
+			{LDAPGroup: testDevGroup, UserGroup: "开发"},
+			{LDAPGroup: testAdminGroup, UserGroup: "管理员"},
+		}
+	})
+
+	// 用户绑定后需要重新以服务账号绑定才能查询组（假目录拒绝非服务账号的查询）
+	bob, err := a.Authenticate("bob", "bob-pass")
+	if err != nil {
+		t.Fatalf("Authenticate bob: %v", err)
+	}
+	wantManaged := []string{"运维", "开发", "管理员"}
+	if !reflect.DeepEqual(store.managed, wantManaged) {
+		t.Errorf("managed groups = %v, want %v", store.managed, wantManaged)
+	}
+	if got := store.groups[bob.ID]; !reflect.DeepEqual(got, []string{"运维"}) {
+		t.Errorf("bob groups = %v, want [运维]", got)
+	}
+
+	// memberOf 与按组搜索的结果合并
+	alice, err := a.Authenticate("alice", "alice-pass")
+	if err != nil {
+		t.Fatalf("Authenticate alice: %v", err)
+	}
+	if got := store.groups[alice.ID]; !reflect.DeepEqual(got, []string{"开发", "管理员"}) {
+		t.Errorf("alice groups = %v, want [开发 管理员]", got)
+	}
+}
+
+func TestLDAPAuthenticateDisabledUser(t *testing.T) {
+	store := newFakeUserStore()
+	store.users["bob"] = &model.User{
+		ID: 7, Username: "bob", PasswordHash: ldapPasswordPlaceholder, IsActive: false,
+		LdapDN: sql.NullString{String: "uid=bob," + testBaseDN, Valid: true},
+	}
+	a := newTestLDAPAuthenticator(newTestDirectory(), store, nil)
+
+	if _, err := a.Authenticate("bob", "bob-pass"); !errors.Is(err, ErrUserDisabled) {
+		t.Fatalf("expected ErrUserDisabled, got %v", err)
+	}
+}
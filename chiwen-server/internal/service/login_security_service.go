@@ -0,0 +1,256 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"go.uber.org/zap"
+)
+
+// loginSecuritySetting system_settings 中登录安全设置的名称
+const loginSecuritySetting = "login_security"
+
+var (
+	ErrAccountLocked        = errors.New("account is temporarily locked due to repeated login failures")
+	ErrTooManyLoginAttempts = errors.New("too many failed login attempts from this ip, try again later")
+	ErrLoginIPNotAllowed    = errors.New("login from this ip is not allowed")
+)
+
+// ipFailures 按来源 IP 统计的登录失败次数（窗口期内），用于限制撞库和密码喷洒
+var ipFailures = struct {
+	sync.Mutex
+	m map[string]*ipFailure
+}{m: make(map[string]*ipFailure)}
+
+type ipFailure struct {
+	count int
+	since time.Time
+}
+
+// defaultLoginSecurity 未配置时的登录安全设置
+func defaultLoginSecurity() *model.LoginSecurity {
+	return &model.LoginSecurity{
+		MaxFailures:     5,
+		LockoutMinutes:  15,
+		IPMaxFailures:   20,
+		IPWindowMinutes: 15,
+	}
+}
+
+// GetLoginSecurity 读取登录安全设置
+func GetLoginSecurity() (*model.LoginSecurity, error) {
+	s := defaultLoginSecurity()
+	if _, err := mysql.GetSetting(loginSecuritySetting, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SaveLoginSecurity 校验并保存登录安全设置；白名单必须包含操作人当前的 IP，避免把所有人锁在外面
+func SaveLoginSecurity(s *model.LoginSecurity, updatedBy, operatorIP string) error {
+	if err := ValidateIPList(s.IPAllowlist); err != nil {
+		return err
+	}
+	if !ipAllowed(s.IPAllowlist, operatorIP) {
+		return fmt.Errorf("ip_allowlist must include your current ip %s", operatorIP)
+	}
+	return mysql.SaveSetting(loginSecuritySetting, s, updatedBy)
+}
+
+// ValidateIPList 校验 IP/CIDR 列表
+func ValidateIPList(list []string) error {
+	for i, v := range list {
+		v = strings.TrimSpace(v)
+		list[i] = v
+		if strings.Contains(v, "/") {
+			if _, _, err := net.ParseCIDR(v); err != nil {
+				return fmt.Errorf("invalid cidr %q", v)
+			}
+			continue
+		}
+		if net.ParseIP(v) == nil {
+			return fmt.Errorf("invalid ip %q", v)
+		}
+	}
+	return nil
+}
+
+// ipAllowed 判断 ip 是否命中 IP/CIDR 列表，列表为空时不限制
+func ipAllowed(list []string, ip string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, v := range list {
+		if strings.Contains(v, "/") {
+			if _, network, err := net.ParseCIDR(v); err == nil && network.Contains(addr) {
+				return true
+			}
+		} else if other := net.ParseIP(v); other != nil && other.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckLoginAllowed 校验密码之前的检查：全局 IP 白名单、来源 IP 限流、账号锁定
+func CheckLoginAllowed(username, ip string) error {
+	settings, err := GetLoginSecurity()
+	if err != nil {
+		return err
+	}
+	if !ipAllowed(settings.IPAllowlist, ip) {
+		return ErrLoginIPNotAllowed
+	}
+	if ipThrottled(settings, ip) {
+		return ErrTooManyLoginAttempts
+	}
+
+	state, err := mysql.GetUserLoginState(username)
+	if errors.Is(err, sql.ErrNoRows) {
+		// 本地不存在的用户可能由 LDAP 认证，交给后续流程
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if state.LockedUntil != nil && time.Now().Before(*state.LockedUntil) {
+		return ErrAccountLocked
+	}
+	return nil
+}
+
+// CheckUserLoginIP 校验用户的登录 IP 白名单（含已绑定的 IP）
+func CheckUserLoginIP(username, ip string) error {
+	state, err := mysql.GetUserLoginState(username)
+	if err != nil {
+		return err
+	}
+	if !ipAllowed(state.LoginIPs, ip) {
+		return ErrLoginIPNotAllowed
+	}
+	return nil
+}
+
+func ipThrottled(settings *model.LoginSecurity, ip string) bool {
+	if settings.IPMaxFailures <= 0 {
+		return false
+	}
+	ipFailures.Lock()
+	defer ipFailures.Unlock()
+	f, ok := ipFailures.m[ip]
+	if !ok {
+		return false
+	}
+	if time.Since(f.since) > time.Duration(settings.IPWindowMinutes)*time.Minute {
+		delete(ipFailures.m, ip)
+		return false
+	}
+	return f.count >= settings.IPMaxFailures
+}
+
+// RecordLoginFailure 记录一次认证失败：累加来源 IP 的失败次数，用户存在时累加连续失败次数，达到阈值后锁定账号
+func RecordLoginFailure(username, ip string) {
+	settings, err := GetLoginSecurity()
+	if err != nil {
+		zap.L().Error("Failed to load login security settings", zap.Error(err))
+		settings = defaultLoginSecurity()
+	}
+
+	window := time.Duration(settings.IPWindowMinutes) * time.Minute
+	ipFailures.Lock()
+	f, ok := ipFailures.m[ip]
+	if !ok || time.Since(f.since) > window {
+		f = &ipFailure{since: time.Now()}
+		ipFailures.m[ip] = f
+	}
+	f.count++
+	ipFailures.Unlock()
+
+	state, err := mysql.GetUserLoginState(username)
+	if err != nil {
+		return
+	}
+	lockUntil := time.Now().Add(time.Duration(settings.LockoutMinutes) * time.Minute)
+	locked, err := mysql.IncrLoginFailures(state.ID, settings.MaxFailures, lockUntil)
+	if err != nil {
+		zap.L().Error("Failed to record login failure", zap.String("username", username), zap.Error(err))
+		return
+	}
+	if locked {
+		zap.L().Warn("Account locked after repeated login failures",
+			zap.String("username", username),
+			zap.String("ip", ip),
+			zap.Time("locked_until", lockUntil))
+	}
+}
+
+// RecordLoginSuccess 登录成功：清除失败计数，开启绑定的用户登记本次登录 IP
+func RecordLoginSuccess(userID uint, ip string) {
+	if err := mysql.ResetLoginFailures(userID); err != nil {
+		zap.L().Error("Failed to reset login failures", zap.Uint("user_id", userID), zap.Error(err))
+	}
+	if err := mysql.BindUserLoginIP(userID, ip); err != nil {
+		zap.L().Error("Failed to bind login ip", zap.Uint("user_id", userID), zap.Error(err))
+	}
+}
+
+// PruneLoginThrottle 清理已过窗口期的来源 IP 失败记录
+func PruneLoginThrottle() {
+	settings, err := GetLoginSecurity()
+	if err != nil {
+		settings = defaultLoginSecurity()
+	}
+	window := time.Duration(settings.IPWindowMinutes) * time.Minute
+	ipFailures.Lock()
+	defer ipFailures.Unlock()
+	for ip, f := range ipFailures.m {
+		if time.Since(f.since) > window {
+			delete(ipFailures.m, ip)
+		}
+	}
+}
+
+// checkRefreshIP 刷新令牌时同样要求来源 IP 在全局和用户的白名单内
+func checkRefreshIP(user *model.UserProfile, ip string) error {
+	settings, err := GetLoginSecurity()
+	if err != nil {
+		return err
+	}
+	if !ipAllowed(settings.IPAllowlist, ip) || !ipAllowed(user.LoginIPs, ip) {
+		return ErrLoginIPNotAllowed
+	}
+	return nil
+}
+
+// RecordLoginLog 写入登录日志，失败只记录错误不影响登录
+func RecordLoginLog(l *model.LoginLog) {
+	if len(l.UserAgent) > 255 {
+		l.UserAgent = l.UserAgent[:255]
+	}
+	if len(l.Reason) > 128 {
+		l.Reason = l.Reason[:128]
+	}
+	_ = mysql.CreateLoginLog(l)
+}
+
+// ListLoginLogs 分页查询登录日志
+func ListLoginLogs(f model.LoginLogFilter) ([]model.LoginLog, int, error) {
+	if f.Page <= 0 {
+		f.Page = 1
+	}
+	if f.PageSize <= 0 || f.PageSize > 100 {
+		f.PageSize = 20
+	}
+	return mysql.ListLoginLogs(f)
+}
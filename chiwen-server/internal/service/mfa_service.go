@@ -0,0 +1,351 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/totp"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	// mfaPolicySetting system_settings 中 MFA 策略的名称
+	mfaPolicySetting = "mfa_policy"
+	// recoveryCodeCount 每次生成的恢复码数量
+	recoveryCodeCount = 10
+	// mfaSkew 允许前后各一个时间步（30 秒）的时钟偏差
+	mfaSkew = 1
+	// mfaMaxFailures 窗口期内允许的验证失败次数，超过后暂时拒绝验证
+	mfaMaxFailures   = 5
+	mfaFailureWindow = 5 * time.Minute
+)
+
+var (
+	ErrMFANotEnrolled      = errors.New("mfa is not enrolled")
+	ErrMFAAlreadyEnabled   = errors.New("mfa is already enabled")
+	ErrInvalidMFACode      = errors.New("invalid mfa code")
+	ErrMFATooManyAttempts  = errors.New("too many failed mfa attempts, try again later")
+	ErrMFARequiredByPolicy = errors.New("mfa is required by policy")
+	ErrInvalidMFAPolicy    = errors.New("sensitive_labels is required when mode is sensitive")
+)
+
+// mfaFailures 按用户统计的验证失败次数，防止暴力猜测 6 位验证码
+var mfaFailures = struct {
+	sync.Mutex
+	m map[uint]*mfaFailure
+}{m: make(map[uint]*mfaFailure)}
+
+type mfaFailure struct {
+	count int
+	since time.Time
+}
+
+func mfaThrottled(userID uint) bool {
+	mfaFailures.Lock()
+	defer mfaFailures.Unlock()
+	f := mfaFailures.m[userID]
+	if f == nil {
+		return false
+	}
+	if time.Since(f.since) > mfaFailureWindow {
+		delete(mfaFailures.m, userID)
+		return false
+	}
+	return f.count >= mfaMaxFailures
+}
+
+func recordMFAResult(userID uint, ok bool) {
+	mfaFailures.Lock()
+	defer mfaFailures.Unlock()
+	if ok {
+		delete(mfaFailures.m, userID)
+		return
+	}
+	f := mfaFailures.m[userID]
+	if f == nil || time.Since(f.since) > mfaFailureWindow {
+		f = &mfaFailure{since: time.Now()}
+		mfaFailures.m[userID] = f
+	}
+	f.count++
+}
+
+func mfaIssuer() string {
+	if issuer := viper.GetString("auth.mfa.issuer"); issuer != "" {
+		return issuer
+	}
+	return "chiwen"
+}
+
+// MFAStatus 用户的 MFA 状态
+type MFAStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at"`
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+	Required               bool       `json:"required"` // 策略是否要求该用户开启
+}
+
+// GetMFAStatus 查询用户的 MFA 状态
+func GetMFAStatus(user *model.User) (*MFAStatus, error) {
+	status := &MFAStatus{}
+	m, err := mysql.GetUserMFA(user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if m != nil && m.Enabled {
+		status.Enabled = true
+		status.EnabledAt = m.EnabledAt
+		status.RecoveryCodesRemaining = len(m.RecoveryCodes)
+	}
+	if status.Required, err = MFARequired(user); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// MFAEnrollment 待验证的 TOTP 绑定信息
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // 前端渲染为二维码
+}
+
+// StartMFAEnrollment 生成新的 TOTP 密钥，提交首个验证码后才会启用
+func StartMFAEnrollment(userID uint, username string) (*MFAEnrollment, error) {
+	if m, err := mysql.GetUserMFA(userID); err == nil && m.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := mysql.SaveMFAEnrollment(userID, secret); err != nil {
+		return nil, err
+	}
+	return &MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(mfaIssuer(), username, secret),
+	}, nil
+}
+
+// ActivateMFA 校验首个验证码并启用 MFA，返回一次性展示的恢复码
+func ActivateMFA(userID uint, code string) ([]string, error) {
+	m, err := mysql.GetUserMFA(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if mfaThrottled(userID) {
+		return nil, ErrMFATooManyAttempts
+	}
+
+	step, ok := totp.Validate(m.Secret, code, time.Now(), mfaSkew)
+	recordMFAResult(userID, ok)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := mysql.EnableMFA(userID, step, hashes); err != nil {
+		return nil, err
+	}
+	zap.L().Info("MFA enabled", zap.Uint("user_id", userID))
+	return codes, nil
+}
+
+// VerifyMFA 校验 TOTP 验证码或恢复码（恢复码使用后作废）
+func VerifyMFA(userID uint, code string) error {
+	m, err := mysql.GetUserMFA(userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !m.Enabled) {
+		return ErrMFANotEnrolled
+	}
+	if err != nil {
+		return err
+	}
+	if mfaThrottled(userID) {
+		return ErrMFATooManyAttempts
+	}
+
+	ok, err := verifyMFACode(m, code)
+	if err != nil {
+		return err
+	}
+	recordMFAResult(userID, ok)
+	if !ok {
+		zap.L().Warn("MFA verification failed", zap.Uint("user_id", userID))
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func verifyMFACode(m *model.UserMFA, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(m.Secret, code, time.Now(), mfaSkew)
+		if !ok {
+			return false, nil
+		}
+		// 同一时间步的验证码只能用一次
+		return mysql.UseMFAStep(m.UserID, step)
+	}
+
+	used, err := mysql.UseRecoveryCode(m.UserID, hashRecoveryCode(code))
+	if used {
+		zap.L().Warn("MFA recovery code used", zap.Uint("user_id", m.UserID), zap.Int("remaining", len(m.RecoveryCodes)-1))
+	}
+	return used, err
+}
+
+// RegenerateRecoveryCodes 校验验证码后重新生成恢复码，旧恢复码全部作废
+func RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	if err := VerifyMFA(userID, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := mysql.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableMFA 用户自行关闭 MFA，需要验证码；策略要求开启时不允许关闭
+func DisableMFA(user *model.User, code string) error {
+	required, err := MFARequired(user)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFARequiredByPolicy
+	}
+	if err := VerifyMFA(user.ID, code); err != nil {
+		return err
+	}
+	zap.L().Info("MFA disabled by user", zap.Uint("user_id", user.ID))
+	return mysql.DeleteUserMFA(user.ID)
+}
+
+// ResetUserMFA 管理员重置用户的 MFA（用户丢失验证器和恢复码时使用），下次登录按策略重新绑定
+func ResetUserMFA(userID uint) error {
+	if _, err := mysql.GetUserProfile(userID); err != nil {
+		return err
+	}
+	return mysql.DeleteUserMFA(userID)
+}
+
+// recoveryEncoding 恢复码使用不含易混淆字符的 base32 小写
+var recoveryEncoding = base32.NewEncoding("abcdefghijkmnpqrstuvwxyz23456789").WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes 生成恢复码（xxxxx-xxxxx），返回明文和哈希
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		s := recoveryEncoding.EncodeToString(b)[:10]
+		code := s[:5] + "-" + s[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode 恢复码哈希，忽略大小写和分隔符
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetMFAPolicy 读取 MFA 策略，未配置时为 off
+func GetMFAPolicy() (*model.MFAPolicy, error) {
+	policy := &model.MFAPolicy{Mode: model.MFAPolicyOff}
+	if _, err := mysql.GetSetting(mfaPolicySetting, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// SaveMFAPolicy 保存 MFA 策略
+func SaveMFAPolicy(policy *model.MFAPolicy, updatedBy string) error {
+	if policy.Mode == model.MFAPolicySensitive && len(policy.SensitiveLabels) == 0 {
+		return ErrInvalidMFAPolicy
+	}
+	return mysql.SaveSetting(mfaPolicySetting, policy, updatedBy)
+}
+
+// MFARequired 判断策略是否要求该用户开启 MFA
+func MFARequired(user *model.User) (bool, error) {
+	policy, err := GetMFAPolicy()
+	if err != nil {
+		return false, err
+	}
+	switch policy.Mode {
+	case model.MFAPolicyAll:
+		return true, nil
+	case model.MFAPolicySensitive:
+		if user.IsAdmin {
+			return true, nil
+		}
+		assets, err := mysql.GetAssetsList()
+		if err != nil {
+			return false, err
+		}
+		sensitive := make([]model.Asset, 0, len(assets))
+		for _, a := range assets {
+			labels, err := a.GetLabelsJSON()
+			if err == nil && policy.SensitiveLabels.MatchLabels(labels) {
+				sensitive = append(sensitive, a)
+			}
+		}
+		return HasAccessToAssets(NewAccessGrant(user.ID, false), sensitive)
+	default:
+		return false, nil
+	}
+}
+
+// LoginMFAStep 密码校验通过后还需要的 MFA 步骤：空串表示无需 MFA
+func LoginMFAStep(user *model.User) (string, error) {
+	m, err := mysql.GetUserMFA(user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	if m != nil && m.Enabled {
+		return MFAStepVerify, nil
+	}
+	required, err := MFARequired(user)
+	if err != nil {
+		return "", err
+	}
+	if required {
+		return MFAStepEnroll, nil
+	}
+	return "", nil
+}
+
+// 登录 MFA 步骤
+const (
+	MFAStepVerify = "verify" // 提交验证码
+	MFAStepEnroll = "enroll" // 策略要求但尚未绑定，先绑定
+)
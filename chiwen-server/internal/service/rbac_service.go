@@ -0,0 +1,150 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+)
+
+var (
+	// ErrBuiltinRole 内置角色不能删除或改名
+	ErrBuiltinRole = errors.New("builtin role cannot be deleted or renamed")
+	// ErrInvalidRole 角色名为空或包含未定义的权限点
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+// permissionCache 用户生效权限缓存，路由鉴权每个请求都要检查；角色、分配或用户组成员变化时整体失效
+var permissionCache = struct {
+	sync.RWMutex
+	users map[uint]map[string]bool
+}{users: make(map[uint]map[string]bool)}
+
+// InvalidatePermissions 清空权限缓存
+func InvalidatePermissions() {
+	permissionCache.Lock()
+	permissionCache.users = make(map[uint]map[string]bool)
+	permissionCache.Unlock()
+}
+
+// UserPermissions 查询用户生效的权限集合（默认角色 + 用户角色 + 用户组角色）
+func UserPermissions(userID uint) (map[string]bool, error) {
+	permissionCache.RLock()
+	perms, ok := permissionCache.users[userID]
+	permissionCache.RUnlock()
+	if ok {
+		return perms, nil
+	}
+
+	lists, err := mysql.ListUserPermissions(userID)
+	if err != nil {
+		return nil, err
+	}
+	perms = make(map[string]bool)
+	for _, l := range lists {
+		for _, p := range l {
+			perms[p] = true
+		}
+	}
+	permissionCache.Lock()
+	permissionCache.users[userID] = perms
+	permissionCache.Unlock()
+	return perms, nil
+}
+
+// HasPermission 判断用户是否拥有权限点，管理员拥有全部权限
+func HasPermission(userID uint, isAdmin bool, perm string) (bool, error) {
+	if isAdmin {
+		return true, nil
+	}
+	perms, err := UserPermissions(userID)
+	if err != nil {
+		return false, err
+	}
+	return perms[perm], nil
+}
+
+// validateRole 校验角色名和权限点
+func validateRole(r *model.Role) error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidRole)
+	}
+	seen := make(map[string]bool)
+	perms := model.StringList{}
+	for _, p := range r.Permissions {
+		if !model.IsValidPermission(p) {
+			return fmt.Errorf("%w: unknown permission %q", ErrInvalidRole, p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			perms = append(perms, p)
+		}
+	}
+	r.Permissions = perms
+	return nil
+}
+
+// CreateRole 新增角色
+func CreateRole(r *model.Role) error {
+	if err := validateRole(r); err != nil {
+		return err
+	}
+	return mysql.CreateRole(r)
+}
+
+// UpdateRole 修改角色；内置角色只能修改说明和权限
+func UpdateRole(r *model.Role) error {
+	if err := validateRole(r); err != nil {
+		return err
+	}
+	old, err := mysql.GetRole(r.ID)
+	if err != nil {
+		return err
+	}
+	if old.Builtin && old.Name != r.Name {
+		return ErrBuiltinRole
+	}
+	if err := mysql.UpdateRole(r); err != nil {
+		return err
+	}
+	InvalidatePermissions()
+	return nil
+}
+
+// DeleteRole 删除角色，内置角色不能删除
+func DeleteRole(id uint) error {
+	r, err := mysql.GetRole(id)
+	if err != nil {
+		return err
+	}
+	if r.Builtin {
+		return ErrBuiltinRole
+	}
+	if err := mysql.DeleteRole(id); err != nil {
+		return err
+	}
+	InvalidatePermissions()
+	return nil
+}
+
+// SetUserRoles 设置用户的角色
+func SetUserRoles(userID uint, roleIDs []uint) error {
+	if err := mysql.SetUserRoles(userID, roleIDs); err != nil {
+		return err
+	}
+	InvalidatePermissions()
+	return nil
+}
+
+// SetUserGroupRoles 设置用户组的角色，组内成员同时获得这些角色的权限
+func SetUserGroupRoles(groupID uint, roleIDs []uint) error {
+	if err := mysql.SetUserGroupRoles(groupID, roleIDs); err != nil {
+		return err
+	}
+	InvalidatePermissions()
+	return nil
+}
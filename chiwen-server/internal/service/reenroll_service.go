@@ -0,0 +1,79 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chiwen/server/internal/api/agent"
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrAssetNotEnrolled 资产不存在或已删除，只能走正常注册审批
+	ErrAssetNotEnrolled = errors.New("asset not enrolled")
+	// ErrReenrollSignature 旧密钥或新密钥的签名校验失败
+	ErrReenrollSignature = errors.New("re-enrollment signature verify failed")
+	// ErrReenrollStale 时间戳不晚于上次重新注册（重放），或公钥已被并发更换
+	ErrReenrollStale = errors.New("stale or replayed re-enrollment request")
+)
+
+// reenrollCanonical 重新注册签名内容：reenroll|id|nonce|timestamp|new_public_key，旧私钥和新私钥各签一次
+func reenrollCanonical(id, nonce string, timestamp int64, newPubKey string) string {
+	return fmt.Sprintf("reenroll|%s|%s|%d|%s", id, nonce, timestamp, newPubKey)
+}
+
+// Reenroll Agent 用已登记的私钥证明身份，为同一资产ID换上新公钥并签发新密钥（无需审批）；
+// 新旧公钥可以相同（仅丢失了密钥文件）。返回用新公钥加密的密钥
+func Reenroll(id, nonce string, timestamp int64, newPubKey, oldSignature, newSignature string) (string, error) {
+	if !verifyTimestamp(timestamp, 120) {
+		return "", fmt.Errorf("%w: timestamp out of allowed range", ErrReenrollStale)
+	}
+	newPubKey = strings.TrimSpace(newPubKey)
+
+	oldPubKey, state, err := mysql.GetEnrolledPublicKey(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrAssetNotEnrolled
+		}
+		return "", err
+	}
+	if state == model.AgentStateRevoked {
+		return "", ErrAgentRevoked
+	}
+
+	payload := reenrollCanonical(id, nonce, timestamp, newPubKey)
+	if err := verifyRSASignature(oldPubKey, oldSignature, payload); err != nil {
+		return "", fmt.Errorf("%w: old key: %v", ErrReenrollSignature, err)
+	}
+	if err := verifyRSASignature(newPubKey, newSignature, payload); err != nil {
+		return "", fmt.Errorf("%w: new key: %v", ErrReenrollSignature, err)
+	}
+
+	secret, err := newAgentSecret()
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := encryptForClient(newPubKey, secret)
+	if err != nil {
+		return "", err
+	}
+	ok, err := mysql.ReenrollAsset(id, oldPubKey, newPubKey, secret, timestamp)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrReenrollStale
+	}
+
+	// 旧密钥已失效，用旧密钥建立的长连接一并断开，Agent 会用新密钥重连
+	online := agent.Disconnect(id)
+	zap.L().Info("Agent re-enrolled",
+		zap.String("asset_id", id),
+		zap.Bool("key_changed", newPubKey != oldPubKey),
+		zap.Bool("was_online", online))
+	return encrypted, nil
+}
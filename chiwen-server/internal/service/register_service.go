@@ -2,7 +2,6 @@ package service
 
 import (
 	"crypto"
-	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
@@ -120,33 +119,19 @@ func ApproveApply(clientID string, agentIP string) (encryptedSecret string, err
 	}
 
 	// 生成 secret
-	b := make([]byte, 32)
-	if _, err = rand.Read(b); err != nil {
+	secretStr, err := newAgentSecret()
+	if err != nil {
 		return "", err
 	}
-	secretStr := base64.StdEncoding.EncodeToString(b)
 
 	// 加密
-	block, _ := pem.Decode([]byte(apply.ClientPubKey))
-	if block == nil {
-		return "", errors.New("invalid client public key PEM")
-	}
-	pubI, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return "", err
-	}
-	pub, ok := pubI.(*rsa.PublicKey)
-	if !ok {
-		return "", errors.New("not RSA public key")
-	}
-	encryptedBytes, err := rsa.EncryptPKCS1v15(rand.Reader, pub, []byte(secretStr))
+	encryptedSecret, err = encryptForClient(apply.ClientPubKey, secretStr)
 	if err != nil {
 		return "", err
 	}
-	encryptedSecret = base64.StdEncoding.EncodeToString(encryptedBytes)
 
-	// 关键：写入 allowed_users = [5] (允许管理员用户访问)
-	allowedUsersJSON := `[5]`
+	// 访问权限由资产授权规则（asset_auth_rules）控制，allowed_users 不再使用
+	allowedUsersJSON := `[]`
 
 	// === 新增：构建初始 static_info，包含 Agent 连接 IP ===
 	var staticInfoJSON string
@@ -189,7 +174,7 @@ func ApproveApply(clientID string, agentIP string) (encryptedSecret string, err
 		return "", err
 	}
 
-	zap.L().Info("审批成功，已写入默认权限 allowed_users=[5] 并初始化 IP 到 static_info", zap.String("asset_id", apply.ID), zap.String("initial_ip", agentIP))
+	zap.L().Info("审批成功，已初始化 IP 到 static_info", zap.String("asset_id", apply.ID), zap.String("initial_ip", agentIP))
 	return encryptedSecret, nil
 }
 
@@ -42,23 +42,31 @@ func encryptSecretForClient(id, clientPubKey string) (string, string, error) {
 		return "", "", err
 	}
 
+	encrypted, err := encryptForClient(clientPubKey, secret)
+	if err != nil {
+		return "", "", err
+	}
+	return "approved", encrypted, nil
+}
+
+// encryptForClient 用客户端 RSA 公钥（PKIX PEM）加密，返回 base64 密文（注册审批、密钥轮换下发 secret）
+func encryptForClient(clientPubKey, plaintext string) (string, error) {
 	block, _ := pem.Decode([]byte(clientPubKey))
 	if block == nil {
-		return "", "", errors.New("invalid client public key PEM")
+		return "", errors.New("invalid client public key PEM")
 	}
 	pubI, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
 	pub, ok := pubI.(*rsa.PublicKey)
 	if !ok {
-		return "", "", errors.New("not RSA public key")
+		return "", errors.New("not RSA public key")
 	}
 
-	encryptedBytes, err := rsa.EncryptPKCS1v15(rand.Reader, pub, []byte(secret))
+	encryptedBytes, err := rsa.EncryptPKCS1v15(rand.Reader, pub, []byte(plaintext))
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
-
-	return "approved", base64.StdEncoding.EncodeToString(encryptedBytes), nil
+	return base64.StdEncoding.EncodeToString(encryptedBytes), nil
 }
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/utils"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// defaultRefreshTokenTTL 刷新令牌默认有效期，每次刷新重新计算
+const defaultRefreshTokenTTL = 7 * 24 * time.Hour
+
+// ErrInvalidRefreshToken 刷新令牌不存在、已过期、已吊销或被重放
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// TokenPair 登录/刷新后签发的令牌
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // 访问令牌有效期（秒）
+}
+
+// revocations 内存中的吊销状态，AuthRequired 每个请求都要检查，不查库
+var revocations = struct {
+	sync.RWMutex
+	tokens map[string]time.Time // jti -> 令牌原本的过期时间
+	users  map[uint]time.Time   // user_id -> 此时间及之前签发的令牌全部失效
+}{tokens: make(map[string]time.Time), users: make(map[uint]time.Time)}
+
+func refreshTokenTTL() time.Duration {
+	if ttl := viper.GetDuration("auth.jwt.refresh_ttl"); ttl > 0 {
+		return ttl
+	}
+	return defaultRefreshTokenTTL
+}
+
+// hashToken 刷新令牌、API 令牌入库前取 SHA-256，数据库泄露也无法还原令牌
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IssueTokens 登录成功后签发访问令牌和新令牌链上的第一个刷新令牌
+func IssueTokens(user *model.User, clientIP, userAgent string) (*TokenPair, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return issueTokens(user.ID, user.Username, user.IsAdmin, hex.EncodeToString(b), clientIP, userAgent)
+}
+
+func issueTokens(userID uint, username string, isAdmin bool, familyID, clientIP, userAgent string) (*TokenPair, error) {
+	access, jti, err := utils.GenerateToken(userID, username, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	err = mysql.CreateRefreshToken(&model.RefreshToken{
+		TokenHash: hashToken(refresh),
+		FamilyID:  familyID,
+		UserID:    userID,
+		AccessJTI: jti,
+		ClientIP:  clientIP,
+		UserAgent: userAgent,
+		ExpiresAt: time.Now().Add(refreshTokenTTL()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// RefreshTokens 用刷新令牌换取新的令牌对，旧刷新令牌随即失效；
+// 已轮换过的刷新令牌再次出现说明可能被盗用，整条令牌链作废
+func RefreshTokens(raw, clientIP, userAgent string) (*TokenPair, error) {
+	rt, err := mysql.GetRefreshToken(hashToken(raw))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rt.RevokedAt != nil || time.Now().After(rt.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	used := rt.UsedAt != nil
+	if !used {
+		ok, err := mysql.MarkRefreshTokenUsed(rt.ID)
+		if err != nil {
+			return nil, err
+		}
+		used = !ok
+	}
+	if used {
+		zap.L().Warn("Refresh token reuse detected, revoking token family",
+			zap.Uint("user_id", rt.UserID),
+			zap.String("family_id", rt.FamilyID),
+			zap.String("ip", clientIP))
+		if err := revokeFamily(rt.FamilyID, "reuse detected"); err != nil {
+			zap.L().Error("Failed to revoke token family", zap.String("family_id", rt.FamilyID), zap.Error(err))
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// 重新读取用户，管理员标记的变更在下一次刷新时生效
+	user, err := mysql.GetUserProfile(rt.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		_ = revokeFamily(rt.FamilyID, "user disabled")
+		return nil, ErrUserDisabled
+	}
+	if err := checkRefreshIP(user, clientIP); err != nil {
+		return nil, err
+	}
+	return issueTokens(user.ID, user.Username, user.IsAdmin, rt.FamilyID, clientIP, userAgent)
+}
+
+// revokeFamily 作废令牌链上的刷新令牌，以及仍可能有效的访问令牌
+func revokeFamily(familyID, reason string) error {
+	tokens, err := mysql.ListRefreshFamily(familyID)
+	if err != nil {
+		return err
+	}
+	if err := mysql.RevokeRefreshFamily(familyID, reason); err != nil {
+		return err
+	}
+	ttl := utils.AccessTokenTTL()
+	for _, t := range tokens {
+		if expiresAt := t.CreatedAt.Add(ttl); t.AccessJTI != "" && expiresAt.After(time.Now()) {
+			if err := revokeAccessToken(t.AccessJTI, t.UserID, expiresAt, reason); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func revokeAccessToken(jti string, userID uint, expiresAt time.Time, reason string) error {
+	if err := mysql.RevokeAccessToken(jti, userID, expiresAt, reason); err != nil {
+		return err
+	}
+	revocations.Lock()
+	revocations.tokens[jti] = expiresAt
+	revocations.Unlock()
+	return nil
+}
+
+// Logout 退出当前登录：吊销当前访问令牌及其所在的刷新令牌链
+func Logout(claims *utils.Claims) error {
+	if claims.ID == "" {
+		return nil
+	}
+	expiresAt := time.Now().Add(utils.AccessTokenTTL())
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	if err := revokeAccessToken(claims.ID, claims.UserID, expiresAt, "logout"); err != nil {
+		return err
+	}
+	familyID, err := mysql.GetRefreshFamilyByAccessJTI(claims.ID)
+	if err != nil || familyID == "" {
+		return err
+	}
+	return revokeFamily(familyID, "logout")
+}
+
+// RevokeUserTokens 吊销用户已签发的全部令牌（退出所有会话、禁用用户、重置密码）
+func RevokeUserTokens(userID uint, reason string) error {
+	now := time.Now().Truncate(time.Millisecond)
+	if err := mysql.SetUserTokensRevokedAt(userID, now); err != nil {
+		return err
+	}
+	if err := mysql.RevokeUserRefreshTokens(userID, reason); err != nil {
+		return err
+	}
+	revocations.Lock()
+	revocations.users[userID] = now
+	revocations.Unlock()
+
+	zap.L().Info("User tokens revoked", zap.Uint("user_id", userID), zap.String("reason", reason))
+	return nil
+}
+
+// IsTokenRevoked 访问令牌是否已被吊销
+func IsTokenRevoked(claims *utils.Claims) bool {
+	revocations.RLock()
+	defer revocations.RUnlock()
+	if _, ok := revocations.tokens[claims.ID]; ok && claims.ID != "" {
+		return true
+	}
+	if cutoff, ok := revocations.users[claims.UserID]; ok {
+		return claims.IssuedAt == nil || !claims.IssuedAt.Time.After(cutoff)
+	}
+	return false
+}
+
+// LoadTokenRevocations 启动时从数据库加载仍有意义的吊销记录
+func LoadTokenRevocations() error {
+	tokens, err := mysql.ListRevokedAccessTokens()
+	if err != nil {
+		return err
+	}
+	// 早于一个访问令牌有效期的用户吊销时间已无意义：那之前签发的令牌都已过期
+	users, err := mysql.ListUserTokenRevocations(time.Now().Add(-utils.AccessTokenTTL()))
+	if err != nil {
+		return err
+	}
+
+	revocations.Lock()
+	defer revocations.Unlock()
+	for _, t := range tokens {
+		revocations.tokens[t.JTI] = t.ExpiresAt
+	}
+	for _, u := range users {
+		revocations.users[u.UserID] = u.RevokedAt
+	}
+	zap.L().Info("Token revocations loaded", zap.Int("tokens", len(tokens)), zap.Int("users", len(users)))
+	return nil
+}
+
+// PruneTokenRevocations 清理内存和数据库中已过期的吊销记录
+func PruneTokenRevocations() {
+	now := time.Now()
+	ttl := utils.AccessTokenTTL()
+	revocations.Lock()
+	for jti, expiresAt := range revocations.tokens {
+		if now.After(expiresAt) {
+			delete(revocations.tokens, jti)
+		}
+	}
+	for uid, cutoff := range revocations.users {
+		if now.After(cutoff.Add(ttl)) {
+			delete(revocations.users, uid)
+		}
+	}
+	revocations.Unlock()
+
+	n, err := mysql.CleanupExpiredTokens()
+	if err != nil {
+		zap.L().Error("Failed to cleanup expired tokens", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		zap.L().Info("Cleaned up expired tokens", zap.Int64("count", n))
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/asciicast"
+	"github.com/chiwen/server/internal/pkg/cmdline"
+	"go.uber.org/zap"
+)
+
+// exitMarkerRe Agent 通过 PROMPT_COMMAND 在每次显示提示符前输出 OSC 133;D;{退出码}（FinalTerm 语义提示符），
+// 终端会忽略该序列，这里用它识别上一条命令的退出码
+var exitMarkerRe = regexp.MustCompile(`\x1b\]133;D;(\d+)(?:\x07|\x1b\\)`)
+
+// altScreenRe 全屏程序（vim/top/less 等）切换备用屏幕，期间的按键不是 shell 命令
+var altScreenRe = regexp.MustCompile(`\x1b\[\?(?:1049|1047|47)([hl])`)
+
+// extractedCommand 从录像中还原出的一条命令
+type extractedCommand struct {
+	Offset   float64 // 相对录像开始的秒数
+	Line     cmdline.Line
+	ExitCode *int
+}
+
+// extractCommands 回放录像的输入流还原命令行，并从输出流中匹配退出码
+func extractCommands(rec *asciicast.Recording) []extractedCommand {
+	var (
+		editor    cmdline.Editor
+		commands  []extractedCommand
+		awaiting  = -1 // 等待退出码的命令下标
+		altScreen bool
+		carry     string // 上一段输出的尾部，防止转义序列被拆到两个事件里
+	)
+
+	for _, ev := range rec.Events {
+		switch ev.Type {
+		case asciicast.EventInput:
+			if altScreen {
+				continue
+			}
+			editor.Feed([]byte(ev.Data), func(line cmdline.Line, _ int) bool {
+				if line.Text != "" {
+					commands = append(commands, extractedCommand{Offset: ev.Time, Line: line})
+					awaiting = len(commands) - 1
+				}
+				return true
+			})
+
+		case asciicast.EventOutput:
+			out := carry + ev.Data
+
+			for _, m := range altScreenRe.FindAllStringSubmatch(out, -1) {
+				altScreen = m[1] == "h"
+			}
+			if altScreen {
+				editor.Reset()
+			}
+
+			for _, m := range exitMarkerRe.FindAllStringSubmatch(out, -1) {
+				if awaiting < 0 {
+					continue
+				}
+				if code, err := strconv.Atoi(m[1]); err == nil {
+					commands[awaiting].ExitCode = &code
+				}
+				awaiting = -1
+			}
+
+			// 已匹配过的内容不再保留，只留下可能被截断的转义序列
+			if i := strings.LastIndexByte(out, 0x1b); i >= 0 && len(out)-i < 32 && !exitMarkerRe.MatchString(out[i:]) {
+				carry = out[i:]
+			} else {
+				carry = ""
+			}
+		}
+	}
+	return commands
+}
+
+// IndexSessionCommands 解析会话录像并重建 tty_commands 索引，可重复执行
+func IndexSessionCommands(sessionID string) error {
+	session, err := mysql.GetTTYSessionByID(sessionID)
+	if err != nil {
+		return fmt.Errorf("session not found: %w", err)
+	}
+	if session.RecordFile == "" {
+		return errors.New("session has no recording")
+	}
+
+	rec, err := asciicast.Open(session.RecordFile)
+	if err != nil {
+		return fmt.Errorf("open recording: %w", err)
+	}
+
+	start := time.Unix(rec.Header.Timestamp, 0)
+	if rec.Header.Timestamp == 0 {
+		start = session.CreatedAt
+	}
+
+	extracted := extractCommands(rec)
+	commands := make([]model.TTYCommand, 0, len(extracted))
+	for _, e := range extracted {
+		commands = append(commands, model.TTYCommand{
+			SessionID:  session.ID,
+			AssetID:    session.AssetID,
+			UserID:     session.UserID,
+			ExecutedAt: start.Add(time.Duration(e.Offset * float64(time.Second))),
+			Command:    e.Line.Text,
+			Partial:    e.Line.Partial,
+			ExitCode:   e.ExitCode,
+		})
+	}
+
+	if err := mysql.ReplaceSessionCommands(session.ID, commands); err != nil {
+		return err
+	}
+
+	zap.L().Info("TTY session commands indexed",
+		zap.String("session_id", session.ID),
+		zap.Int("count", len(commands)))
+	return nil
+}
+
+// SearchCommands 搜索历史命令
+func (s *TTYService) SearchCommands(filter model.TTYCommandFilter) ([]model.TTYCommand, int, error) {
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 || filter.PageSize > 200 {
+		filter.PageSize = 50
+	}
+	if filter.Regex != "" {
+		// MySQL 使用 ICU 正则，语法与 Go 基本兼容，这里提前拦截明显错误的表达式
+		if _, err := regexp.Compile(filter.Regex); err != nil {
+			return nil, 0, fmt.Errorf("invalid regex: %w", err)
+		}
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, 0, errors.New("invalid time range: from must be before to")
+	}
+	return mysql.SearchTTYCommands(filter)
+}
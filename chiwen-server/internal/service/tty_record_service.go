@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/pkg/asciicast"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// recordDir 录像根目录，默认 ./data/recordings
+func recordDir() string {
+	if dir := viper.GetString("tty.record_dir"); dir != "" {
+		return dir
+	}
+	return "./data/recordings"
+}
+
+// StartSessionRecording 为会话创建 asciicast 录像文件，并把路径写入 tty_sessions.record_file
+// 文件按日期分目录：{record_dir}/2006-01-02/{session_id}.cast
+func StartSessionRecording(session *model.TTYSession) (*asciicast.Writer, error) {
+	path := filepath.Join(recordDir(), session.CreatedAt.Format("2006-01-02"), session.ID+".cast")
+
+	w, err := asciicast.Create(path, asciicast.Header{
+		Width:     session.TerminalCols,
+		Height:    session.TerminalRows,
+		Timestamp: session.CreatedAt.Unix(),
+		Title:     fmt.Sprintf("asset=%s user=%s", session.AssetID, session.UserID),
+		Env: map[string]string{
+			"SHELL": session.Command,
+			"TERM":  "xterm-256color",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mysql.UpdateTTYSessionRecordFile(session.ID, path); err != nil {
+		w.Close()
+		return nil, err
+	}
+	session.RecordFile = path
+
+	zap.L().Info("TTY session recording started",
+		zap.String("session_id", session.ID),
+		zap.String("record_file", path))
+	return w, nil
+}
+
+// ListRecordings 分页查询会话录像
+func (s *TTYService) ListRecordings(filter model.TTYRecordingFilter) ([]model.TTYRecording, int, error) {
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 || filter.PageSize > 100 {
+		filter.PageSize = 20
+	}
+
+	recordings, total, err := mysql.ListTTYRecordings(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range recordings {
+		if fi, err := os.Stat(recordings[i].RecordFile); err == nil {
+			recordings[i].Size = fi.Size()
+		}
+	}
+	return recordings, total, nil
+}
+
+// GetRecordingSession 获取会话及其录像文件，userID 非空时要求会话属于该用户
+func (s *TTYService) GetRecordingSession(sessionID, userID string) (*model.TTYSession, error) {
+	session, err := mysql.GetTTYSessionByID(sessionID)
+	if err != nil {
+		return nil, errors.New("session not found")
+	}
+	if userID != "" && session.UserID != userID {
+		return nil, errors.New("recording not allowed for current user")
+	}
+	if session.RecordFile == "" {
+		return nil, errors.New("recording not found")
+	}
+	if _, err := os.Stat(session.RecordFile); err != nil {
+		zap.L().Warn("Recording file missing",
+			zap.String("session_id", sessionID),
+			zap.String("record_file", session.RecordFile),
+			zap.Error(err))
+		return nil, errors.New("recording file not found")
+	}
+	return session, nil
+}
@@ -148,11 +148,14 @@ func getServerHost() string {
 }
 
 // AuthorizeTTY 授权TTY访问
-func (s *TTYService) AuthorizeTTY(assetID, userID, browserIP string, cols, rows int) (*model.TTYTokenInfo, error) {
+//
+// grant 为当前登录用户（来自 JWT），account 为用户选择的主机账号，为空时按 ResolveHostAccount 的规则选择
+func (s *TTYService) AuthorizeTTY(assetID string, grant *AccessGrant, account, browserIP string, cols, rows int) (*model.TTYTokenInfo, error) {
 	// 1. 参数校验
-	if assetID == "" || userID == "" {
-		return nil, errors.New("asset_id and user_id are required")
+	if assetID == "" || grant == nil || grant.UserID == 0 {
+		return nil, errors.New("asset_id and user are required")
 	}
+	userID := grant.UserIDString()
 	if cols <= 0 {
 		cols = 120
 	}
@@ -161,82 +164,75 @@ func (s *TTYService) AuthorizeTTY(assetID, userID, browserIP string, cols, rows
 	}
 
 	// 2. 权限 + 状态检查
-	// allowed, err := checkUserPermission(assetID, userID)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	// if !allowed {
-	// 	return nil, errors.New("user is not allowed to access this machine")
-	// }
-	// 当前所有审批通过的机器都可以直接连（用于快速测试）
+	if err := checkUserPermission(assetID, grant); err != nil {
+		return nil, err
+	}
 
 	// 3. 并发会话限制
 	if err := checkRateLimit(userID, assetID); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
-	// 4. 生成一次性 token
+	// 4. 选择主机账号
+	osAccount, err := ResolveHostAccount(assetID, grant, account)
+	if err != nil {
+		return nil, err
+	}
+
+	// 5. 生成一次性 token
 	token, err := generateToken()
 	if err != nil {
 		return nil, err
 	}
 
-	// 5. 写入 tty_tokens 表（5分钟有效）
-	if err := mysql.CreateTTYToken(token, userID, assetID, cols, rows, time.Now().Add(5*time.Minute)); err != nil {
+	// 6. 写入 tty_tokens 表（5分钟有效）
+	if err := mysql.CreateTTYToken(token, userID, assetID, osAccount, cols, rows, time.Now().Add(5*time.Minute)); err != nil {
 		return nil, err
 	}
 
-	// 6. 构造 WebSocket URL（强烈建议用 external_url）
+	// 7. 构造 WebSocket URL（强烈建议用 external_url）
 	wsHost := getServerHost() // 你后面我会给你这个函数
 	wsURL := fmt.Sprintf("wss://%s/api/v1/tty/ws?token=%s", wsHost, token)
 
 	zap.L().Info("TTY authorized success",
 		zap.String("asset_id", assetID),
 		zap.String("user_id", userID),
+		zap.String("os_account", osAccount),
+		zap.Int64s("rule_ids", grant.RuleIDs),
 		zap.String("token_prefix", token[:12]+"..."))
 
 	return &model.TTYTokenInfo{
-		Token:   token,
-		WsURL:   wsURL,
-		Expires: 300,
+		Token:     token,
+		WsURL:     wsURL,
+		Expires:   300,
+		OSAccount: osAccount,
 	}, nil
 }
 
-// service/tty_service.go 中修改 checkUserPermission 函数
-func checkUserPermission(assetID, userID string) (bool, error) {
-	// 获取资产
+// CheckSessionAccess 校验用户当前能否以 osAccount 身份在资产上输入：资产与 Agent 状态、资产授权规则、主机账号绑定。
+// 协同/接管他人会话和断线恢复都不经过 AuthorizeTTY，需要用它重新校验
+func CheckSessionAccess(assetID, osAccount string, grant *AccessGrant) error {
+	if err := checkUserPermission(assetID, grant); err != nil {
+		return err
+	}
+	_, err := ResolveHostAccount(assetID, grant, osAccount)
+	return err
+}
+
+// checkUserPermission 校验资产状态，并按资产授权规则校验用户权限
+func checkUserPermission(assetID string, grant *AccessGrant) error {
 	asset, err := mysql.GetAssetByID(assetID)
 	if err != nil {
-		return false, fmt.Errorf("asset not found: %w", err)
-	}
-	if asset.Status != "online" {
-		return false, errors.New("machine is not online")
+		return fmt.Errorf("asset not found: %w", err)
 	}
 	if asset.IsDeleted {
-		return false, errors.New("machine has been deleted")
+		return errors.New("machine has been deleted")
 	}
-
-	// 获取允许用户列表
-	allowedUsers, err := asset.GetAllowedUsersArray()
-	if err != nil {
-		return false, fmt.Errorf("invalid allowed_users format: %w", err)
+	if asset.Status != "online" {
+		return errors.New("machine is not online")
 	}
-
-	// 关键修改：支持通配符 `*`
-	for _, allowed := range allowedUsers {
-		if allowed == "*" || allowed == userID {
-			zap.L().Debug("权限校验通过",
-				zap.String("user_id", userID),
-				zap.String("allowed", allowed),
-				zap.String("asset_id", assetID))
-			return true, nil
-		}
+	if err := checkAgentState(asset.AgentState); err != nil {
+		return err
 	}
-
-	// 无匹配
-	zap.L().Warn("权限校验失败",
-		zap.String("user_id", userID),
-		zap.Int("allowed_count", len(allowedUsers)),
-		zap.String("asset_id", assetID))
-	return false, errors.New("user not in allowed users list")
+	return CheckAssetAccess(grant, asset)
 }
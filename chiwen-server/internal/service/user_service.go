@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/chiwen/server/internal/data/model"
+	"github.com/chiwen/server/internal/data/mysql"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minPasswordLength 本地账号密码最短长度
+const minPasswordLength = 8
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.@-]{1,63}$`)
+
+var (
+	// ErrLastAdmin 禁止禁用、删除或降级最后一个启用中的管理员
+	ErrLastAdmin = errors.New("cannot remove the last active admin")
+	// ErrSelfOperation 管理员不能禁用或删除自己
+	ErrSelfOperation = errors.New("cannot disable or delete yourself")
+)
+
+// ValidateUsername 校验用户名
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("invalid username %q", username)
+	}
+	return nil
+}
+
+// HashPassword 校验密码强度并生成 bcrypt 哈希
+func HashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	if len(password) > 72 {
+		return "", errors.New("password must be at most 72 bytes")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// ListUsers 分页查询用户，附带所属用户组
+func ListUsers(f model.UserFilter) ([]model.UserProfile, int, error) {
+	if f.Page <= 0 {
+		f.Page = 1
+	}
+	if f.PageSize <= 0 || f.PageSize > 100 {
+		f.PageSize = 20
+	}
+	users, total, err := mysql.ListUsers(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range users {
+		if groups, err := mysql.GetUserGroupIDs(users[i].ID); err == nil {
+			users[i].GroupIDs = groups
+		}
+		if roles, err := mysql.GetUserRoleIDs(users[i].ID); err == nil {
+			users[i].RoleIDs = roles
+		}
+	}
+	return users, total, nil
+}
+
+// ensureAdminRemains 操作会让 target 失去管理员身份时，确认系统中仍有其他启用中的管理员
+func ensureAdminRemains(target *model.UserProfile) error {
+	if !target.IsAdmin || !target.IsActive {
+		return nil
+	}
+	n, err := mysql.CountActiveAdmins()
+	if err != nil {
+		return err
+	}
+	if n <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// UpdateUser 修改用户信息；取消管理员身份时不能移除最后一个管理员
+func UpdateUser(id uint, name, email, phone string, isAdmin bool) error {
+	target, err := mysql.GetUserProfile(id)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		if err := ensureAdminRemains(target); err != nil {
+			return err
+		}
+	}
+	return mysql.UpdateUser(id, name, email, phone, isAdmin)
+}
+
+// SetUserActive 启用/禁用用户，禁用时吊销其已签发的全部令牌
+func SetUserActive(operatorID, id uint, active bool) error {
+	if !active && operatorID == id {
+		return ErrSelfOperation
+	}
+	target, err := mysql.GetUserProfile(id)
+	if err != nil {
+		return err
+	}
+	if !active {
+		if err := ensureAdminRemains(target); err != nil {
+			return err
+		}
+	}
+	if err := mysql.SetUserActive(id, active); err != nil {
+		return err
+	}
+	if !active {
+		return RevokeUserTokens(id, "user disabled")
+	}
+	return nil
+}
+
+// DeleteUser 删除用户
+func DeleteUser(operatorID, id uint) error {
+	if operatorID == id {
+		return ErrSelfOperation
+	}
+	target, err := mysql.GetUserProfile(id)
+	if err != nil {
+		return err
+	}
+	if err := ensureAdminRemains(target); err != nil {
+		return err
+	}
+	if err := RevokeUserTokens(id, "user deleted"); err != nil {
+		return err
+	}
+	if err := mysql.DeleteUser(id); err != nil {
+		return err
+	}
+	InvalidatePermissions()
+	return nil
+}
@@ -4,6 +4,8 @@ package task
 import (
 	"time"
 
+	"github.com/chiwen/server/internal/data/mysql"
+	"github.com/chiwen/server/internal/service"
 	"go.uber.org/zap"
 )
 
@@ -12,6 +14,11 @@ func StartBackgroundTasks() {
 	// 第一次立刻执行一次
 	OfflineDetector()
 
+	// 服务重启后内存中的审批等待已丢失，遗留的待审批单直接置为过期
+	if err := mysql.ExpirePendingCommandApprovals(); err != nil {
+		zap.L().Error("expire pending command approvals failed", zap.Error(err))
+	}
+
 	ticker := time.NewTicker(30 * time.Second)
 	go func() {
 		defer ticker.Stop()
@@ -29,5 +36,18 @@ func StartBackgroundTasks() {
 		}
 	}()
 
+	// 过期的刷新令牌、吊销记录和登录限流记录清理，Agent 密钥定期轮换及过期密钥清理（每小时）
+	ticker3 := time.NewTicker(time.Hour)
+	go func() {
+		defer ticker3.Stop()
+		for range ticker3.C {
+			service.PruneTokenRevocations()
+			service.PruneLoginThrottle()
+			service.CleanupAgentSecrets()
+			service.RotateDueAgentSecrets()
+			service.PruneAgentReplayCache()
+		}
+	}()
+
 	zap.L().Info("background tasks started (offline detector every 30 seconds)")
 }
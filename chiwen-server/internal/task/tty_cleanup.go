@@ -15,10 +15,12 @@ func TTYSessionCleanup() {
 	}
 
 	// 清理30分钟前已关闭的会话（可选）
+	// 有录像的会话属于审计数据，需要保留
 	query := `
 		DELETE FROM tty_sessions 
 		WHERE status = 'closed' 
 		  AND closed_at < DATE_SUB(NOW(), INTERVAL 30 MINUTE)
+		  AND (record_file IS NULL OR record_file = '')
 		LIMIT 1000
 	`
 